@@ -14,7 +14,13 @@ import (
 
 	"github.com/actio/clickhouse-monitoring/internal/config"
 	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/handlers"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
+	"github.com/actio/clickhouse-monitoring/internal/report"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
 	"github.com/actio/clickhouse-monitoring/internal/router"
+	"github.com/actio/clickhouse-monitoring/internal/telemetry"
 )
 
 func main() {
@@ -24,26 +30,131 @@ func main() {
 	}
 
 	// Load configuration from environment variables
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	log.Printf("Starting ClickHouse Monitoring Server...")
-	log.Printf("Connecting to ClickHouse at %s:%d", cfg.ClickHouse.Host, cfg.ClickHouse.Port)
 
-	// Initialize ClickHouse connection
-	db, err := database.NewClickHouseDB(cfg.ClickHouse)
+	// Initialize tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	if cfg.Tracing.OTLPEndpoint != "" {
+		log.Printf("Exporting traces to %s", cfg.Tracing.OTLPEndpoint)
+	}
+	// Initialize the local annotation store
+	annotationStore, err := repository.NewFileAnnotationStore(cfg.Annotations.FilePath)
+	if err != nil {
+		log.Fatalf("Failed to load annotations: %v", err)
+	}
+
+	// Initialize object storage for exports (nil when no bucket is configured)
+	exportStore, err := objectstore.NewS3(objectstore.S3Options{
+		Bucket:          cfg.Export.S3Bucket,
+		Prefix:          cfg.Export.S3Prefix,
+		Region:          cfg.Export.S3Region,
+		Endpoint:        cfg.Export.S3Endpoint,
+		AccessKeyID:     cfg.Export.S3AccessKeyID,
+		SecretAccessKey: cfg.Export.S3SecretAccessKey,
+		SessionToken:    cfg.Export.S3SessionToken,
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+		log.Fatalf("Failed to configure S3 exports: %v", err)
+	}
+	if exportStore != nil {
+		log.Printf("S3 export destination enabled: %s", exportStore.URI(""))
+	}
+
+	if err := repository.ValidateSort(cfg.API.DefaultSortBy, cfg.API.DefaultSortOrder, models.ValidSortColumns); err != nil {
+		log.Fatalf("Invalid DEFAULT_SORT_BY/DEFAULT_SORT_ORDER: %v", err)
+	}
+
+	columnTypes, err := repository.ParseColumnTypeOverrides(cfg.ClickHouse.ColumnTypeOverrides)
+	if err != nil {
+		log.Fatalf("Invalid COLUMN_TYPE_OVERRIDES: %v", err)
+	}
+
+	if keys := len(cfg.Runtime.Load().KeyQuotas); keys > 0 {
+		log.Printf("API key quotas enabled for %d keys", keys)
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("Error closing database connection: %v", err)
+
+	// Initialize repositories
+	repoOpts := repository.Options{
+		MaxConcurrentQueries: cfg.ClickHouse.MaxConcurrentQueries,
+		QueryQueueTimeout:    cfg.ClickHouse.QueryQueueTimeout,
+		MetricsMaxScanRows:   uint64(max(cfg.ClickHouse.MetricsMaxScanRows, 0)),
+		MetricsSampleRatio:   cfg.ClickHouse.MetricsSampleRatio,
+		MaxBuckets:           cfg.ClickHouse.MaxBuckets,
+		ShardHosts:           cfg.ClickHouse.ShardHosts,
+		AllowedDatabases:     cfg.API.AllowedDatabases,
+		RecentWindow:         cfg.ClickHouse.RecentCacheWindow,
+		RecentInterval:       cfg.ClickHouse.RecentCacheInterval,
+		RecentMaxEntries:     cfg.ClickHouse.RecentCacheMaxEntries,
+		TraceIDPattern:       cfg.API.TraceIDPattern,
+		ColumnTypes:          columnTypes,
+	}
+
+	// The keepalive loop stops when this is cancelled on shutdown
+	keepaliveCtx, stopKeepalive := context.WithCancel(context.Background())
+	defer stopKeepalive()
+
+	var (
+		healthChecker handlers.HealthChecker
+		queryLogRepo  repository.QueryLogStore
+	)
+	if cfg.Server.DemoMode {
+		// Serve synthetic data without connecting to ClickHouse
+		log.Printf("DEMO_MODE enabled: serving synthetic query_log data")
+		demoRepo := repository.NewDemoRepository(time.Now(), repoOpts)
+		healthChecker, queryLogRepo = demoRepo, demoRepo
+	} else {
+		if cfg.ClickHouse.DSN != "" {
+			log.Printf("Connecting to ClickHouse using CLICKHOUSE_DSN")
+		} else {
+			log.Printf("Connecting to ClickHouse at %s:%d", cfg.ClickHouse.Host, cfg.ClickHouse.Port)
 		}
-	}()
 
-	log.Printf("Successfully connected to ClickHouse")
+		// Initialize ClickHouse connection
+		db, err := database.NewClickHouseDB(cfg.ClickHouse)
+		if err != nil {
+			log.Fatalf("Failed to connect to ClickHouse: %v", err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				log.Printf("Error closing database connection: %v", err)
+			}
+		}()
+
+		log.Printf("Successfully connected to ClickHouse")
+		if profile := cfg.ClickHouse.SettingsProfile; profile != "" {
+			log.Printf("Using ClickHouse settings profile %q; CLICKHOUSE_QUERY_TIMEOUT and CLICKHOUSE_MAX_RESULT_ROWS/BYTES are not sent", profile)
+		} else if n := cfg.ClickHouse.MaxResultRows; n > 0 && n < max(1000, cfg.ClickHouse.MaxBuckets) {
+			log.Printf("Warning: CLICKHOUSE_MAX_RESULT_ROWS=%d is below the largest page or bucket count; some requests will fail with result_too_large", n)
+		}
+		healthChecker, queryLogRepo = db, repository.NewQueryLogRepository(db, repoOpts)
+
+		// Ping in the background so outages are noticed before a user request fails
+		if interval := cfg.ClickHouse.KeepaliveInterval; interval > 0 {
+			go db.RunKeepalive(keepaliveCtx, interval, cfg.ClickHouse.KeepaliveRecycle)
+		}
+	}
+
+	// Start the scheduled report (disabled unless REPORT_WEBHOOK_URL is set)
+	reportScheduler, err := report.NewScheduler(queryLogRepo, exportStore, cfg.Report)
+	if err != nil {
+		log.Fatalf("Failed to configure scheduled report: %v", err)
+	}
+	reportCtx, stopReports := context.WithCancel(context.Background())
+	defer stopReports()
+	if reportScheduler != nil {
+		go reportScheduler.Run(reportCtx)
+	}
 
 	// Setup router with all handlers
-	r := router.Setup(db)
+	r := router.Setup(cfg, healthChecker, queryLogRepo, annotationStore, exportStore)
 
 	// Configure HTTP server
 	srv := &http.Server{
@@ -67,6 +178,8 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopReports()
+	stopKeepalive()
 
 	// Give outstanding requests 30 seconds to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -76,5 +189,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Flush any buffered spans
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Error shutting down tracing: %v", err)
+	}
+
 	log.Println("Server exited gracefully")
 }
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the number of entries kept per cache. When a Set would
+// exceed it, expired entries are dropped first and the cache is cleared if
+// that is not enough.
+const maxEntries = 1000
+
+// TTL is a concurrency-safe in-memory cache whose entries expire after a fixed duration.
+// A TTL cache with a non-positive duration never stores anything.
+type TTL[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]entry[V]
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a TTL cache whose entries live for ttl.
+func New[V any](ttl time.Duration) *TTL[V] {
+	return &TTL[V]{ttl: ttl, entries: make(map[string]entry[V])}
+}
+
+// Get returns the cached value for key if it exists and has not expired.
+func (c *TTL[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key until the cache's TTL elapses.
+func (c *TTL[V]) Set(key string, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Clear removes all entries.
+func (c *TTL[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
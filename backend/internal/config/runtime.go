@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// minQuotaKeyLength keeps API_KEY_QUOTAS keys long enough that the masked form
+// shown in /admin/quotas and /metrics reveals little of them.
+const minQuotaKeyLength = 9
+
+// RuntimeConfig holds settings that can be changed without a restart via
+// POST /admin/reload. Server, ClickHouse connection and pool settings are
+// read once at startup and are not part of it.
+//
+// Reloadable keys: CORS_ALLOWED_ORIGINS, API_KEY_QUOTAS
+type RuntimeConfig struct {
+	// CORSAllowedOrigins lists the origins allowed to call the API
+	CORSAllowedOrigins []string
+
+	// KeyQuotas maps each API key to the requests it may make per sliding 24
+	// hours (see middleware.EnforceQuotas; empty = no quotas)
+	KeyQuotas map[string]int
+}
+
+// LoadRuntime creates a RuntimeConfig from environment variables. It returns
+// an error when API_KEY_QUOTAS is invalid.
+func LoadRuntime() (*RuntimeConfig, error) {
+	quotas, err := ParseKeyQuotas(getListEnv("API_KEY_QUOTAS", nil))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_KEY_QUOTAS: %w", err)
+	}
+	return &RuntimeConfig{
+		CORSAllowedOrigins: getListEnv("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000", "http://127.0.0.1:3000"}),
+		KeyQuotas:          quotas,
+	}, nil
+}
+
+// ParseKeyQuotas parses "key:limit" pairs (API_KEY_QUOTAS) into a map of key to
+// limit. Keys are reported masked to their last four characters, so they must
+// be at least minQuotaKeyLength long and differ in those characters.
+func ParseKeyQuotas(pairs []string) (map[string]int, error) {
+	quotas := make(map[string]int, len(pairs))
+	masked := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		// Split on the last colon so keys may contain colons
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid quota %q (expected key:limit)", models.MaskAPIKey(pair))
+		}
+		key := strings.TrimSpace(pair[:i])
+		limit, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid quota for key %s: limit must be a positive integer", models.MaskAPIKey(key))
+		}
+		if len(key) < minQuotaKeyLength {
+			return nil, fmt.Errorf("quota key %s is too short (at least %d characters)", models.MaskAPIKey(key), minQuotaKeyLength)
+		}
+		if _, dup := quotas[key]; dup {
+			return nil, fmt.Errorf("duplicate quota for key %s", models.MaskAPIKey(key))
+		}
+		if masked[models.MaskAPIKey(key)] {
+			return nil, fmt.Errorf("quota keys must differ in their last four characters (%s is used twice)", models.MaskAPIKey(key))
+		}
+		masked[models.MaskAPIKey(key)] = true
+		quotas[key] = limit
+	}
+	return quotas, nil
+}
+
+// LiveConfig holds the current RuntimeConfig behind an atomic pointer, so it
+// can be swapped while middleware and handlers are reading it.
+type LiveConfig struct {
+	current atomic.Pointer[RuntimeConfig]
+}
+
+// NewLiveConfig creates a LiveConfig holding initial.
+func NewLiveConfig(initial *RuntimeConfig) *LiveConfig {
+	l := &LiveConfig{}
+	l.current.Store(initial)
+	return l
+}
+
+// Load returns the current runtime settings. The returned value must not be modified.
+func (l *LiveConfig) Load() *RuntimeConfig {
+	return l.current.Load()
+}
+
+// Reload re-reads the .env file (if present) and the environment, then
+// atomically replaces the current runtime settings. When the new settings are
+// invalid it returns an error and keeps the current ones.
+func (l *LiveConfig) Reload() (*RuntimeConfig, error) {
+	// Overload so values changed in .env replace those loaded at startup
+	_ = godotenv.Overload()
+
+	next, err := LoadRuntime()
+	if err != nil {
+		return nil, err
+	}
+	l.current.Store(next)
+	return next, nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeyQuotas(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		wantErr string
+	}{
+		{name: "valid", pairs: []string{"team-alpha:100", "team-bravo:20"}},
+		{name: "colon in key", pairs: []string{"team:alpha:100"}},
+		{name: "missing limit", pairs: []string{"team-alpha"}, wantErr: "key:limit"},
+		{name: "zero limit", pairs: []string{"team-alpha:0"}, wantErr: "limit"},
+		{name: "short key", pairs: []string{"short:100"}, wantErr: "too short"},
+		{name: "duplicate key", pairs: []string{"team-alpha:100", "team-alpha:20"}, wantErr: "duplicate"},
+		{name: "same masked key", pairs: []string{"team-alpha:100", "team-bravo:20", "other-alpha:5"}, wantErr: "last four"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyQuotas(tt.pairs)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseKeyQuotas(%v): %v", tt.pairs, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseKeyQuotas(%v) error = %v, want %q", tt.pairs, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,24 +4,123 @@ import (
 	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"fmt"
+	"maps"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/telemetry"
 )
 
+// ErrCircuitOpen is returned when queries are short-circuited because
+// ClickHouse has been failing repeatedly.
+var ErrCircuitOpen = errors.New("clickhouse circuit breaker is open")
+
 // ClickHouseDB wraps the ClickHouse connection with additional functionality.
 type ClickHouseDB struct {
-	db  *sql.DB
-	cfg config.ClickHouseConfig
+	db      *sql.DB
+	cfg     config.ClickHouseConfig
+	breaker *gobreaker.CircuitBreaker
+	metrics breakerMetrics
+
+	// settings are the query settings applied to every connection
+	settings clickhouse.Settings
+
+	// lastPing is the Unix time in nanoseconds of the last successful ping
+	// (see LastPing)
+	lastPing atomic.Int64
 }
 
 // NewClickHouseDB creates and initializes a new ClickHouse database connection.
 // It validates the connection by executing a ping operation.
-// For ClickHouse Cloud, set Secure=true to enable TLS over HTTP protocol.
+// For ClickHouse Cloud, set Secure=true to enable TLS over HTTP protocol,
+// or pass a DSN with ?secure=true.
 func NewClickHouseDB(cfg config.ClickHouseConfig) (*ClickHouseDB, error) {
+	opts, err := buildOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use OpenDB which returns *sql.DB - works better with HTTP protocol
+	db := clickhouse.OpenDB(opts)
+
+	// Configure connection pool
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	// Verify the connection is working
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		if hint := connectionHint(cfg, opts); hint != "" {
+			return nil, fmt.Errorf("failed to ping clickhouse: %w (hint: %s)", err, hint)
+		}
+		return nil, fmt.Errorf("failed to ping clickhouse: %w", err)
+	}
+
+	// Optionally pre-open idle connections so the first requests don't pay setup latency
+	if cfg.WarmupPool {
+		if err := warmupPool(ctx, db, cfg.MaxIdleConns); err != nil {
+			return nil, fmt.Errorf("failed to warm up connection pool: %w", err)
+		}
+	}
+
+	c := &ClickHouseDB{
+		db:       db,
+		cfg:      cfg,
+		settings: opts.Settings,
+	}
+	c.breaker = newBreaker(cfg, &c.metrics)
+	c.recordPing()
+	return c, nil
+}
+
+// newBreaker creates the circuit breaker guarding queries.
+// The breaker opens after BreakerMaxFailures consecutive failures, rejects queries
+// for BreakerCooldown, then half-opens to let a single trial query through.
+// State changes are counted in metrics.
+func newBreaker(cfg config.ClickHouseConfig, metrics *breakerMetrics) *gobreaker.CircuitBreaker {
+	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        "clickhouse",
+		MaxRequests: 1,
+		Timeout:     cfg.BreakerCooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return cfg.BreakerMaxFailures > 0 && counts.ConsecutiveFailures >= uint32(cfg.BreakerMaxFailures)
+		},
+		// Client cancellations, empty results, missing optional log tables and
+		// results over the configured size guards say nothing about ClickHouse health
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled) || errors.Is(err, sql.ErrNoRows) || IsUnknownTable(err) || IsResultTooLarge(err)
+		},
+		OnStateChange: metrics.onStateChange,
+	})
+}
+
+// BreakerState returns the circuit breaker state ("closed", "half-open" or "open").
+func (c *ClickHouseDB) BreakerState() string {
+	return c.breaker.State().String()
+}
+
+// buildOptions translates the application config into ClickHouse driver options.
+// When cfg.DSN is set it is parsed instead of the individual connection fields.
+func buildOptions(cfg config.ClickHouseConfig) (*clickhouse.Options, error) {
+	if cfg.DSN != "" {
+		return buildDSNOptions(cfg)
+	}
+
 	// Determine protocol based on Secure setting
 	// ClickHouse Cloud uses HTTPS (port 8443), self-hosted typically uses native (port 9000)
 	protocol := clickhouse.Native
@@ -37,13 +136,12 @@ func NewClickHouseDB(cfg config.ClickHouseConfig) (*ClickHouseDB, error) {
 			Username: cfg.Username,
 			Password: cfg.Password,
 		},
-		Settings: clickhouse.Settings{
-			// Limit memory usage per query to prevent OOM
-			"max_memory_usage": 1000000000, // 1GB
-			// Set query timeout from config
-			"max_execution_time": cfg.QueryTimeout,
-		},
+		Settings: defaultSettings(cfg),
+		// DialTimeout bounds establishing a connection; ReadTimeout bounds waiting
+		// on the server for a response. Both are client-side network timeouts,
+		// distinct from max_execution_time which ClickHouse enforces per query.
 		DialTimeout: cfg.DialTimeout,
+		ReadTimeout: cfg.ReadTimeout,
 		Compression: &clickhouse.Compression{
 			Method: clickhouse.CompressionLZ4,
 		},
@@ -54,26 +152,92 @@ func NewClickHouseDB(cfg config.ClickHouseConfig) (*ClickHouseDB, error) {
 		opts.TLS = &tls.Config{}
 	}
 
-	// Use OpenDB which returns *sql.DB - works better with HTTP protocol
-	db := clickhouse.OpenDB(opts)
+	return opts, nil
+}
 
-	// Configure connection pool
-	db.SetMaxOpenConns(cfg.MaxOpenConns)
-	db.SetMaxIdleConns(cfg.MaxIdleConns)
-	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+// buildDSNOptions parses cfg.DSN with the driver's DSN parser and merges the
+// timeout settings from cfg on top. Query settings given in the DSN win over
+// the defaults.
+func buildDSNOptions(cfg config.ClickHouseConfig) (*clickhouse.Options, error) {
+	opts, err := clickhouse.ParseDSN(cfg.DSN)
+	if err != nil {
+		// The DSN may contain a password, so don't echo it back
+		return nil, errors.New("invalid CLICKHOUSE_DSN: failed to parse connection string")
+	}
 
-	// Verify the connection is working
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
-	defer cancel()
+	opts.DialTimeout = cfg.DialTimeout
+	opts.ReadTimeout = cfg.ReadTimeout
 
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping clickhouse: %w", err)
+	if opts.Settings == nil {
+		opts.Settings = clickhouse.Settings{}
+	}
+	for name, value := range defaultSettings(cfg) {
+		if _, ok := opts.Settings[name]; !ok {
+			opts.Settings[name] = value
+		}
+	}
+
+	if opts.Compression == nil {
+		opts.Compression = &clickhouse.Compression{Method: clickhouse.CompressionLZ4}
 	}
 
-	return &ClickHouseDB{
-		db:  db,
-		cfg: cfg,
-	}, nil
+	return opts, nil
+}
+
+// defaultSettings returns the query settings applied to every connection.
+// With a settings profile only the profile is sent: ClickHouse applies query
+// settings in the order received and the driver's order is random, so sending
+// individual settings alongside it would make precedence unpredictable.
+func defaultSettings(cfg config.ClickHouseConfig) clickhouse.Settings {
+	if cfg.SettingsProfile != "" {
+		return clickhouse.Settings{"profile": cfg.SettingsProfile}
+	}
+
+	settings := clickhouse.Settings{
+		// Limit memory usage per query to prevent OOM
+		"max_memory_usage": 1000000000, // 1GB
+		// Set query timeout from config
+		"max_execution_time": cfg.QueryTimeout,
+	}
+
+	// Hard result size guards, left to the server default unless configured.
+	// "throw" fails the query rather than silently truncating the result.
+	if cfg.MaxResultRows > 0 || cfg.MaxResultBytes > 0 {
+		settings["result_overflow_mode"] = "throw"
+	}
+	if cfg.MaxResultRows > 0 {
+		settings["max_result_rows"] = cfg.MaxResultRows
+	}
+	if cfg.MaxResultBytes > 0 {
+		settings["max_result_bytes"] = cfg.MaxResultBytes
+	}
+	return settings
+}
+
+// warmupPool opens n connections and pings each one.
+// All connections are held until every ping completes, then returned to the
+// pool together so they remain available as idle connections.
+func warmupPool(ctx context.Context, db *sql.DB, n int) error {
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // DB returns the underlying *sql.DB connection.
@@ -88,13 +252,17 @@ func (c *ClickHouseDB) Close() error {
 
 // Ping checks if the database connection is still alive.
 func (c *ClickHouseDB) Ping(ctx context.Context) error {
-	return c.db.PingContext(ctx)
+	if err := c.db.PingContext(ctx); err != nil {
+		return err
+	}
+	c.recordPing()
+	return nil
 }
 
 // HealthCheck performs a comprehensive health check on the database connection.
 func (c *ClickHouseDB) HealthCheck(ctx context.Context) error {
 	// First, check basic connectivity
-	if err := c.db.PingContext(ctx); err != nil {
+	if err := c.Ping(ctx); err != nil {
 		return fmt.Errorf("ping failed: %w", err)
 	}
 
@@ -108,9 +276,49 @@ func (c *ClickHouseDB) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
-// QueryContext executes a query and returns rows.
+// QueryContext executes a query through the circuit breaker and returns rows.
+// Returns ErrCircuitOpen without contacting ClickHouse while the breaker is open.
+//
+// Each call is traced as a client span tagged with the HTTP endpoint and the
+// query text. Queries use ? placeholders, so the text never contains filter
+// values. The span's traceparent is sent as the query's log_comment so
+// query_log rows can be correlated with traces, along with any overrides from
+// WithQuerySettings. The applied settings are recorded for requests using
+// WithSettingsRecorder.
 func (c *ClickHouseDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return c.db.QueryContext(ctx, query, args...)
+	ctx, span := telemetry.Tracer().Start(ctx, "clickhouse.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemClickhouse,
+			semconv.DBQueryText(strings.Join(strings.Fields(query), " ")),
+			attribute.String("http.route", telemetry.Endpoint(ctx)),
+		),
+	)
+	defer span.End()
+
+	overrides := clickhouse.Settings{}
+	maps.Copy(overrides, querySettings(ctx))
+	if traceparent := telemetry.Traceparent(ctx); traceparent != "" {
+		overrides["log_comment"] = traceparent
+	}
+	if len(overrides) > 0 {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(overrides))
+	}
+	recordSettings(ctx, c.settings, overrides)
+
+	result, err := c.breaker.Execute(func() (interface{}, error) {
+		return c.db.QueryContext(ctx, query, args...)
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		c.metrics.rejected.Add(1)
+		err = ErrCircuitOpen
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return result.(*sql.Rows), nil
 }
 
 // QueryRowContext executes a query that returns a single row.
@@ -130,3 +338,49 @@ func (c *ClickHouseDB) QueryWithTimeout(
 
 	return c.db.QueryContext(queryCtx, query, args...)
 }
+
+// unknownTableCode is ClickHouse's UNKNOWN_TABLE error code.
+const unknownTableCode = 60
+
+// tooManyRowsOrBytesCode is ClickHouse's TOO_MANY_ROWS_OR_BYTES error code.
+const tooManyRowsOrBytesCode = 396
+
+// timeoutExceededCode is ClickHouse's TIMEOUT_EXCEEDED error code.
+const timeoutExceededCode = 159
+
+// IsUnknownTable reports whether err is ClickHouse's UNKNOWN_TABLE error, e.g.
+// when querying an optional system log table that isn't enabled on the server.
+func IsUnknownTable(err error) bool {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		return exception.Code == unknownTableCode
+	}
+	// The HTTP protocol reports exceptions as plain text
+	return err != nil && strings.Contains(err.Error(), "UNKNOWN_TABLE")
+}
+
+// IsResultTooLarge reports whether err is ClickHouse's TOO_MANY_ROWS_OR_BYTES
+// error, raised when a result exceeds CLICKHOUSE_MAX_RESULT_ROWS or
+// CLICKHOUSE_MAX_RESULT_BYTES.
+func IsResultTooLarge(err error) bool {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		return exception.Code == tooManyRowsOrBytesCode
+	}
+	// The HTTP protocol reports exceptions as plain text
+	return err != nil && strings.Contains(err.Error(), "TOO_MANY_ROWS_OR_BYTES")
+}
+
+// IsTimeout reports whether err is a query timeout: ClickHouse's
+// TIMEOUT_EXCEEDED (max_execution_time) or an expired client-side deadline.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		return exception.Code == timeoutExceededCode
+	}
+	// The HTTP protocol reports exceptions as plain text
+	return err != nil && strings.Contains(err.Error(), "TIMEOUT_EXCEEDED")
+}
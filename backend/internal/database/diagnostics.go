@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+)
+
+// wellKnownPort describes what ClickHouse serves on one of its default ports.
+type wellKnownPort struct {
+	protocol    clickhouse.Protocol
+	tls         bool
+	description string
+}
+
+// wellKnownPorts are ClickHouse's default listener ports.
+var wellKnownPorts = map[int]wellKnownPort{
+	9000: {clickhouse.Native, false, "the plain native protocol port"},
+	9440: {clickhouse.Native, true, "the native protocol port with TLS"},
+	8123: {clickhouse.HTTP, false, "the plain HTTP port"},
+	8443: {clickhouse.HTTP, true, "the HTTPS port"},
+}
+
+// connectionHint inspects opts for a protocol or TLS setting that doesn't fit
+// a well-known ClickHouse port, such as the native protocol pointed at 8443.
+// Those mismatches surface as opaque dial or ping errors, so the hint names
+// the likely fix. Returns "" when nothing looks wrong.
+func connectionHint(cfg config.ClickHouseConfig, opts *clickhouse.Options) string {
+	secure := opts.TLS != nil
+	for _, addr := range opts.Addr {
+		_, portText, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(portText)
+		if err != nil {
+			continue
+		}
+		known, ok := wellKnownPorts[port]
+		if !ok || (known.protocol == opts.Protocol && known.tls == secure) {
+			continue
+		}
+
+		if cfg.DSN != "" {
+			return fmt.Sprintf("port %d is usually %s; check the CLICKHOUSE_DSN scheme and secure parameter", port, known.description)
+		}
+
+		// Without a DSN, CLICKHOUSE_SECURE picks between the plain native
+		// protocol and HTTPS, so suggest the flag or the matching port
+		switch {
+		case port == 8443:
+			return "port 8443 usually requires CLICKHOUSE_SECURE=true"
+		case port == 9000:
+			return "port 9000 usually requires CLICKHOUSE_SECURE=false"
+		case cfg.Secure:
+			return fmt.Sprintf("port %d is usually %s; CLICKHOUSE_SECURE=true connects over HTTPS, usually on port 8443", port, known.description)
+		default:
+			return fmt.Sprintf("port %d is usually %s; use port 9000 for the plain native protocol, or port 8443 with CLICKHOUSE_SECURE=true for TLS", port, known.description)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunKeepalive pings ClickHouse every interval until ctx is cancelled, so an
+// outage or restart is noticed (and reported by LastPing) before a user
+// request runs into it. When a ping fails and recycle is set, the idle pooled
+// connections are closed so the next queries dial fresh ones instead of
+// reusing connections to the old server process.
+func (c *ClickHouseDB) RunKeepalive(ctx context.Context, interval time.Duration, recycle bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, c.cfg.DialTimeout)
+		err := c.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			if !healthy {
+				log.Printf("clickhouse keepalive: ping succeeded again")
+			}
+			healthy = true
+			continue
+		}
+
+		healthy = false
+		log.Printf("clickhouse keepalive: ping failed: %v", err)
+		if recycle {
+			c.recycleIdleConns()
+		}
+	}
+}
+
+// LastPing returns when ClickHouse last answered a ping, or the zero time if
+// it never has.
+func (c *ClickHouseDB) LastPing() time.Time {
+	nanos := c.lastPing.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// recordPing notes a successful ping for LastPing.
+func (c *ClickHouseDB) recordPing() {
+	c.lastPing.Store(time.Now().UnixNano())
+}
+
+// recycleIdleConns closes every idle pooled connection. Dropping the idle
+// limit to zero makes database/sql close them; restoring it lets the pool
+// refill as new connections are opened.
+func (c *ClickHouseDB) recycleIdleConns() {
+	c.db.SetMaxIdleConns(0)
+	c.db.SetMaxIdleConns(c.cfg.MaxIdleConns)
+}
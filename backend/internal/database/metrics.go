@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sony/gobreaker"
+)
+
+// breakerTransitions lists the state changes the breaker can make, as reported
+// by clickhouse_circuit_breaker_transitions_total.
+var breakerTransitions = [][2]gobreaker.State{
+	{gobreaker.StateClosed, gobreaker.StateOpen},
+	{gobreaker.StateOpen, gobreaker.StateHalfOpen},
+	{gobreaker.StateHalfOpen, gobreaker.StateClosed},
+	{gobreaker.StateHalfOpen, gobreaker.StateOpen},
+}
+
+// breakerMetrics counts circuit breaker state changes and rejected queries.
+type breakerMetrics struct {
+	// transitions counts state changes, indexed by the from and to states
+	transitions [3][3]atomic.Uint64
+
+	// rejected counts queries short-circuited with ErrCircuitOpen
+	rejected atomic.Uint64
+}
+
+// onStateChange is the breaker's OnStateChange hook.
+func (m *breakerMetrics) onStateChange(name string, from, to gobreaker.State) {
+	m.transitions[from][to].Add(1)
+}
+
+// WriteMetrics writes the circuit breaker state, its transitions and the
+// queries it rejected in the Prometheus text exposition format.
+func (c *ClickHouseDB) WriteMetrics(w io.Writer) error {
+	return c.metrics.write(w, c.breaker.State())
+}
+
+// WriteIdleBreakerMetrics writes the metrics of a closed breaker that never
+// tripped, for DEMO_MODE where there is no ClickHouse to guard.
+func WriteIdleBreakerMetrics(w io.Writer) error {
+	var metrics breakerMetrics
+	return metrics.write(w, gobreaker.StateClosed)
+}
+
+// write writes the counters and state in the Prometheus text format.
+func (m *breakerMetrics) write(w io.Writer, state gobreaker.State) error {
+	var b strings.Builder
+	b.WriteString("# HELP clickhouse_circuit_breaker_state State of the ClickHouse circuit breaker: 0 closed, 1 half-open, 2 open.\n")
+	b.WriteString("# TYPE clickhouse_circuit_breaker_state gauge\n")
+	fmt.Fprintf(&b, "clickhouse_circuit_breaker_state %d\n", state)
+
+	b.WriteString("# HELP clickhouse_circuit_breaker_transitions_total Circuit breaker state changes since startup.\n")
+	b.WriteString("# TYPE clickhouse_circuit_breaker_transitions_total counter\n")
+	for _, t := range breakerTransitions {
+		fmt.Fprintf(&b, "clickhouse_circuit_breaker_transitions_total{from=%q,to=%q} %d\n", t[0], t[1], m.transitions[t[0]][t[1]].Load())
+	}
+
+	b.WriteString("# HELP clickhouse_circuit_breaker_rejected_total Queries rejected without contacting ClickHouse while the breaker was open or half-open.\n")
+	b.WriteString("# TYPE clickhouse_circuit_breaker_rejected_total counter\n")
+	fmt.Fprintf(&b, "clickhouse_circuit_breaker_rejected_total %d\n", m.rejected.Load())
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+)
+
+func TestBreakerMetrics(t *testing.T) {
+	c := &ClickHouseDB{}
+	c.breaker = newBreaker(config.ClickHouseConfig{BreakerMaxFailures: 2, BreakerCooldown: time.Hour}, &c.metrics)
+
+	failing := func() (interface{}, error) { return nil, errors.New("code: 202, TOO_MANY_SIMULTANEOUS_QUERIES") }
+	for range 2 {
+		_, _ = c.breaker.Execute(failing)
+	}
+	// The open breaker answers without touching the connection
+	if _, err := c.QueryContext(context.Background(), "SELECT 1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("QueryContext error = %v, want ErrCircuitOpen", err)
+	}
+
+	var b strings.Builder
+	if err := c.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE clickhouse_circuit_breaker_state gauge",
+		"clickhouse_circuit_breaker_state 2",
+		`clickhouse_circuit_breaker_transitions_total{from="closed",to="open"} 1`,
+		`clickhouse_circuit_breaker_transitions_total{from="half-open",to="closed"} 0`,
+		"# TYPE clickhouse_circuit_breaker_rejected_total counter",
+		"clickhouse_circuit_breaker_rejected_total 1",
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, b.String())
+		}
+	}
+}
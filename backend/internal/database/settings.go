@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// settingsRecorderKey is the context key for the request's settings recorder.
+type settingsRecorderKey struct{}
+
+// querySettingsKey is the context key for per-query setting overrides.
+type querySettingsKey struct{}
+
+// settingsRecorder collects the ClickHouse settings applied to the queries of
+// one request.
+type settingsRecorder struct {
+	mu       sync.Mutex
+	settings map[string]interface{}
+}
+
+// WithSettingsRecorder returns a context that records the settings applied to
+// queries run with it, for reporting via AppliedSettings.
+func WithSettingsRecorder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, settingsRecorderKey{}, &settingsRecorder{settings: make(map[string]interface{})})
+}
+
+// AppliedSettings returns the settings recorded for ctx's queries: the
+// connection defaults plus any per-query overrides, later queries winning.
+// Returns nil if ctx has no recorder.
+func AppliedSettings(ctx context.Context) map[string]interface{} {
+	recorder, ok := ctx.Value(settingsRecorderKey{}).(*settingsRecorder)
+	if !ok {
+		return nil
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return maps.Clone(recorder.settings)
+}
+
+// WithQuerySettings returns a context whose queries run with settings on top of
+// the connection settings. The driver sends query settings after the
+// connection's, so they also win over a settings profile.
+func WithQuerySettings(ctx context.Context, settings clickhouse.Settings) context.Context {
+	return context.WithValue(ctx, querySettingsKey{}, settings)
+}
+
+// querySettings returns the overrides set on ctx with WithQuerySettings.
+func querySettings(ctx context.Context) clickhouse.Settings {
+	settings, _ := ctx.Value(querySettingsKey{}).(clickhouse.Settings)
+	return settings
+}
+
+// recordSettings stores the connection settings and per-query overrides in
+// ctx's recorder, if any.
+func recordSettings(ctx context.Context, defaults, overrides clickhouse.Settings) {
+	recorder, ok := ctx.Value(settingsRecorderKey{}).(*settingsRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for name, value := range defaults {
+		recorder.settings[name] = value
+	}
+	for name, value := range overrides {
+		recorder.settings[name] = value
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/middleware"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// CacheInvalidator clears in-memory response caches.
+type CacheInvalidator interface {
+	// InvalidateCache clears the caches selected by target ("databases",
+	// "metrics" or "all") and returns an error for an unknown target.
+	InvalidateCache(target string) error
+}
+
+// AdminHandler handles operational endpoints under /admin.
+type AdminHandler struct {
+	live   *config.LiveConfig
+	caches CacheInvalidator
+	errors *middleware.ErrorLog
+	quotas *middleware.Quotas
+}
+
+// NewAdminHandler creates a new AdminHandler instance. errors may be nil when
+// the internal error log is disabled.
+func NewAdminHandler(live *config.LiveConfig, caches CacheInvalidator, errors *middleware.ErrorLog, quotas *middleware.Quotas) *AdminHandler {
+	return &AdminHandler{live: live, caches: caches, errors: errors, quotas: quotas}
+}
+
+// GetErrors handles GET /admin/errors
+//
+// Returns the most recent internal errors (5xx responses and panics), newest
+// first, up to ADMIN_ERROR_LOG_SIZE. The list is empty when the log is disabled.
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "time": "2024-01-22T10:00:00Z",
+//	      "method": "GET",
+//	      "route": "/api/v1/logs/metrics",
+//	      "status": 500,
+//	      "error": "failed to query aggregated metrics: ...",
+//	      "request_id": "abc123"
+//	    }
+//	  ]
+//	}
+func (h *AdminHandler) GetErrors(c *gin.Context) {
+	respondData(c, h.errors.Recent(), nil)
+}
+
+// GetQuotas handles GET /admin/quotas
+//
+// Returns the current usage of every API_KEY_QUOTAS key over the sliding 24
+// hour window, including how many requests were rejected since startup. Keys
+// are masked to their last four characters. The list is empty when no quotas
+// are configured.
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "key": "****a1b2",
+//	      "limit": 10000,
+//	      "used": 9850,
+//	      "remaining": 150,
+//	      "rejected": 0,
+//	      "window": "24h0m0s",
+//	      "reset_at": "2024-01-23T09:00:00Z"
+//	    }
+//	  ]
+//	}
+func (h *AdminHandler) GetQuotas(c *gin.Context) {
+	respondData(c, h.quotas.Usage(time.Now()), nil)
+}
+
+// Reload handles POST /admin/reload
+//
+// Re-reads the .env file and environment and swaps in the new runtime settings.
+// Only the keys listed in config.RuntimeConfig take effect; connection and
+// server settings still require a restart. API key quotas are reported masked,
+// and usage counted so far carries over to the new limits. When the new
+// settings are invalid it responds 500 invalid_config and keeps the current ones.
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "status": "reloaded",
+//	    "config": {
+//	      "cors_allowed_origins": ["http://localhost:3000"],
+//	      "api_key_quotas": {"****a1b2": 10000}
+//	    }
+//	  }
+//	}
+func (h *AdminHandler) Reload(c *gin.Context) {
+	runtime, err := h.live.Reload()
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidConfig, err.Error())
+		return
+	}
+
+	quotas := make(map[string]int, len(runtime.KeyQuotas))
+	for key, limit := range runtime.KeyQuotas {
+		quotas[models.MaskAPIKey(key)] = limit
+	}
+	respondData(c, gin.H{
+		"status": "reloaded",
+		"config": gin.H{
+			"cors_allowed_origins": runtime.CORSAllowedOrigins,
+			"api_key_quotas":       quotas,
+		},
+	}, nil)
+}
+
+// InvalidateCache handles POST /admin/cache/invalidate
+//
+// Clears in-memory response caches so the next request reads fresh data from
+// ClickHouse, e.g. after creating a database.
+//
+// Query Parameters:
+//   - target: "databases", "metrics" or "all" (default: all)
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "status": "invalidated",
+//	    "target": "all"
+//	  }
+//	}
+func (h *AdminHandler) InvalidateCache(c *gin.Context) {
+	target := c.DefaultQuery("target", "all")
+
+	if err := h.caches.InvalidateCache(target); err != nil {
+		respondError(c, models.ErrCodeInvalidTarget, err.Error())
+		return
+	}
+
+	respondData(c, gin.H{
+		"status": "invalidated",
+		"target": target,
+	}, nil)
+}
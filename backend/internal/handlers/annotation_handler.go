@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+// AnnotationHandler handles HTTP requests for query annotations.
+type AnnotationHandler struct {
+	store repository.AnnotationStore
+}
+
+// NewAnnotationHandler creates a new AnnotationHandler instance.
+func NewAnnotationHandler(store repository.AnnotationStore) *AnnotationHandler {
+	return &AnnotationHandler{store: store}
+}
+
+// CreateAnnotation handles POST /api/v1/annotations
+//
+// Request Body:
+//
+//	{
+//	  "query_id": "abc-123",
+//	  "note": "Regressed after the 2024-01-22 deploy",
+//	  "author": "alice"
+//	}
+//
+// Response: {"data": Annotation} with its id and created_at set
+func (h *AnnotationHandler) CreateAnnotation(c *gin.Context) {
+	var annotation models.Annotation
+	if err := c.ShouldBindJSON(&annotation); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return
+	}
+
+	created, err := h.store.Add(c.Request.Context(), annotation)
+	if err != nil {
+		c.Error(err)
+		respondError(c, models.ErrCodeStorageError, "Failed to save annotation")
+		return
+	}
+
+	respondCreated(c, created)
+}
+
+// ListAnnotations handles GET /api/v1/annotations
+//
+// Query Parameters:
+//   - query_id: Return only annotations for this query ID (if omitted, returns all)
+//
+// Response:
+//
+//	{
+//	  "data": [...]
+//	}
+func (h *AnnotationHandler) ListAnnotations(c *gin.Context) {
+	annotations, err := h.store.List(c.Request.Context(), c.Query("query_id"))
+	if err != nil {
+		c.Error(err)
+		respondError(c, models.ErrCodeStorageError, "Failed to retrieve annotations")
+		return
+	}
+
+	respondData(c, annotations, nil)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// GetAsyncInserts handles GET /api/v1/async-inserts
+//
+// Returns asynchronous inserts from system.asynchronous_insert_log, newest
+// first, including when each insert's batch was flushed. Responds 404
+// log_not_enabled when the server doesn't have the table
+// (asynchronous_insert_log is not configured).
+//
+// Query Parameters:
+//   - start_time, end_time, tz: Time range, parsed like GetQueryLogs
+//   - database: Filter by target database (exact match)
+//   - table: Filter by target table (exact match)
+//   - status: Filter by status: Ok, ParsingError or FlushError
+//   - query_id: Filter by the insert's query_id
+//   - limit: Maximum number of results (default: 100, max: 1000)
+//   - offset: Number of results to skip for pagination
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "event_time": "2024-01-22T10:30:00Z",
+//	      "query_id": "abc-123",
+//	      "database": "default",
+//	      "table": "events",
+//	      "format": "JSONEachRow",
+//	      "bytes": 2048,
+//	      "rows": 10,
+//	      "status": "Ok",
+//	      "exception": "",
+//	      "flush_time": "2024-01-22T10:30:01Z",
+//	      "flush_query_id": "def-456",
+//	      "flush_delay_ms": 950
+//	    }
+//	  ],
+//	  "meta": {
+//	    "pagination": {"limit": 100, "offset": 0, "count": 1}
+//	  }
+//	}
+func (h *QueryLogHandler) GetAsyncInserts(c *gin.Context) {
+	var filter models.AsyncInsertFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return
+	}
+
+	loc, err := loadLocation(filter.TZ)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidTimezone, err.Error())
+		return
+	}
+
+	if filter.StartTime, err = parseTimeParam(c.Query("start_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid start_time: %v", err))
+		return
+	}
+
+	if filter.EndTime, err = parseTimeParam(c.Query("end_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid end_time: %v", err))
+		return
+	}
+
+	if filter.Status != "" && !models.ValidAsyncInsertStatuses[filter.Status] {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid status: %q (expected Ok, ParsingError or FlushError)", filter.Status))
+		return
+	}
+
+	if filter.Database != "" && !h.repo.AllowedDatabase(filter.Database) {
+		respondError(c, models.ErrCodeForbiddenDatabase, fmt.Sprintf("database %q is not exposed by this server", filter.Database))
+		return
+	}
+
+	limit := effectiveLimit(c, filter.Limit)
+	filter.Offset = effectiveOffset(c, filter.Offset)
+
+	inserts, err := h.repo.GetAsyncInserts(c.Request.Context(), filter)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve async inserts")
+		return
+	}
+	for i := range inserts {
+		inserts[i].EventTime = inserts[i].EventTime.In(loc)
+		inserts[i].FlushTime = inserts[i].FlushTime.In(loc)
+	}
+
+	respondData(c, inserts, models.ListMeta{
+		Pagination: models.Pagination{
+			Limit:  limit,
+			Offset: filter.Offset,
+			Count:  len(inserts),
+		},
+	})
+}
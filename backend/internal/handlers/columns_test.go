@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestColumnsParameter(t *testing.T) {
+	router, _ := newDemoRouter(time.Now())
+
+	overCap := strings.TrimSuffix(strings.Repeat("query,", len(models.ValidColumns)+1), ",")
+
+	tests := []struct {
+		name        string
+		columns     string
+		wantStatus  int
+		wantCode    string
+		wantColumns []string
+	}{
+		{name: "duplicates collapsed", columns: "query,query,query", wantStatus: http.StatusOK, wantColumns: []string{"query"}},
+		{name: "order kept", columns: "user,query_id,user", wantStatus: http.StatusOK, wantColumns: []string{"user", "query_id"}},
+		{name: "over the cap", columns: overCap, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidColumns},
+		{name: "unknown column", columns: "query_id,nope", wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidColumns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "/logs?limit=2&columns="+tt.columns)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			var body struct {
+				Error string `json:"error"`
+				Data  []map[string]interface{}
+				Meta  struct {
+					Columns []string `json:"columns"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Error != tt.wantCode {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+			}
+			if tt.wantColumns == nil {
+				return
+			}
+			if !slices.Equal(body.Meta.Columns, tt.wantColumns) {
+				t.Errorf("meta.columns = %v, want %v", body.Meta.Columns, tt.wantColumns)
+			}
+			for _, row := range body.Data {
+				if len(row) != len(tt.wantColumns) {
+					t.Errorf("row has %d fields, want %d: %v", len(row), len(tt.wantColumns), row)
+				}
+			}
+		})
+	}
+}
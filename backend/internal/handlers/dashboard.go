@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+const (
+	// dashboardConcurrency bounds how many panels of one request query
+	// ClickHouse at the same time.
+	dashboardConcurrency = 4
+
+	// dashboardTopN is the number of rows in the slowest and errors panels.
+	dashboardTopN = 10
+)
+
+// GetDashboard handles POST /api/v1/dashboard
+//
+// Returns several dashboard panels for one filter in a single response. Panels
+// are queried concurrently; a panel that fails is reported in meta.errors while
+// the others are still returned. The request fails only when every panel fails.
+//
+// Query Parameters: Same filters as GetQueryLogs (except limit/offset/columns)
+//
+// Request Body:
+//
+//	{"panels": ["count", "metrics", "slowest", "errors", "scan_efficiency"]}
+//
+// Panels:
+//   - count: number of matching queries
+//   - metrics: time-bucketed metrics, as returned by /logs/metrics
+//   - slowest: the 10 slowest matching queries
+//   - errors: the 10 most frequent exception codes among failed queries
+//   - scan_efficiency: total result_rows / read_rows of the matching queries;
+//     a low ratio means queries read far more rows than they return
+//
+// All panels are returned when the body or panels list is empty.
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "count": 1234,
+//	    "metrics": [...],
+//	    "slowest": [...],
+//	    "errors": [{"key": "241", "error_name": "MEMORY_LIMIT_EXCEEDED", "total_queries": 12, ...}],
+//	    "scan_efficiency": {"total_read_rows": 98000000, "total_result_rows": 12000, "ratio": 0.000122}
+//	  },
+//	  "meta": {
+//	    "metrics": {"bucket_size": "1m", "bucket_label": "1 MINUTE", "downsampled": false},
+//	    "errors": {"slowest": "Failed to retrieve slowest queries"}
+//	  }
+//	}
+func (h *QueryLogHandler) GetDashboard(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	localTime, ok := parseLocalTime(c)
+	if !ok {
+		return
+	}
+
+	var req models.DashboardRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, models.ErrCodeInvalidBody, err.Error())
+			return
+		}
+	}
+
+	panels := req.Panels
+	if len(panels) == 0 {
+		panels = []string{"count", "metrics", "slowest", "errors", "scan_efficiency"}
+	}
+	for _, panel := range panels {
+		if !models.ValidDashboardPanels[panel] {
+			respondError(c, models.ErrCodeInvalidPanel, fmt.Sprintf("invalid panel: %q (expected count, metrics, slowest, errors or scan_efficiency)", panel))
+			return
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		data     = make(map[string]interface{}, len(panels))
+		meta     models.DashboardMeta
+		firstErr error
+	)
+
+	// Panel errors are collected instead of returned, so one failing panel
+	// doesn't cancel the others
+	var g errgroup.Group
+	g.SetLimit(dashboardConcurrency)
+	ctx := c.Request.Context()
+
+	for _, panel := range panels {
+		g.Go(func() error {
+			result, metricsMeta, err := h.dashboardPanel(ctx, panel, filter)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				if meta.Errors == nil {
+					meta.Errors = make(map[string]string)
+				}
+				meta.Errors[panel] = fmt.Sprintf("Failed to retrieve %s panel", panel)
+				return nil
+			}
+			data[panel] = result
+			if metricsMeta != nil {
+				meta.Metrics = metricsMeta
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if len(data) == 0 && firstErr != nil {
+		writeDatabaseError(c, firstErr, "Failed to retrieve dashboard")
+		return
+	}
+
+	// Localize times once all panels have finished
+	if metrics, ok := data["metrics"].([]models.QueryLogMetrics); ok {
+		for i := range metrics {
+			metrics[i].TimeBucket = metrics[i].TimeBucket.In(loc)
+		}
+	}
+	if logs, ok := data["slowest"].([]models.QueryLog); ok {
+		localizeQueryLogs(logs, loc, localTime)
+	}
+
+	respondData(c, data, meta)
+}
+
+// dashboardPanel runs the repository query behind a single dashboard panel.
+// The metrics panel also returns its bucket metadata.
+func (h *QueryLogHandler) dashboardPanel(ctx context.Context, panel string, filter models.QueryLogFilter) (interface{}, *models.MetricsMeta, error) {
+	switch panel {
+	case "count":
+		count, err := h.repo.CountQueryLogs(ctx, filter)
+		return count, nil, err
+
+	case "metrics":
+		metrics, meta, err := h.aggregatedMetrics(ctx, filter, repository.MetricsOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return metrics, &meta, nil
+
+	case "slowest":
+		filter.SortBy = "query_duration_ms"
+		filter.SortOrder = "desc"
+		filter.Limit = dashboardTopN
+		filter.Offset = 0
+		logs, err := h.repo.GetQueryLogs(ctx, filter)
+		return logs, nil, err
+
+	case "errors":
+		filter.OnlyFailed = true
+		filter.SortBy = ""
+		filter.SortOrder = ""
+		filter.Limit = dashboardTopN
+		stats, err := h.repo.GetGroupedStats(ctx, filter, models.GroupByParams{Dimension: "exception_code"})
+		return stats, nil, err
+
+	case "scan_efficiency":
+		efficiency, err := h.repo.GetScanEfficiency(ctx, filter)
+		return efficiency, nil, err
+	}
+
+	return nil, nil, fmt.Errorf("unknown panel: %q", panel)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+// writeDatabaseError writes the error response for a failed repository call,
+// mapping known failures to their error codes (see models.ErrorStatus).
+// Queries rejected by the open circuit breaker or the concurrency limit get a
+// fast 503 so clients can back off, and timeouts get 504. err is attached to
+// the context for the internal error log (see middleware.RecordErrors).
+func writeDatabaseError(c *gin.Context, err error, message string) {
+	c.Error(err)
+
+	if errors.Is(err, database.ErrCircuitOpen) {
+		respondError(c, models.ErrCodeDBUnavailable, "ClickHouse is temporarily unavailable, please retry later")
+		return
+	}
+
+	if errors.Is(err, repository.ErrQueryQueueFull) {
+		respondError(c, models.ErrCodeTooManyQueries, "Too many concurrent queries, please retry later")
+		return
+	}
+
+	if database.IsTimeout(err) {
+		respondError(c, models.ErrCodeTimeout, "The query timed out; narrow the filters or time range")
+		return
+	}
+
+	if database.IsResultTooLarge(err) {
+		respondError(c, models.ErrCodeResultTooLarge, "The result exceeds the configured ClickHouse result size limit; narrow the filters or time range")
+		return
+	}
+
+	if errors.Is(err, repository.ErrLogNotEnabled) {
+		respondError(c, models.ErrCodeLogNotEnabled, "This system log table is not enabled on the ClickHouse server")
+		return
+	}
+
+	respondError(c, models.ErrCodeDBError, message)
+}
+
+// MethodNotAllowed responds with 405 for routes that exist under a different method.
+// The router sets the Allow header before this handler runs.
+func MethodNotAllowed(c *gin.Context) {
+	respondError(c, models.ErrCodeMethodNotAllowed, fmt.Sprintf("Method %s is not allowed on %s", c.Request.Method, c.Request.URL.Path))
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// queryLogETag returns a strong ETag for a query log detail response.
+//
+// The query_log row is identified by query_id, event_time and type (the detail
+// endpoint returns the newest row, so a running query's QueryStart row is later
+// replaced by its finish row). The rendering depends on query parameters, so
+// they are folded into the tag as well.
+func queryLogETag(c *gin.Context, log *models.QueryLog) string {
+	h := sha256.New()
+	parts := []string{
+		log.QueryID,
+		strconv.FormatInt(log.EventTime.UnixNano(), 10),
+		log.Type,
+		c.Request.URL.RawQuery,
+	}
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// finishedQueryMaxAge is how long clients may reuse the detail of a finished
+// query without revalidating.
+const finishedQueryMaxAge = 24 * time.Hour
+
+// queryLogCacheControl returns the Cache-Control value for a query log detail
+// response. Rows of finished queries (QueryFinish and Exception*) are final and
+// cached as immutable; a QueryStart row is replaced once the query ends, so it
+// must be revalidated on every use. Responses depend on the caller's API key
+// and AllowedDatabases, so shared caches must not store them.
+func queryLogCacheControl(log *models.QueryLog) string {
+	if log.Type == "QueryFinish" || strings.HasPrefix(log.Type, "Exception") {
+		return fmt.Sprintf("private, max-age=%d, immutable", int(finishedQueryMaxAge.Seconds()))
+	}
+	return "private, no-cache"
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// A weak validator in the header matches the same strong tag, per RFC 9110.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
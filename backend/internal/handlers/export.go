@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// exportWriter writes exported rows in a specific file format.
+type exportWriter interface {
+	// WriteHeader writes the header row.
+	WriteHeader(columns []string) error
+
+	// WriteRow writes the values of row in the order of columns.
+	WriteRow(columns []string, row map[string]interface{}) error
+
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+const (
+	// exportFlushRows is how often buffered export rows are flushed to the client.
+	exportFlushRows = 1000
+
+	// exportProgressRows is how often export progress is logged.
+	exportProgressRows = 10000
+
+	// exportRetryAfterSeconds is the Retry-After sent when the export limit is reached.
+	exportRetryAfterSeconds = 10
+)
+
+// exportFormat describes a supported export file format.
+type exportFormat struct {
+	ContentType string
+	Extension   string
+	NewWriter   func(w io.Writer) exportWriter
+}
+
+// exportFormats maps the format query parameter to its export format.
+var exportFormats = map[string]exportFormat{
+	"csv": {
+		ContentType: "text/csv",
+		Extension:   "csv",
+		NewWriter:   func(w io.Writer) exportWriter { return &csvExportWriter{w: csv.NewWriter(w)} },
+	},
+	"tsv": {
+		ContentType: "text/tab-separated-values",
+		Extension:   "tsv",
+		NewWriter:   func(w io.Writer) exportWriter { return &tsvExportWriter{w: bufio.NewWriter(w)} },
+	},
+}
+
+// metricsExportColumns is the header of a metrics export, matching the JSON
+// field names of QueryLogMetrics.
+var metricsExportColumns = []string{
+	"time_bucket",
+	"total_queries",
+	"avg_duration_ms",
+	"max_duration_ms",
+	"avg_memory_usage",
+	"max_memory_usage",
+	"max_peak_memory_usage",
+	"total_read_bytes",
+	"total_written_bytes",
+	"failed_queries",
+	"error_rate",
+	"queries_per_second",
+}
+
+// metricsExportRow converts a metrics bucket to an export row keyed by
+// metricsExportColumns.
+func metricsExportRow(m models.QueryLogMetrics) map[string]interface{} {
+	return map[string]interface{}{
+		"time_bucket":           m.TimeBucket,
+		"total_queries":         m.TotalQueries,
+		"avg_duration_ms":       m.AvgDurationMs,
+		"max_duration_ms":       m.MaxDurationMs,
+		"avg_memory_usage":      m.AvgMemoryUsage,
+		"max_memory_usage":      m.MaxMemoryUsage,
+		"max_peak_memory_usage": m.MaxPeakMemoryUsage,
+		"total_read_bytes":      m.TotalReadBytes,
+		"total_written_bytes":   m.TotalWrittenBytes,
+		"failed_queries":        m.FailedQueries,
+		"error_rate":            m.ErrorRate,
+		"queries_per_second":    m.QueriesPerSecond,
+	}
+}
+
+// parseExportHeaders parses the comma-separated headers parameter, which renames
+// the header row of an export without changing the selected columns. It returns
+// columns unchanged when value is empty; otherwise there must be exactly one
+// non-empty name per column.
+func parseExportHeaders(value string, columns []string) ([]string, error) {
+	if value == "" {
+		return columns, nil
+	}
+
+	headers := strings.Split(value, ",")
+	if len(headers) != len(columns) {
+		return nil, fmt.Errorf("headers has %d names but columns has %d (after removing duplicates); they must match one to one", len(headers), len(columns))
+	}
+	for i, header := range headers {
+		headers[i] = strings.TrimSpace(header)
+		if headers[i] == "" {
+			return nil, fmt.Errorf("header for column %s is empty", columns[i])
+		}
+	}
+	return headers, nil
+}
+
+// csvExportWriter writes RFC 4180 CSV using formatCSVValue.
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) WriteHeader(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvExportWriter) WriteRow(columns []string, row map[string]interface{}) error {
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = formatCSVValue(row[col])
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// tsvExportWriter writes ClickHouse TabSeparatedWithNames output, so exported data
+// can be re-imported with INSERT ... FORMAT TabSeparatedWithNames.
+//
+// csv.Writer is not used here because it wraps fields containing quotes in
+// double quotes, which ClickHouse's TSV parser would read literally.
+type tsvExportWriter struct {
+	w *bufio.Writer
+}
+
+func (e *tsvExportWriter) WriteHeader(columns []string) error {
+	escaped := make([]string, len(columns))
+	for i, col := range columns {
+		escaped[i] = escapeTSV(col)
+	}
+	return e.writeLine(escaped)
+}
+
+func (e *tsvExportWriter) WriteRow(columns []string, row map[string]interface{}) error {
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = formatTSVValue(row[col])
+	}
+	return e.writeLine(record)
+}
+
+func (e *tsvExportWriter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *tsvExportWriter) writeLine(fields []string) error {
+	if _, err := e.w.WriteString(strings.Join(fields, "\t")); err != nil {
+		return err
+	}
+	return e.w.WriteByte('\n')
+}
+
+// tsvEscaper applies ClickHouse TabSeparated escaping to string values.
+var tsvEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\x00", "\\0",
+)
+
+// escapeTSV escapes a string for use as a ClickHouse TabSeparated field.
+func escapeTSV(s string) string {
+	return tsvEscaper.Replace(s)
+}
+
+// formatTSVValue converts a value to its ClickHouse TabSeparated representation.
+// Times use ClickHouse's DateTime text format and arrays use array literal syntax.
+func formatTSVValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "\\N"
+	case string:
+		return escapeTSV(val)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	case []string:
+		quoted := make([]string, len(val))
+		for i, s := range val {
+			quoted[i] = "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(s) + "'"
+		}
+		return escapeTSV("[" + strings.Join(quoted, ",") + "]")
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case models.EnumValue:
+		// Export the raw value so it can be inserted back into the numeric column
+		return strconv.FormatInt(val.Raw, 10)
+	default:
+		return escapeTSV(fmt.Sprintf("%v", val))
+	}
+}
+
+// flushExport flushes the export writer and, for streaming sinks, the sink
+// itself so the client receives the rows written so far.
+func flushExport(sink ExportSink, w exportWriter) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := sink.Writer().(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/middleware"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// exportPath is the route that signed export URLs point to.
+const exportPath = "/api/v1/logs/export"
+
+// ExportSignHandler issues signed, expiring export download URLs.
+type ExportSignHandler struct {
+	cfg config.ExportConfig
+}
+
+// NewExportSignHandler creates a new ExportSignHandler instance.
+func NewExportSignHandler(cfg config.ExportConfig) *ExportSignHandler {
+	return &ExportSignHandler{cfg: cfg}
+}
+
+// SignExport handles POST /api/v1/logs/export/sign
+//
+// Returns a URL for GET /api/v1/logs/export that can be opened directly by the
+// browser without the X-API-Key header until it expires. The request's query
+// parameters (filters, columns, format, ...) are copied into the signed URL and
+// cannot be changed without invalidating the signature.
+//
+// Requires the X-API-Key header. Disabled unless EXPORT_SIGNING_SECRET is set.
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "url": "/api/v1/logs/export?expires=1705923000&format=csv&signature=...",
+//	    "expires_at": "2024-01-22T11:30:00Z"
+//	  }
+//	}
+func (h *ExportSignHandler) SignExport(c *gin.Context) {
+	if h.cfg.SigningSecret == "" {
+		respondError(c, models.ErrCodeForbidden, "Signed export URLs are disabled (EXPORT_SIGNING_SECRET is not set)")
+		return
+	}
+
+	expires := time.Now().Add(h.cfg.URLTTL).UTC().Truncate(time.Second)
+	query := middleware.SignQuery(h.cfg.SigningSecret, exportPath, c.Request.URL.Query(), expires)
+
+	respondData(c, gin.H{
+		"url":        exportPath + "?" + query.Encode(),
+		"expires_at": expires,
+	}, nil)
+}
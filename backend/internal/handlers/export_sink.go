@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
+)
+
+// ExportSink is the destination an export is written to.
+type ExportSink interface {
+	// Writer returns the writer the formatted export is written to. If it
+	// implements http.Flusher, it is flushed along with the export writer.
+	Writer() io.Writer
+
+	// Finalize completes the export after all rows are written. A non-nil err
+	// means the export failed and the sink discards anything written so far.
+	Finalize(ctx context.Context, err error) error
+}
+
+// exportDestinations lists the accepted values of the export destination parameter.
+var exportDestinations = map[string]bool{
+	"http": true,
+	"s3":   true,
+}
+
+// exportDestination reads the destination parameter shared by the export
+// endpoints: "http" (default) or "s3", which needs EXPORT_S3_BUCKET. On failure
+// it writes the error response and returns ok=false.
+func (h *QueryLogHandler) exportDestination(c *gin.Context) (string, bool) {
+	destination := c.DefaultQuery("destination", "http")
+	if !exportDestinations[destination] {
+		respondError(c, models.ErrCodeInvalidDestination, fmt.Sprintf("invalid destination: %q (expected http or s3)", destination))
+		return "", false
+	}
+	if destination == "s3" && h.exportStore == nil {
+		respondError(c, models.ErrCodeInvalidDestination, "s3 destination is not configured (set EXPORT_S3_BUCKET)")
+		return "", false
+	}
+	return destination, true
+}
+
+// newExportSink creates the sink for a destination returned by
+// exportDestination. On failure it writes the error response and returns
+// ok=false.
+func (h *QueryLogHandler) newExportSink(c *gin.Context, destination, filename, contentType string) (ExportSink, bool) {
+	if destination != "s3" {
+		return &httpExportSink{c: c, contentType: contentType, filename: filename}, true
+	}
+	sink, err := newS3ExportSink(h.exportStore, filename, contentType)
+	if err != nil {
+		c.Error(err)
+		respondError(c, models.ErrCodeExportError, err.Error())
+		return nil, false
+	}
+	return sink, true
+}
+
+// completeExport finalizes an export whose rows were all written. An s3
+// export is uploaded and answered with its models.ExportResult; an http
+// download is already complete. It writes an error response and returns
+// false if the upload fails.
+func completeExport(c *gin.Context, sink ExportSink, filename string, rows int) bool {
+	if err := sink.Finalize(c.Request.Context(), nil); err != nil {
+		log.Printf("export upload failed: file=%s rows=%d error=%v", filename, rows, err)
+		c.Error(err)
+		respondError(c, models.ErrCodeExportUploadFailed, "Failed to upload export")
+		return false
+	}
+	if s3Sink, ok := sink.(*s3ExportSink); ok {
+		respondData(c, models.ExportResult{
+			Destination: "s3",
+			Location:    s3Sink.Location(),
+			Rows:        rows,
+		}, nil)
+	}
+	return true
+}
+
+// httpExportSink streams the export as the HTTP response body (the default).
+// Download headers are set lazily on the first write so that errors raised
+// before anything is written still get a JSON error response.
+type httpExportSink struct {
+	c           *gin.Context
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (s *httpExportSink) Writer() io.Writer {
+	return s
+}
+
+func (s *httpExportSink) Write(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.c.Header("Content-Type", s.contentType)
+		s.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", s.filename))
+	}
+	return s.c.Writer.Write(p)
+}
+
+func (s *httpExportSink) Flush() {
+	s.c.Writer.Flush()
+}
+
+func (s *httpExportSink) Finalize(ctx context.Context, err error) error {
+	if err == nil {
+		s.Flush()
+	}
+	return nil
+}
+
+// s3ExportSink spools the export to a temporary file and uploads it to object
+// storage in Finalize, since a single PutObject needs the full content length.
+type s3ExportSink struct {
+	store       *objectstore.S3
+	file        *os.File
+	name        string
+	contentType string
+}
+
+// newS3ExportSink creates the temporary file backing an S3 export.
+func newS3ExportSink(store *objectstore.S3, name, contentType string) (*s3ExportSink, error) {
+	file, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export spool file: %w", err)
+	}
+	return &s3ExportSink{store: store, file: file, name: name, contentType: contentType}, nil
+}
+
+func (s *s3ExportSink) Writer() io.Writer {
+	return s.file
+}
+
+func (s *s3ExportSink) Finalize(ctx context.Context, err error) error {
+	defer os.Remove(s.file.Name())
+	defer s.file.Close()
+	if err != nil {
+		return nil
+	}
+
+	size, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.store.PutObject(ctx, s.name, s.file, size, s.contentType)
+}
+
+// Location returns the s3:// URI the export is uploaded to.
+func (s *s3ExportSink) Location() string {
+	return s.store.URI(s.name)
+}
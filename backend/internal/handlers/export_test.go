@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
+)
+
+// TestExportColumnAlignment checks that every exported cell sits under the
+// header of the column it came from, including array and time columns placed
+// between scalar ones.
+func TestExportColumnAlignment(t *testing.T) {
+	now := time.Now()
+	router, h := newDemoRouter(now)
+
+	start := now.Add(-6 * time.Hour).UTC()
+
+	tests := []struct {
+		name    string
+		columns []string
+	}{
+		{name: "array first", columns: []string{"tables", "query_id", "event_time", "read_rows"}},
+		{name: "time and arrays interleaved", columns: []string{"event_time", "databases", "query_id", "tables", "event_date"}},
+		{name: "derived and enum", columns: []string{"tables_count", "query_id", "interface", "error_name", "query_duration_s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reference rows straight from the store, keyed by query_id
+			filter := models.QueryLogFilter{StartTime: &start, Limit: 1000}
+			reference, err := h.repo.GetQueryLogsDynamic(context.Background(), filter, append([]string{"query_id"}, tt.columns...))
+			if err != nil {
+				t.Fatalf("reference rows: %v", err)
+			}
+			byID := make(map[string]map[string]interface{}, len(reference))
+			for _, row := range reference {
+				byID[row["query_id"].(string)] = row
+			}
+
+			query := url.Values{
+				"columns":    {strings.Join(tt.columns, ",")},
+				"start_time": {start.Format(time.RFC3339)},
+				"limit":      {"200"},
+			}
+			w := serve(router, "/export?"+query.Encode())
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+
+			records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+			if err != nil {
+				t.Fatalf("parse CSV: %v", err)
+			}
+			if len(records) < 2 {
+				t.Fatalf("export has %d records, want a header and rows", len(records))
+			}
+			if !slices.Equal(records[0], tt.columns) {
+				t.Fatalf("header = %v, want %v", records[0], tt.columns)
+			}
+
+			idIndex := slices.Index(tt.columns, "query_id")
+			for _, record := range records[1:] {
+				if len(record) != len(tt.columns) {
+					t.Fatalf("record has %d fields, want %d: %v", len(record), len(tt.columns), record)
+				}
+				want, ok := byID[record[idIndex]]
+				if !ok {
+					t.Fatalf("query_id cell %q is not a query_id", record[idIndex])
+				}
+				for i, col := range tt.columns {
+					assertCell(t, col, record[i], want[col])
+				}
+			}
+		})
+	}
+}
+
+// assertCell compares an exported CSV cell with the value it should hold.
+// Times are compared as instants since the export renders them in tz.
+func assertCell(t *testing.T, col, cell string, want interface{}) {
+	t.Helper()
+	if ts, ok := want.(time.Time); ok {
+		got, err := time.Parse(time.RFC3339, cell)
+		if err != nil || !got.Equal(ts) {
+			t.Errorf("%s = %q, want %s", col, cell, ts.Format(time.RFC3339))
+		}
+		return
+	}
+	if expected := formatCSVValue(want); cell != expected {
+		t.Errorf("%s = %q, want %q", col, cell, expected)
+	}
+}
+
+func TestExportMetricsDestination(t *testing.T) {
+	var uploaded struct {
+		path, contentType, body string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		uploaded.path, uploaded.contentType, uploaded.body = r.URL.Path, r.Header.Get("Content-Type"), string(body)
+	}))
+	defer server.Close()
+	store, err := objectstore.NewS3(objectstore.S3Options{Bucket: "exports", Prefix: "metrics/", Endpoint: server.URL, AccessKeyID: "key", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		store       *objectstore.S3
+		wantStatus  int
+		wantCode    string
+		wantUpload  bool
+		wantContent string
+	}{
+		{name: "http by default", query: "format=tsv", wantStatus: http.StatusOK, wantContent: "text/tab-separated-values"},
+		{name: "unknown destination", query: "destination=ftp", wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidDestination},
+		{name: "s3 not configured", query: "destination=s3", wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidDestination},
+		{name: "s3", query: "destination=s3", store: store, wantStatus: http.StatusOK, wantUpload: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, h := newDemoRouter(time.Now())
+			h.exportStore = tt.store
+			uploaded.path = ""
+
+			w := serve(router, "/metrics/export?"+tt.query)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				if body := decodeError(t, w); body.Error != tt.wantCode {
+					t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+				}
+				return
+			}
+			if !tt.wantUpload {
+				if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContent) {
+					t.Errorf("Content-Type = %q, want %s", got, tt.wantContent)
+				}
+				return
+			}
+
+			var body struct {
+				Data models.ExportResult `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Data.Destination != "s3" || !strings.HasPrefix(body.Data.Location, "s3://exports/metrics/query_metrics_") || body.Data.Rows == 0 {
+				t.Errorf("result = %+v, want an s3 location under the prefix and rows", body.Data)
+			}
+			if !strings.HasPrefix(uploaded.path, "/exports/metrics/query_metrics_") || uploaded.contentType != "text/csv" {
+				t.Errorf("uploaded %s as %q", uploaded.path, uploaded.contentType)
+			}
+			if lines := strings.Count(uploaded.body, "\n"); lines != body.Data.Rows+1 || !strings.HasPrefix(uploaded.body, "time_bucket,") {
+				t.Errorf("uploaded %d lines for %d rows:\n%s", lines, body.Data.Rows, uploaded.body)
+			}
+		})
+	}
+}
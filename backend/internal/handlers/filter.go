@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// timeLayouts are the accepted formats for the start_time/end_time/after parameters,
+// tried in order. Layouts without a UTC offset are interpreted in the requested time zone.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// bindFilter parses the request's query parameters into a QueryLogFilter and
+// resolves the requested time zone.
+// On invalid input it writes a 400 response and returns ok=false.
+func bindFilter(c *gin.Context) (filter models.QueryLogFilter, loc *time.Location, ok bool) {
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return filter, nil, false
+	}
+
+	loc, err := loadLocation(filter.TZ)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidTimezone, err.Error())
+		return filter, nil, false
+	}
+
+	if filter.StartTime, err = parseTimeParam(c.Query("start_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid start_time: %v", err))
+		return filter, nil, false
+	}
+
+	if filter.EndTime, err = parseTimeParam(c.Query("end_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid end_time: %v", err))
+		return filter, nil, false
+	}
+
+	if filter.Around, err = parseTimeParam(c.Query("around"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid around: %v", err))
+		return filter, nil, false
+	}
+
+	if err := applyAroundWindow(&filter); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return filter, nil, false
+	}
+
+	if err := applyDateRange(&filter, loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return filter, nil, false
+	}
+
+	if filter.After, err = parseTimeParam(c.Query("after"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid after: %v", err))
+		return filter, nil, false
+	}
+
+	if filter.ExceptionCodes, err = parseExceptionCodes(c.Query("exception_codes")); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return filter, nil, false
+	}
+
+	if c.Query("sample") != "" && (filter.Sample <= 0 || filter.Sample > 1) {
+		respondError(c, models.ErrCodeInvalidParams, "sample must be greater than 0 and at most 1")
+		return filter, nil, false
+	}
+
+	if filter.MinMemoryPerRow < 0 {
+		respondError(c, models.ErrCodeInvalidParams, "min_memory_per_row must not be negative")
+		return filter, nil, false
+	}
+
+	if filter.CacheUsage != "" && !models.ValidCacheUsage[filter.CacheUsage] {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid cache_usage: %q (expected Read, Write, None or Unknown)", filter.CacheUsage))
+		return filter, nil, false
+	}
+
+	if filter.Type != "" {
+		if !models.ValidQueryTypes[filter.Type] {
+			respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid type: %q (expected QueryFinish, ExceptionBeforeStart or ExceptionWhileProcessing)", filter.Type))
+			return filter, nil, false
+		}
+		if err := checkTypeConflicts(filter); err != nil {
+			respondError(c, models.ErrCodeConflictingFilters, err.Error())
+			return filter, nil, false
+		}
+	}
+
+	return filter, loc, true
+}
+
+// applyAroundWindow narrows StartTime/EndTime to the window-long range centered
+// on around. Like applyDateRange, the narrower bound wins when start_time or
+// end_time is also given. around and window must be given together.
+func applyAroundWindow(filter *models.QueryLogFilter) error {
+	if filter.Around == nil && filter.Window == "" {
+		return nil
+	}
+	if filter.Around == nil || filter.Window == "" {
+		return fmt.Errorf("around and window must be given together")
+	}
+
+	window, err := time.ParseDuration(filter.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid window: %q (expected a positive duration such as 10m)", filter.Window)
+	}
+
+	start := filter.Around.Add(-window / 2)
+	end := filter.Around.Add(window / 2)
+	if filter.StartTime == nil || filter.StartTime.Before(start) {
+		filter.StartTime = &start
+	}
+	if filter.EndTime == nil || filter.EndTime.After(end) {
+		filter.EndTime = &end
+	}
+	return nil
+}
+
+// applyDateRange narrows StartTime/EndTime to the local calendar days given by
+// start_date and end_date. A day runs from midnight in loc to the last second
+// before the next midnight (event_time has second precision), which also
+// handles days shortened or lengthened by DST. When start_time/end_time are
+// also given, the narrower bound wins.
+func applyDateRange(filter *models.QueryLogFilter, loc *time.Location) error {
+	var startDay, endDay time.Time
+	if filter.StartDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", filter.StartDate, loc)
+		if err != nil {
+			return fmt.Errorf("invalid start_date: %q (expected YYYY-MM-DD)", filter.StartDate)
+		}
+		startDay = day
+		if filter.StartTime == nil || filter.StartTime.Before(day) {
+			filter.StartTime = &day
+		}
+	}
+	if filter.EndDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", filter.EndDate, loc)
+		if err != nil {
+			return fmt.Errorf("invalid end_date: %q (expected YYYY-MM-DD)", filter.EndDate)
+		}
+		endDay = day
+		end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc).Add(-time.Second)
+		if filter.EndTime == nil || filter.EndTime.After(end) {
+			filter.EndTime = &end
+		}
+	}
+	if !startDay.IsZero() && !endDay.IsZero() && endDay.Before(startDay) {
+		return fmt.Errorf("end_date %s is before start_date %s", filter.EndDate, filter.StartDate)
+	}
+	return nil
+}
+
+// checkTypeConflicts rejects a type filter that can never match together with
+// the coarse only_success, only_failed or has_exception filters.
+func checkTypeConflicts(filter models.QueryLogFilter) error {
+	if filter.OnlySuccess && filter.Type != "QueryFinish" {
+		return fmt.Errorf("type=%s conflicts with only_success", filter.Type)
+	}
+	if filter.Type == "QueryFinish" {
+		if filter.OnlyFailed {
+			return fmt.Errorf("type=%s conflicts with only_failed", filter.Type)
+		}
+		if filter.HasException {
+			return fmt.Errorf("type=%s conflicts with has_exception", filter.Type)
+		}
+	}
+	return nil
+}
+
+// parseExceptionCodes parses a comma-separated list of exception codes.
+// Returns nil when the value is empty.
+func parseExceptionCodes(value string) ([]int32, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var codes []int32
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exception code: %q", part)
+		}
+		codes = append(codes, int32(code))
+	}
+
+	return codes, nil
+}
+
+// loadLocation resolves an IANA time zone name, defaulting to UTC when empty.
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz: %q", tz)
+	}
+	return loc, nil
+}
+
+// parseTimeParam parses a time filter value using timeLayouts.
+// Returns nil when the value is empty.
+func parseTimeParam(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q is not an RFC3339 timestamp or YYYY-MM-DD date", value)
+}
+
+// parseLocalTime parses the local_time parameter, writing a 400 response if it
+// is invalid. With local_time=true, responses keep event_time in UTC and add
+// event_time_local rendered in tz, instead of converting event_time in place.
+func parseLocalTime(c *gin.Context) (bool, bool) {
+	return parseBoolParam(c, "local_time")
+}
+
+// localizeQueryLogs converts the time fields of each log entry to loc.
+// EventDate is re-derived from the localized EventTime, since the calendar
+// date of a query depends on the viewer's time zone. With localTime, EventTime
+// and EventDate are kept in UTC and EventTimeLocal is set instead.
+func localizeQueryLogs(logs []models.QueryLog, loc *time.Location, localTime bool) {
+	for i := range logs {
+		localizeQueryLog(&logs[i], loc, localTime)
+	}
+}
+
+// localizeQueryLog converts the time fields of a single log entry (see localizeQueryLogs).
+func localizeQueryLog(log *models.QueryLog, loc *time.Location, localTime bool) {
+	if !localTime {
+		log.EventTime = log.EventTime.In(loc)
+		log.EventDate = startOfDay(log.EventTime)
+		return
+	}
+	local := log.EventTime.In(loc)
+	log.EventTime = log.EventTime.UTC()
+	log.EventDate = startOfDay(log.EventTime)
+	log.EventTimeLocal = &local
+}
+
+// localizeRows converts the time values in dynamic result rows to loc.
+// When event_time is not selected, event_date keeps its calendar date.
+// With localTime, event_time and event_date are kept in UTC and rows that
+// have event_time get an event_time_local value instead.
+func localizeRows(rows []map[string]interface{}, loc *time.Location, localTime bool) {
+	for _, row := range rows {
+		if !localTime {
+			localizeRow(row, loc)
+			continue
+		}
+		if t, ok := row["event_time"].(time.Time); ok {
+			row["event_time"] = t.UTC()
+			row["event_time_local"] = t.In(loc)
+			if _, ok := row["event_date"]; ok {
+				row["event_date"] = startOfDay(t.UTC())
+			}
+		}
+	}
+}
+
+// localTimeColumns returns the response columns for a dynamic query: columns,
+// plus event_time_local after event_time when local times were requested.
+func localTimeColumns(columns []string, localTime bool) []string {
+	i := slices.Index(columns, "event_time")
+	if !localTime || i < 0 {
+		return columns
+	}
+	return slices.Insert(slices.Clone(columns), i+1, "event_time_local")
+}
+
+// localizeRow converts the time columns of a single dynamic row to loc.
+func localizeRow(row map[string]interface{}, loc *time.Location) {
+	if t, ok := row["event_time"].(time.Time); ok {
+		row["event_time"] = t.In(loc)
+		if _, ok := row["event_date"]; ok {
+			row["event_date"] = startOfDay(t.In(loc))
+		}
+	} else if d, ok := row["event_date"].(time.Time); ok {
+		y, m, day := d.Date()
+		row["event_date"] = time.Date(y, m, day, 0, 0, 0, 0, loc)
+	}
+}
+
+// startOfDay returns midnight of t's calendar day in t's location.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// parsedFilterParams maps the QueryLogFilter fields that bindFilter parses
+// itself (form:"-") to their query parameter names.
+var parsedFilterParams = map[string]string{
+	"ExceptionCodes": "exception_codes",
+	"StartTime":      "start_time",
+	"EndTime":        "end_time",
+	"After":          "after",
+	"Around":         "around",
+}
+
+// filterDescriptions lists every QueryLogFilter parameter in field order. It
+// is built once, since the filter struct and documentation are static.
+var filterDescriptions = describeFilters()
+
+// GetFilters handles GET /api/v1/filters
+//
+// Describes the query parameters accepted by the query log endpoints: name,
+// type, the SQL condition it produces, and an example. Names and types are
+// derived from QueryLogFilter and the rest from models.FilterDocs.
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "name": "min_duration_ms",
+//	      "type": "integer",
+//	      "operator": "query_duration_ms >= ?",
+//	      "description": "Queries that took at least this many milliseconds (inclusive)",
+//	      "example": "1000"
+//	    },
+//	    ...
+//	  ]
+//	}
+func GetFilters(c *gin.Context) {
+	respondData(c, filterDescriptions, nil)
+}
+
+// describeFilters reflects over QueryLogFilter to build the filter descriptions.
+func describeFilters() []models.FilterDescription {
+	t := reflect.TypeOf(models.QueryLogFilter{})
+	descriptions := make([]models.FilterDescription, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("form")
+		if name == "-" {
+			name = parsedFilterParams[field.Name]
+		}
+		if name == "" {
+			continue
+		}
+
+		doc := models.FilterDocs[name]
+		descriptions = append(descriptions, models.FilterDescription{
+			Name:        name,
+			Type:        filterType(name, field.Type),
+			Operator:    doc.Operator,
+			Description: doc.Description,
+			Example:     doc.Example,
+			Values:      filterValues(name),
+		})
+	}
+	return descriptions
+}
+
+// filterType names the value type of a filter field.
+func filterType(name string, t reflect.Type) string {
+	// Bound as strings and parsed by applyDateRange
+	if name == "start_date" || name == "end_date" {
+		return "date"
+	}
+	// Bound as a string and parsed by applyAroundWindow
+	if name == "window" {
+		return "duration"
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "timestamp"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "integer_list"
+	default:
+		return "string"
+	}
+}
+
+// filterValues returns the accepted values of parameters with a fixed set.
+func filterValues(name string) []string {
+	switch name {
+	case "type":
+		return sortedKeys(models.ValidQueryTypes)
+	case "cache_usage":
+		return sortedKeys(models.ValidCacheUsage)
+	case "sort_by":
+		return sortedKeys(models.ValidSortColumns)
+	case "sort_order":
+		return []string{"asc", "desc"}
+	case "columns":
+		return sortedKeys(models.ValidColumns)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
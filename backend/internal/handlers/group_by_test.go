@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestGroupedStatsParams(t *testing.T) {
+	router, _ := newDemoRouter(time.Now())
+
+	tests := []struct {
+		name         string
+		query        url.Values
+		wantStatus   int
+		wantCode     string
+		wantMaxRows  int
+		wantAscBy    string
+		wantWarnings []string
+	}{
+		{name: "missing dimension", query: url.Values{}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidDimension},
+		{name: "unknown dimension", query: url.Values{"dimension": {"query"}}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidDimension},
+		{name: "injected dimension", query: url.Values{"dimension": {"user) AS group_key FROM system.users --"}}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidDimension},
+		{name: "unknown sort_by", query: url.Values{"dimension": {"user"}, "sort_by": {"event_time"}}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidSort},
+		{name: "injected sort_by", query: url.Values{"dimension": {"user"}, "sort_by": {"total_queries; DROP TABLE t"}}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidSort},
+		{name: "bad sort_order", query: url.Values{"dimension": {"user"}, "sort_order": {"sideways"}}, wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidSort},
+		{name: "sort ascending", query: url.Values{"dimension": {"user"}, "sort_by": {"total_queries"}, "sort_order": {"asc"}}, wantStatus: http.StatusOK, wantAscBy: "total_queries"},
+		{name: "limit", query: url.Values{"dimension": {"client_hostname"}, "limit": {"2"}}, wantStatus: http.StatusOK, wantMaxRows: 2},
+		{name: "limit clamped", query: url.Values{"dimension": {"user"}, "limit": {"5000"}}, wantStatus: http.StatusOK, wantWarnings: []string{"limit clamped from 5000 to 1000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "/group-by?"+tt.query.Encode())
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				if body := decodeError(t, w); body.Error != tt.wantCode {
+					t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+				}
+				return
+			}
+
+			var body struct {
+				Data     []map[string]interface{} `json:"data"`
+				Warnings []string                 `json:"warnings"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(body.Data) == 0 {
+				t.Fatal("no groups returned")
+			}
+			if tt.wantMaxRows > 0 && len(body.Data) > tt.wantMaxRows {
+				t.Errorf("%d groups, want at most %d", len(body.Data), tt.wantMaxRows)
+			}
+			if tt.wantAscBy != "" {
+				for i := 1; i < len(body.Data); i++ {
+					if body.Data[i][tt.wantAscBy].(float64) < body.Data[i-1][tt.wantAscBy].(float64) {
+						t.Errorf("groups not sorted by %s asc at %d: %v", tt.wantAscBy, i, body.Data)
+						break
+					}
+				}
+			}
+			if !slices.Equal(body.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", body.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestGroupedStatsErrorRate(t *testing.T) {
+	router, _ := newDemoRouter(time.Now())
+
+	tests := []struct {
+		name   string
+		target string
+		sorted bool
+	}{
+		{name: "by user", target: "/group-by?dimension=user"},
+		{name: "by exception code", target: "/group-by?dimension=exception_code"},
+		{name: "sorted by error rate", target: "/group-by?dimension=client_hostname&sort_by=error_rate&sort_order=desc", sorted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+
+			var body struct {
+				Data []map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(body.Data) == 0 {
+				t.Fatal("no groups returned")
+			}
+
+			previous := math.Inf(1)
+			for _, group := range body.Data {
+				rate, ok := group["error_rate"].(float64)
+				if !ok {
+					t.Fatalf("group %v has no numeric error_rate", group)
+				}
+				want := group["failed_queries"].(float64) / group["total_queries"].(float64)
+				if math.Abs(rate-want) > 1e-9 {
+					t.Errorf("group %v: error_rate = %v, want %v", group["key"], rate, want)
+				}
+				if tt.sorted {
+					if rate > previous {
+						t.Errorf("groups not sorted by error_rate desc: %v after %v", rate, previous)
+					}
+					previous = rate
+				}
+			}
+		})
+	}
+}
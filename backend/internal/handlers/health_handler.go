@@ -1,47 +1,98 @@
 package handlers
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
 )
 
+// HealthChecker is the database dependency checked by the readiness endpoint
+// and reported on by GET /metrics. It is implemented by *database.ClickHouseDB,
+// and by the demo repository in DEMO_MODE.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+	BreakerState() string
+
+	// WriteMetrics writes the circuit breaker metrics in the Prometheus text
+	// exposition format
+	WriteMetrics(w io.Writer) error
+
+	// LastPing returns when the database last answered a ping, or the zero
+	// time if it never has
+	LastPing() time.Time
+}
+
 // HealthHandler handles health check endpoints.
 type HealthHandler struct {
-	db *database.ClickHouseDB
+	db HealthChecker
 }
 
 // NewHealthHandler creates a new HealthHandler instance.
-func NewHealthHandler(db *database.ClickHouseDB) *HealthHandler {
+func NewHealthHandler(db HealthChecker) *HealthHandler {
 	return &HealthHandler{db: db}
 }
 
 // Health handles GET /health
 // Returns basic health status without checking dependencies.
 func (h *HealthHandler) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	render(c, http.StatusOK, gin.H{
 		"status": "ok",
 	})
 }
 
 // Ready handles GET /ready
-// Performs a comprehensive health check including database connectivity.
+// Performs a comprehensive health check including database connectivity
+// and reports the state of the ClickHouse circuit breaker. checks.last_ping is
+// when ClickHouse last answered a ping, from this probe or the background
+// keepalive loop, so a failing probe shows how long the outage has lasted.
 func (h *HealthHandler) Ready(c *gin.Context) {
+	breakerState := h.db.BreakerState()
+
 	if err := h.db.HealthCheck(c.Request.Context()); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+		render(c, errorStatus(models.ErrCodeDBUnavailable), gin.H{
 			"status":  "unhealthy",
-			"error":   "database_unavailable",
+			"error":   models.ErrCodeDBUnavailable,
 			"message": err.Error(),
+			"checks": h.checks(gin.H{
+				"circuit_breaker": breakerState,
+			}),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	// The database answered our probe, but queries are still being short-circuited
+	if breakerState == "open" {
+		render(c, errorStatus(models.ErrCodeCircuitOpen), gin.H{
+			"status":  "unhealthy",
+			"error":   models.ErrCodeCircuitOpen,
+			"message": "ClickHouse circuit breaker is open",
+			"checks": h.checks(gin.H{
+				"database":        "ok",
+				"circuit_breaker": breakerState,
+			}),
+		})
+		return
+	}
+
+	render(c, http.StatusOK, gin.H{
 		"status": "ready",
-		"checks": gin.H{
-			"database": "ok",
-		},
+		"checks": h.checks(gin.H{
+			"database":        "ok",
+			"circuit_breaker": breakerState,
+		}),
 	})
 }
+
+// checks adds the last successful ping time to the readiness checks, when
+// there has been one.
+func (h *HealthHandler) checks(checks gin.H) gin.H {
+	if lastPing := h.db.LastPing(); !lastPing.IsZero() {
+		checks["last_ping"] = lastPing.UTC()
+	}
+	return checks
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/middleware"
+)
+
+// MetricsHandler serves the Prometheus metrics endpoint.
+type MetricsHandler struct {
+	db     HealthChecker
+	quotas *middleware.Quotas
+}
+
+// NewMetricsHandler creates a new MetricsHandler instance.
+func NewMetricsHandler(db HealthChecker, quotas *middleware.Quotas) *MetricsHandler {
+	return &MetricsHandler{db: db, quotas: quotas}
+}
+
+// Metrics handles GET /metrics
+//
+// Returns the ClickHouse circuit breaker state and counters, and the
+// API_KEY_QUOTAS counters labelled by masked key, in the Prometheus text
+// exposition format:
+//
+//	clickhouse_circuit_breaker_state 0
+//	clickhouse_circuit_breaker_transitions_total{from="closed",to="open"} 2
+//	clickhouse_circuit_breaker_rejected_total 41
+//	clickhouse_monitoring_quota_limit{key="****a1b2"} 10000
+//	clickhouse_monitoring_quota_used{key="****a1b2"} 9850
+//	clickhouse_monitoring_quota_remaining{key="****a1b2"} 150
+//	clickhouse_monitoring_quota_requests_total{key="****a1b2"} 48210
+//	clickhouse_monitoring_quota_rejected_total{key="****a1b2"} 12
+//	clickhouse_monitoring_quota_unauthorized_total 3
+//
+// The breaker state is 0 when closed, 1 when half-open and 2 when open.
+func (h *MetricsHandler) Metrics(c *gin.Context) {
+	// Writing to a buffer can't fail
+	var buf bytes.Buffer
+	_ = h.db.WriteMetrics(&buf)
+	_ = h.quotas.WriteMetrics(&buf, time.Now())
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
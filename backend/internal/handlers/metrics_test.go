@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// TestMetricsDefaultLookback checks that the metrics endpoint bounds requests
+// without a time range to DEFAULT_LOOKBACK, like the dashboard.
+func TestMetricsDefaultLookback(t *testing.T) {
+	now := time.Now()
+	router, h := newDemoRouter(now)
+	h.cfg.DefaultLookback = time.Hour
+
+	tests := []struct {
+		name         string
+		query        string
+		wantBucket   string
+		wantFrom     time.Time
+		wantWarnings []string
+	}{
+		{
+			name:         "no time range",
+			wantBucket:   "1m",
+			wantFrom:     now.Add(-time.Hour - time.Minute),
+			wantWarnings: []string{"no time range given, using the last 1h0m0s"},
+		},
+		{
+			name: "explicit range",
+			query: url.Values{
+				"start_time": {now.Add(-48 * time.Hour).Format(time.RFC3339)},
+				"end_time":   {now.Format(time.RFC3339)},
+			}.Encode(),
+			wantBucket: "1h",
+			wantFrom:   now.Add(-49 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "/metrics?"+tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body.String())
+			}
+
+			var body struct {
+				Data     []models.QueryLogMetrics `json:"data"`
+				Meta     models.MetricsMeta       `json:"meta"`
+				Warnings []string                 `json:"warnings"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Meta.BucketSize != tt.wantBucket {
+				t.Errorf("bucket_size = %q, want %q", body.Meta.BucketSize, tt.wantBucket)
+			}
+			if !slices.Equal(body.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", body.Warnings, tt.wantWarnings)
+			}
+			if len(body.Data) == 0 {
+				t.Fatal("no metrics returned")
+			}
+			if first := body.Data[0].TimeBucket; first.Before(tt.wantFrom) {
+				t.Errorf("first bucket %s is before %s", first, tt.wantFrom)
+			}
+		})
+	}
+}
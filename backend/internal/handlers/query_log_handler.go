@@ -1,27 +1,95 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/actio/clickhouse-monitoring/internal/cache"
+	"github.com/actio/clickhouse-monitoring/internal/config"
 	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
 	"github.com/actio/clickhouse-monitoring/internal/repository"
 )
 
 // QueryLogHandler handles HTTP requests for query log operations.
 type QueryLogHandler struct {
-	repo *repository.QueryLogRepository
+	repo        repository.QueryLogStore
+	annotations repository.AnnotationStore
+	cfg         config.APIConfig
+
+	// Response caches; disabled when the configured TTL is zero
+	databasesCache *cache.TTL[[]string]
+	metricsCache   *cache.TTL[metricsResponse]
+
+	// exportSem limits concurrent exports; nil when unlimited
+	exportSem chan struct{}
+
+	// exportStore receives exports with destination=s3; nil when not configured
+	exportStore *objectstore.S3
+}
+
+// metricsResponse is a cached aggregated metrics response.
+type metricsResponse struct {
+	metrics []models.QueryLogMetrics
+	meta    models.MetricsMeta
 }
 
 // NewQueryLogHandler creates a new QueryLogHandler instance.
-func NewQueryLogHandler(repo *repository.QueryLogRepository) *QueryLogHandler {
-	return &QueryLogHandler{repo: repo}
+// exportStore may be nil, which disables the s3 export destination.
+func NewQueryLogHandler(repo repository.QueryLogStore, annotations repository.AnnotationStore, cfg config.APIConfig, exportStore *objectstore.S3) *QueryLogHandler {
+	h := &QueryLogHandler{
+		repo:           repo,
+		annotations:    annotations,
+		cfg:            cfg,
+		exportStore:    exportStore,
+		databasesCache: cache.New[[]string](cfg.DatabasesCacheTTL),
+		metricsCache:   cache.New[metricsResponse](cfg.MetricsCacheTTL),
+	}
+	if cfg.MaxConcurrentExports > 0 {
+		h.exportSem = make(chan struct{}, cfg.MaxConcurrentExports)
+	}
+	return h
+}
+
+// acquireExport takes an export slot without waiting. It returns false when
+// MaxConcurrentExports exports are already running.
+func (h *QueryLogHandler) acquireExport() (release func(), ok bool) {
+	if h.exportSem == nil {
+		return func() {}, true
+	}
+	select {
+	case h.exportSem <- struct{}{}:
+		return func() { <-h.exportSem }, true
+	default:
+		return nil, false
+	}
+}
+
+// InvalidateCache clears the response caches selected by target:
+// "databases", "metrics" or "all".
+func (h *QueryLogHandler) InvalidateCache(target string) error {
+	switch target {
+	case "databases":
+		h.databasesCache.Clear()
+	case "metrics":
+		h.metricsCache.Clear()
+	case "all":
+		h.databasesCache.Clear()
+		h.metricsCache.Clear()
+	default:
+		return fmt.Errorf("invalid target: %q (expected databases, metrics or all)", target)
+	}
+	return nil
 }
 
 // GetQueryLogs handles GET /api/v1/logs
@@ -29,126 +97,291 @@ func NewQueryLogHandler(repo *repository.QueryLogRepository) *QueryLogHandler {
 // Query Parameters:
 //   - db_name: Filter by database name (exact match)
 //   - query_id: Filter by query ID (exact match)
+//   - initial_query_id: Filter by initial query ID (exact match), returning every row of one distributed query
 //   - only_failed: If "true", return only failed queries
-//   - min_duration_ms: Filter queries with duration greater than this value
+//   - type: Exact event type: QueryFinish, ExceptionBeforeStart (rejected before
+//     running) or ExceptionWhileProcessing (failed mid-execution). Combinations
+//     that can't match, e.g. type=QueryFinish&only_failed=true, return 400
+//   - has_exception: If "true", return anything that looks like a failure (non-zero
+//     exception_code, non-empty exception, or an Exception* type); a superset of only_failed
+//   - exception_codes: Comma-separated list of exception codes to match (e.g. 241,159,160)
+//   - min_duration_ms: Filter queries that took at least this many milliseconds (inclusive)
+//   - min_peak_memory_usage: Filter queries whose peak memory usage is at least this many bytes
+//   - min_memory_per_row: Filter queries using at least this many bytes of memory per row read
+//   - min_read_rows: Filter queries that read at least this many rows
+//   - min_tables: Filter queries touching at least this many tables
+//   - min_databases: Filter queries touching at least this many databases
 //   - user: Filter by user (exact match)
+//   - os_user: Filter by the client's OS user (exact match)
+//   - client_name: Filter by client name, e.g. "ClickHouse client" (exact match)
+//   - insert_target: Filter INSERT queries into this table (db.table). query_log
+//     doesn't separate read from written tables, so INSERT ... SELECT also matches its sources
+//   - used_function, used_aggregate_function, used_table_function, used_storage,
+//     used_data_type_family: Filter queries that used this function, aggregate
+//     function, table function, storage engine or data type family (exact name,
+//     e.g. used_storage=StripeLog). 400 unsupported_column if the server's
+//     query_log lacks the used_* column
+//   - cache_usage: Filter by query cache usage: Read (hit), Write, None or Unknown
+//   - shard: Read one shard's local query_log (host:port from CLICKHOUSE_SHARD_HOSTS)
 //   - query_contains: Filter queries containing this substring
-//   - start_time: Filter queries after this time (RFC3339 format)
-//   - end_time: Filter queries before this time (RFC3339 format)
+//   - query_starts_with: Filter queries beginning with this prefix
+//   - case_sensitive: If "true", query_contains and query_starts_with match case exactly
+//   - start_time: Filter queries after this time (RFC3339, or YYYY-MM-DD[THH:MM:SS] in tz).
+//     When neither start_time nor end_time is set, only the last DEFAULT_LOOKBACK
+//     (default: 1h) is searched; pass an explicit start_time for wider ranges.
+//   - end_time: Filter queries before this time (same formats as start_time)
+//   - start_date, end_date: Filter by calendar day (YYYY-MM-DD, inclusive) in tz.
+//     Days are translated to local midnight boundaries, so "yesterday" follows
+//     the viewer's time zone; combined with start_time/end_time the narrower bound wins
+//   - around, window: Filter to the window-long range centered on around (same
+//     formats as start_time; window is a duration such as 10m), e.g. window=10m
+//     covers around-5m to around+5m. Both are required together; combined with
+//     start_time/end_time or start_date/end_date the narrower bound wins
+//   - after: Polling cursor; return only queries with event_time strictly after
+//     this time (same formats as start_time), oldest first. Pass the event_time
+//     of the newest row already shown. Overrides sort_by/sort_order.
+//   - tz: IANA time zone for response timestamps and offset-less time filters (default: UTC)
+//   - local_time: If "true", keep event_time and event_date in UTC and add
+//     event_time_local rendered in tz, instead of converting event_time in place
+//   - sample: Only consider roughly this fraction of the matching queries
+//     (0 < sample <= 1), chosen by a hash of query_id; meta reports the rate as
+//     "sample_ratio". Also accepted by the metrics endpoints; ignored elsewhere
 //   - limit: Maximum number of records to return (default: 100, max: 1000)
 //   - offset: Number of records to skip for pagination
-//   - columns: Comma-separated list of columns to return (if omitted, returns all columns)
+//   - sort_by: Column to sort by (default: DEFAULT_SORT_BY, event_time). One of: event_time,
+//     query_duration_ms, memory_usage, read_rows, read_bytes, written_rows,
+//     written_bytes, result_rows, result_bytes, exception_code, user, type, query_id
+//   - sort_order: "asc" or "desc" (default: DEFAULT_SORT_ORDER, desc)
+//   - columns: Comma-separated list of columns to return (if omitted, returns all columns).
+//     Includes the used_* feature arrays (used_functions, used_storages, ...), which
+//     are not part of the full record
+//   - omit: Comma-separated list of fields to leave out of the full response,
+//     e.g. omit=query,exception; the other fields keep the full record's shape.
+//     Can't be combined with columns
+//   - flatten_arrays: If "true" (with columns), return array columns such as
+//     databases/tables as semicolon-joined strings, matching the CSV export
+//   - layout: "rows" (default) or "columnar" (with columns). Columnar returns data
+//     as {"column": [values...], ...} with one array per column in meta.columns order
+//   - string_numbers: If "true", integers in data are returned as strings so
+//     JavaScript clients keep full uint64 precision (accepted by all data endpoints)
 //
 // Response:
 //
 //	{
 //	  "data": [...],
-//	  "pagination": {
-//	    "limit": 100,
-//	    "offset": 0,
-//	    "count": 50
+//	  "meta": {
+//	    "pagination": {
+//	      "limit": 100,
+//	      "offset": 0,
+//	      "count": 50
+//	    }
 //	  }
 //	}
 //
-// When columns parameter is provided, response includes:
+// When columns parameter is provided, meta also includes:
 //
-//	{
-//	  "data": [...],
-//	  "columns": ["query_id", "query", ...],
-//	  "pagination": {...}
-//	}
+//	"columns": ["query_id", "query", ...]
 func (h *QueryLogHandler) GetQueryLogs(c *gin.Context) {
 	// Parse query parameters into filter struct
-	var filter models.QueryLogFilter
-	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid_parameters",
-			"message": err.Error(),
-		})
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
 		return
 	}
+	h.applyDefaultLookback(c, &filter)
 
-	// Determine the effective limit for pagination metadata
-	limit := filter.Limit
-	if limit <= 0 {
-		limit = 100
-	} else if limit > 1000 {
-		limit = 1000
+	// sort_by is interpolated into ORDER BY, so reject anything outside the allowlist
+	if err := repository.ValidateSort(filter.SortBy, filter.SortOrder, models.ValidSortColumns); err != nil {
+		respondError(c, models.ErrCodeInvalidSort, err.Error())
+		return
+	}
+	h.applyDefaultSort(&filter)
+
+	localTime, ok := parseLocalTime(c)
+	if !ok {
+		return
 	}
+	omit, ok := parseOmit(c, filter.Columns)
+	if !ok {
+		return
+	}
+
+	// Determine the effective limit for pagination metadata
+	limit := effectiveLimit(c, filter.Limit)
+	filter.Offset = effectiveOffset(c, filter.Offset)
 
 	// If columns parameter is provided, use dynamic column query
 	if filter.Columns != "" {
 		columns, err := repository.ParseColumns(filter.Columns)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid_columns",
-				"message": err.Error(),
-			})
+			respondError(c, models.ErrCodeInvalidColumns, err.Error())
+			return
+		}
+		if !h.checkColumns(c, columns) {
+			return
+		}
+
+		flatten := false
+		if value := c.Query("flatten_arrays"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				respondError(c, models.ErrCodeInvalidParams, "flatten_arrays must be true or false")
+				return
+			}
+			flatten = parsed
+		}
+
+		layout := c.DefaultQuery("layout", "rows")
+		if layout != "rows" && layout != "columnar" {
+			respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid layout: %q (expected rows or columnar)", layout))
 			return
 		}
 
 		logs, err := h.repo.GetQueryLogsDynamic(c.Request.Context(), filter, columns)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "database_error",
-				"message": "Failed to retrieve query logs",
-			})
+			writeDatabaseError(c, err, "Failed to retrieve query logs")
 			return
 		}
+		localizeRows(logs, loc, localTime)
+		if flatten {
+			flattenArrays(logs)
+		}
 
-		response := models.QueryLogDynamicResponse{
-			Data:    logs,
+		columns = localTimeColumns(columns, localTime)
+		meta := models.ListMeta{
 			Columns: columns,
 			Pagination: models.Pagination{
 				Limit:  limit,
 				Offset: filter.Offset,
 				Count:  len(logs),
 			},
+			SampleRatio: sampleRatio(filter),
 		}
-
-		c.JSON(http.StatusOK, response)
+		if layout == "columnar" {
+			respondData(c, toColumnar(columns, logs), meta)
+			return
+		}
+		respondData(c, logs, meta)
 		return
 	}
 
 	// Call repository to get filtered query logs (full columns)
 	logs, err := h.repo.GetQueryLogs(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "database_error",
-			"message": "Failed to retrieve query logs",
-		})
+		writeDatabaseError(c, err, "Failed to retrieve query logs")
 		return
 	}
+	localizeQueryLogs(logs, loc, localTime)
+
+	var data interface{} = logs
+	if omit != nil {
+		data = models.TrimQueryLogs(logs, omit)
+	}
 
 	// Return response with pagination metadata
-	response := models.QueryLogResponse{
-		Data: logs,
+	respondData(c, data, models.ListMeta{
 		Pagination: models.Pagination{
 			Limit:  limit,
 			Offset: filter.Offset,
 			Count:  len(logs),
 		},
+		SampleRatio: sampleRatio(filter),
+	})
+}
+
+// CountQueryLogs handles GET /api/v1/logs/count
+//
+// Returns the number of query logs matching the filters, without fetching rows.
+//
+// Query Parameters: Same as GetQueryLogs (except limit/offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": {"count": 1234}
+//	}
+func (h *QueryLogHandler) CountQueryLogs(c *gin.Context) {
+	filter, _, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	count, err := h.repo.CountQueryLogs(c.Request.Context(), filter)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to count query logs")
+		return
+	}
+
+	respondData(c, gin.H{"count": count}, nil)
+}
+
+// GetCoverage handles GET /api/v1/logs/coverage
+//
+// Returns the oldest and newest event_time in system.query_log, the total row
+// count and the on-disk size of the table. With ALLOWED_DATABASES the times and
+// count cover only queries touching an allowed database, and bytes_on_disk is
+// null since it describes the whole table.
+//
+// Query Parameters:
+//   - start_time: Optional; when set, exceeds_retention reports whether it is
+//     older than the oldest retained row
+//   - tz: IANA time zone for the returned timestamps and start_time (default: UTC)
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "oldest_event_time": "2024-01-01T00:00:00Z",
+//	    "newest_event_time": "2024-01-31T12:00:00Z",
+//	    "total_rows": 1234567,
+//	    "bytes_on_disk": 987654321,
+//	    "exceeds_retention": false
+//	  }
+//	}
+func (h *QueryLogHandler) GetCoverage(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	coverage, err := h.repo.GetCoverage(c.Request.Context())
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve query_log coverage")
+		return
+	}
+
+	if coverage.OldestEventTime != nil {
+		oldest := coverage.OldestEventTime.In(loc)
+		newest := coverage.NewestEventTime.In(loc)
+		coverage.OldestEventTime = &oldest
+		coverage.NewestEventTime = &newest
+	}
+
+	if filter.StartTime != nil {
+		exceeds := coverage.OldestEventTime == nil || filter.StartTime.Before(*coverage.OldestEventTime)
+		coverage.ExceedsRetention = &exceeds
 	}
 
-	c.JSON(http.StatusOK, response)
+	respondData(c, coverage, nil)
 }
 
 // GetDatabases handles GET /api/v1/databases
 //
-// Response: List of database names
+// Response: {"data": [...database names]}
 func (h *QueryLogHandler) GetDatabases(c *gin.Context) {
+	if databases, ok := h.databasesCache.Get(""); ok {
+		respondData(c, databases, nil)
+		return
+	}
+
 	databases, err := h.repo.GetDatabases(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "database_error",
-			"message": "Failed to retrieve databases",
-		})
+		writeDatabaseError(c, err, "Failed to retrieve databases")
 		return
 	}
+	h.databasesCache.Set("", databases)
 
-	c.JSON(http.StatusOK, gin.H{
-		"databases": databases,
-	})
+	respondData(c, databases, nil)
 }
 
 // GetQueryLogByID handles GET /api/v1/logs/:id
@@ -156,29 +389,166 @@ func (h *QueryLogHandler) GetDatabases(c *gin.Context) {
 // Path Parameters:
 //   - id: The query ID to retrieve
 //
-// Response: Single QueryLog object or 404 if not found
+// Query Parameters:
+//   - tz: IANA time zone for response timestamps (default: UTC)
+//
+// The response carries an ETag; a matching If-None-Match returns 304 without
+// formatting the query. Finished queries (QueryFinish and Exception* rows) are
+// sent with Cache-Control "private, max-age=86400, immutable"; a running
+// query's QueryStart row with "private, no-cache", since its finish row
+// replaces it. Annotations can be added at any time, so they are not part of
+// the cached body; fetch them from GET /api/v1/annotations?query_id=.
+//
+// Response: {"data": QueryLog} with "formatted_query" attached, or 404 if not found
 func (h *QueryLogHandler) GetQueryLogByID(c *gin.Context) {
 	queryID := c.Param("id")
 	if queryID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "missing_parameter",
-			"message": "query_id is required",
-		})
+		respondError(c, models.ErrCodeMissingParameter, "query_id is required")
+		return
+	}
+
+	loc, err := loadLocation(c.Query("tz"))
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidTimezone, err.Error())
+		return
+	}
+	localTime, ok := parseLocalTime(c)
+	if !ok {
 		return
 	}
 
 	log, err := h.repo.GetQueryLogByID(c.Request.Context(), queryID)
 	if err != nil {
-		// Check if it's a "not found" error
-		// In a real application, you'd have a custom error type for this
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "not_found",
-			"message": "Query log not found",
-		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(c, models.ErrCodeNotFound, "Query log not found")
+			return
+		}
+		writeDatabaseError(c, err, "Failed to retrieve query log")
+		return
+	}
+	localizeQueryLog(log, loc, localTime)
+
+	etag := queryLogETag(c, log)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", queryLogCacheControl(log))
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// Fall back to the raw text if ClickHouse can't format the query
+	formatted, err := h.repo.FormatQuery(c.Request.Context(), log.Query)
+	if err != nil {
+		formatted = log.Query
+	}
+
+	respondData(c, models.QueryLogDetail{
+		QueryLog:       *log,
+		FormattedQuery: formatted,
+	}, nil)
+}
+
+// GetQueryBundle handles GET /api/v1/logs/:id/bundle
+//
+// Returns the query log row, its formatted text, annotations, profile events,
+// per-thread breakdown from query_thread_log and, for SELECT queries, EXPLAIN
+// output as one downloadable JSON document, for attaching to a ticket when
+// escalating a query. EXPLAIN runs read-only with a short time and row budget,
+// and is skipped for queries using table functions such as url() or s3(), a
+// SETTINGS clause or INTO OUTFILE. Sections that can't be gathered
+// (query_thread_log disabled, EXPLAIN failing or skipped) are left empty and
+// explained in "warnings".
+//
+// Path Parameters:
+//   - id: The query ID to bundle
+//
+// Query Parameters:
+//   - tz: IANA time zone for response timestamps (default: UTC)
+//   - local_time: add event_time_local in the tz zone (default: false)
+//
+// Response: {"data": QueryBundle} as an attachment, or 404 if not found
+func (h *QueryLogHandler) GetQueryBundle(c *gin.Context) {
+	queryID := c.Param("id")
+	if queryID == "" {
+		respondError(c, models.ErrCodeMissingParameter, "query_id is required")
+		return
+	}
+
+	loc, err := loadLocation(c.Query("tz"))
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidTimezone, err.Error())
+		return
+	}
+	localTime, ok := parseLocalTime(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	log, err := h.repo.GetQueryLogByID(ctx, queryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(c, models.ErrCodeNotFound, "Query log not found")
+			return
+		}
+		writeDatabaseError(c, err, "Failed to retrieve query log")
+		return
+	}
+	localizeQueryLog(log, loc, localTime)
+
+	profileEvents, err := h.repo.GetProfileEvents(ctx, queryID)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve profile events")
+		return
+	}
+
+	annotations, err := h.annotations.List(ctx, queryID)
+	if err != nil {
+		c.Error(err)
+		respondError(c, models.ErrCodeStorageError, "Failed to retrieve annotations")
 		return
 	}
 
-	c.JSON(http.StatusOK, log)
+	formatted, err := h.repo.FormatQuery(ctx, log.Query)
+	if err != nil {
+		formatted = log.Query
+	}
+
+	threads, err := h.repo.GetQueryThreads(ctx, queryID, log.EventTime)
+	switch {
+	case errors.Is(err, repository.ErrLogNotEnabled):
+		addWarning(c, "threads: system.query_thread_log is not enabled on the server")
+	case err != nil:
+		c.Error(err)
+		addWarning(c, "threads: failed to read query_thread_log: %v", err)
+	case len(threads) == 0:
+		addWarning(c, "threads: query_thread_log has no rows for this query (log_query_threads may be disabled)")
+	}
+	if threads == nil {
+		threads = []models.QueryThread{}
+	}
+
+	explain := []string{}
+	if err := repository.CheckExplainable(log.Query); err != nil {
+		addWarning(c, "explain: %v", err)
+	} else if lines, err := h.repo.ExplainQuery(ctx, log.Query); err != nil {
+		addWarning(c, "explain: %v", err)
+	} else {
+		explain = lines
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "query_"+queryID+"_bundle.json"))
+	respondData(c, models.QueryBundle{
+		QueryLogDetail: models.QueryLogDetail{
+			QueryLog:       *log,
+			FormattedQuery: formatted,
+		},
+		Annotations:   annotations,
+		ProfileEvents: profileEvents,
+		Threads:       threads,
+		Explain:       explain,
+		GeneratedAt:   time.Now().In(loc),
+	}, nil)
 }
 
 // GetAggregatedMetrics handles GET /api/v1/logs/metrics
@@ -194,7 +564,23 @@ func (h *QueryLogHandler) GetQueryLogByID(c *gin.Context) {
 //   - <= 30 days: 6 hour buckets
 //   - > 30 days: 1 day buckets
 //
-// Query Parameters: Same as GetQueryLogs (except limit/offset/columns)
+// Without start_time or end_time only the last DEFAULT_LOOKBACK is aggregated,
+// as in the dashboard's metrics panel, and a warning says so.
+//
+// Query Parameters: Same as GetQueryLogs (except limit/offset/columns), plus:
+//   - fill_gaps: If "true", buckets without queries are returned with zeroed
+//     metrics so every interval from start_time to end_time (or now) is present
+//   - clamp_memory: If "true", negative memory_usage values count as 0 in
+//     avg_memory_usage and max_memory_usage. memory_usage is the change in the
+//     query's tracked memory, not a peak, and goes negative when a query frees
+//     memory allocated elsewhere, which distorts the memory charts
+//   - bucket_align: "epoch" (default) or "start". Epoch-aligned buckets start
+//     at interval boundaries counted from the Unix epoch (:00, :05, :10 for 5m
+//     buckets), so when start_time or end_time falls mid-bucket the edge
+//     buckets cover only part of an interval and understate counts. "start"
+//     (requires start_time) starts every bucket a whole number of intervals
+//     after start_time, so only the last bucket can be partial. meta reports
+//     the mode as "bucket_alignment"
 //
 // Response:
 //
@@ -207,123 +593,1036 @@ func (h *QueryLogHandler) GetQueryLogByID(c *gin.Context) {
 //	      "max_duration_ms": 1200,
 //	      "avg_memory_usage": 1048576,
 //	      "max_memory_usage": 10485760,
+//	      "max_peak_memory_usage": 12582912,
 //	      "total_read_bytes": 50000000,
 //	      "total_written_bytes": 1000000,
-//	      "failed_queries": 2
+//	      "failed_queries": 2,
+//	      "error_rate": 0.0133,
+//	      "queries_per_second": 2.5
 //	    },
 //	    ...
 //	  ],
-//	  "bucket_size": "1m",
-//	  "bucket_label": "1 minute"
+//	  "meta": {
+//	    "bucket_size": "1m",
+//	    "bucket_label": "1 MINUTE",
+//	    "bucket_alignment": "epoch",
+//	    "downsampled": false
+//	  }
 //	}
+//
+// When METRICS_MAX_SCAN_ROWS is set and the query is estimated to scan more
+// rows, a coarser bucket is used and meta reports "downsampled": true, the
+// "estimated_rows", and "sample_ratio" if METRICS_SAMPLE_RATIO sampling was applied.
+// With sample, only that fraction of queries is aggregated and meta reports
+// "sample_ratio" (the smaller rate wins when both apply); counts and sums are
+// scaled back up in either case.
+//
+// When the range would need more than MAX_BUCKETS buckets, a wider interval is
+// used and meta reports "bucket_clamped": true.
 func (h *QueryLogHandler) GetAggregatedMetrics(c *gin.Context) {
-	var filter models.QueryLogFilter
-	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid_parameters",
-			"message": err.Error(),
-		})
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
 		return
 	}
 
-	metrics, bucket, err := h.repo.GetAggregatedMetrics(c.Request.Context(), filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "database_error",
-			"message": "Failed to retrieve aggregated metrics",
-		})
+	result, ok := h.loadMetrics(c, filter, loc)
+	if !ok {
 		return
 	}
 
-	response := models.QueryLogMetricsResponse{
-		Data:        metrics,
-		BucketSize:  bucket.Label,
-		BucketLabel: bucket.Interval,
-	}
-
-	c.JSON(http.StatusOK, response)
+	respondData(c, result.metrics, result.meta)
 }
 
-// ExportCSV handles GET /api/v1/logs/export
+// ExportMetrics handles GET /api/v1/logs/metrics/export
 //
-// Exports query logs as CSV file with user-specified columns and limit.
+// Exports the time-bucketed metrics of GetAggregatedMetrics as a CSV or TSV
+// file. The header row lists the QueryLogMetrics fields, starting with
+// time_bucket. Rows are produced by the same code path (and cache) as
+// GetAggregatedMetrics, so with the same parameters they match the chart,
+// including filled gaps, bucket selection, clamping and sampling.
 //
-// Query Parameters:
-//   - columns: Comma-separated list of columns to export (required)
-//   - limit: Maximum number of records to export (default: 1000, max: 100000)
-//   - All other filter parameters from GetQueryLogs
+// Query Parameters: Same as GetAggregatedMetrics, plus:
+//   - format: "csv" (default) or "tsv"
+//   - destination: "http" (default) streams the file as the response; "s3"
+//     uploads it to EXPORT_S3_BUCKET, like ExportCSV
 //
-// Response: CSV file download
-func (h *QueryLogHandler) ExportCSV(c *gin.Context) {
-	var filter models.QueryLogFilter
-	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid_parameters",
-			"message": err.Error(),
-		})
+// Response: CSV or TSV file download, or {"data": ExportResult} for s3
+func (h *QueryLogHandler) ExportMetrics(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
 		return
 	}
 
-	// Parse columns - required for CSV export
-	if filter.Columns == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "missing_columns",
-			"message": "columns parameter is required for CSV export",
-		})
+	format, ok := exportFormats[c.DefaultQuery("format", "csv")]
+	if !ok {
+		respondError(c, models.ErrCodeInvalidFormat, fmt.Sprintf("invalid format: %q (expected csv or tsv)", c.Query("format")))
 		return
 	}
 
-	columns, err := repository.ParseColumns(filter.Columns)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid_columns",
-			"message": err.Error(),
-		})
+	destination, ok := h.exportDestination(c)
+	if !ok {
 		return
 	}
 
-	// Set higher limit for CSV export (max 100000)
-	if filter.Limit <= 0 {
-		filter.Limit = 1000
-	} else if filter.Limit > 100000 {
-		filter.Limit = 100000
+	result, ok := h.loadMetrics(c, filter, loc)
+	if !ok {
+		return
 	}
 
-	// Fetch the data
-	logs, err := h.repo.GetQueryLogsDynamic(c.Request.Context(), filter, columns)
+	filename := fmt.Sprintf("query_metrics_%s.%s", time.Now().Format("20060102_150405"), format.Extension)
+	sink, ok := h.newExportSink(c, destination, filename, format.ContentType)
+	if !ok {
+		return
+	}
+	writer := format.NewWriter(sink.Writer())
+
+	err := writer.WriteHeader(metricsExportColumns)
+	for _, m := range result.metrics {
+		if err != nil {
+			break
+		}
+		err = writer.WriteRow(metricsExportColumns, metricsExportRow(m))
+	}
+	if err == nil {
+		err = flushExport(sink, writer)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "database_error",
-			"message": "Failed to retrieve query logs for export",
-		})
+		sink.Finalize(c.Request.Context(), err)
+		log.Printf("metrics export aborted: file=%s error=%v", filename, err)
+		// An http download has already started; an s3 spool file failed
+		if destination != "http" {
+			c.Error(err)
+			respondError(c, models.ErrCodeExportError, "Failed to write export")
+		}
 		return
 	}
 
-	// Generate filename with timestamp
-	filename := fmt.Sprintf("query_logs_%s.csv", time.Now().Format("20060102_150405"))
+	completeExport(c, sink, filename, len(result.metrics))
+}
+
+// loadMetrics produces the aggregated metrics for GetAggregatedMetrics and
+// ExportMetrics, so the chart and its export agree on bucket selection, gap
+// filling, clamping and sampling. It parses the metrics options, applies the
+// default lookback like the dashboard's metrics panel, localizes time buckets
+// to loc and caches the result. Identical parameters share a cached result
+// whichever endpoint asked; the export format and destination don't matter.
+// On failure it writes the error response and returns ok=false.
+func (h *QueryLogHandler) loadMetrics(c *gin.Context, filter models.QueryLogFilter, loc *time.Location) (metricsResponse, bool) {
+	metricsOpts, ok := parseMetricsOptions(c, filter)
+	if !ok {
+		return metricsResponse{}, false
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	// Encode sorts the keys, so equivalent query strings share an entry
+	params := c.Request.URL.Query()
+	params.Del("format")
+	params.Del("destination")
+	cacheKey := params.Encode()
+	if cached, ok := h.metricsCache.Get(cacheKey); ok {
+		return cached, true
+	}
+
+	metrics, meta, err := h.aggregatedMetrics(c.Request.Context(), filter, metricsOpts)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve aggregated metrics")
+		return metricsResponse{}, false
+	}
+	for i := range metrics {
+		metrics[i].TimeBucket = metrics[i].TimeBucket.In(loc)
+	}
+
+	result := metricsResponse{metrics: metrics, meta: meta}
+	h.metricsCache.Set(cacheKey, result)
+	return result, true
+}
 
-	// Set headers for CSV download
-	c.Header("Content-Type", "text/csv")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+// aggregatedMetrics queries the aggregated metrics and derives the fields and
+// metadata every metrics response carries.
+func (h *QueryLogHandler) aggregatedMetrics(ctx context.Context, filter models.QueryLogFilter, opts repository.MetricsOptions) ([]models.QueryLogMetrics, models.MetricsMeta, error) {
+	metrics, plan, err := h.repo.GetAggregatedMetrics(ctx, filter, opts)
+	if err != nil {
+		return nil, models.MetricsMeta{}, err
+	}
+	setQueriesPerSecond(metrics, plan.Bucket)
 
-	// Create CSV writer
-	writer := csv.NewWriter(c.Writer)
-	defer writer.Flush()
+	meta := models.MetricsMeta{
+		BucketSize:      plan.Bucket.Label,
+		BucketLabel:     plan.Bucket.Interval,
+		BucketAlignment: "epoch",
+		Downsampled:     plan.Downsampled,
+		EstimatedRows:   plan.EstimatedRows,
+		BucketClamped:   plan.Bucket.Clamped,
+	}
+	if plan.Origin != nil {
+		meta.BucketAlignment = "start"
+	}
+	if plan.SampleRatio < 1 {
+		meta.SampleRatio = plan.SampleRatio
+	}
+	return metrics, meta, nil
+}
 
-	// Write header row
-	if err := writer.Write(columns); err != nil {
+// setQueriesPerSecond derives QueriesPerSecond from each bucket's total and
+// the bucket length.
+func setQueriesPerSecond(metrics []models.QueryLogMetrics, bucket repository.BucketSize) {
+	seconds := bucket.Duration.Seconds()
+	if seconds <= 0 {
 		return
 	}
+	for i := range metrics {
+		metrics[i].QueriesPerSecond = float64(metrics[i].TotalQueries) / seconds
+	}
+}
+
+// parseMetricsOptions parses the fill_gaps, clamp_memory and bucket_align
+// parameters of the metrics endpoints, writing a 400 response if any is
+// invalid. bucket_align=start requires start_time.
+func parseMetricsOptions(c *gin.Context, filter models.QueryLogFilter) (repository.MetricsOptions, bool) {
+	var opts repository.MetricsOptions
+	var ok bool
+	if opts.FillGaps, ok = parseBoolParam(c, "fill_gaps"); !ok {
+		return opts, false
+	}
+	if opts.ClampMemory, ok = parseBoolParam(c, "clamp_memory"); !ok {
+		return opts, false
+	}
 
-	// Write data rows
-	for _, row := range logs {
-		record := make([]string, len(columns))
-		for i, col := range columns {
-			record[i] = formatCSVValue(row[col])
+	switch align := c.DefaultQuery("bucket_align", "epoch"); align {
+	case "epoch":
+	case "start":
+		if filter.StartTime == nil {
+			respondError(c, models.ErrCodeMissingParameter, "bucket_align=start requires start_time")
+			return opts, false
 		}
-		if err := writer.Write(record); err != nil {
+		opts.AlignToStart = true
+	default:
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid bucket_align: %q (expected epoch or start)", align))
+		return opts, false
+	}
+	return opts, true
+}
+
+// parseBoolParam parses an optional boolean query parameter (default false),
+// writing a 400 response if it is invalid.
+func parseBoolParam(c *gin.Context, name string) (bool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return false, true
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("%s must be true or false", name))
+		return false, false
+	}
+	return parsed, true
+}
+
+// GetInsertStats handles GET /api/v1/logs/inserts
+//
+// Returns INSERT performance per target table, time-bucketed like the metrics
+// endpoint. Only queries with query_kind = 'Insert' are included; an insert
+// into several tables counts towards each of them.
+//
+// Query Parameters:
+//   - All filter parameters from GetQueryLogs (except limit/offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "time_bucket": "2024-01-01T00:00:00Z",
+//	      "table": "default.events",
+//	      "inserts": 60,
+//	      "written_rows": 600000,
+//	      "written_bytes": 48000000,
+//	      "rows_per_second": 10000,
+//	      "avg_parts_created": 1.2,
+//	      "failed_inserts": 0
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {
+//	    "bucket_size": "1m",
+//	    "bucket_label": "1 MINUTE",
+//	    "downsampled": false
+//	  }
+//	}
+func (h *QueryLogHandler) GetInsertStats(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	stats, bucket, err := h.repo.GetInsertStats(c.Request.Context(), filter)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve insert stats")
+		return
+	}
+	for i := range stats {
+		stats[i].TimeBucket = stats[i].TimeBucket.In(loc)
+	}
+
+	respondData(c, stats, models.MetricsMeta{
+		BucketSize:    bucket.Label,
+		BucketLabel:   bucket.Interval,
+		BucketClamped: bucket.Clamped,
+	})
+}
+
+// GetSessions handles GET /api/v1/logs/sessions
+//
+// Groups one user's queries into sessions separated by idle gaps, turning the
+// flat log into units of interactive work.
+//
+// Query Parameters:
+//   - user: The user whose queries to sessionize (required)
+//   - gap: Idle time that ends a session, as a Go duration (default: 5m, min: 1s)
+//   - limit: Maximum number of sessions to return, most recent first (default: 100, max: 1000)
+//   - All other filter parameters from GetQueryLogs (except offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "start_time": "2024-01-01T10:00:00Z",
+//	      "end_time": "2024-01-01T10:12:30Z",
+//	      "query_count": 42,
+//	      "total_duration_ms": 18250,
+//	      "failed_queries": 1,
+//	      "query_ids": ["abc-123", ...]
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {"user": "analyst", "gap": "5m0s"}
+//	}
+func (h *QueryLogHandler) GetSessions(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	if filter.User == "" {
+		respondError(c, models.ErrCodeMissingUser, "user parameter is required for sessions")
+		return
+	}
+
+	gap := 5 * time.Minute
+	if value := c.Query("gap"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Second {
+			respondError(c, models.ErrCodeInvalidParams, "gap must be a duration of at least 1s (e.g. 5m)")
 			return
 		}
+		gap = parsed
+	}
+
+	sessions, err := h.repo.GetSessions(c.Request.Context(), filter, gap)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve sessions")
+		return
+	}
+	for i := range sessions {
+		sessions[i].StartTime = sessions[i].StartTime.In(loc)
+		sessions[i].EndTime = sessions[i].EndTime.In(loc)
+	}
+
+	respondData(c, sessions, models.SessionMeta{
+		User: filter.User,
+		Gap:  gap.String(),
+	})
+}
+
+// GetRetryBursts handles GET /api/v1/logs/patterns/bursts
+//
+// Flags likely client retry storms: normalized queries that the same user ran
+// at least min_count times within one burst_window. Executions are grouped
+// into fixed windows aligned to the epoch, so a burst straddling a window
+// boundary may be reported as two smaller ones.
+//
+// Query Parameters:
+//   - burst_window: Window length, as a Go duration (default: 1m, min: 1s)
+//   - min_count: Executions within a window that make a burst (default: 10, min: 2)
+//   - limit: Maximum number of bursts to return, largest first (default: 100, max: 1000)
+//   - All other filter parameters from GetQueryLogs (except offset/columns/sort)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "normalized_query_hash": "1234567890123456789",
+//	      "normalized_query": "SELECT * FROM events WHERE id = ?",
+//	      "user": "api",
+//	      "window_start": "2024-01-01T10:00:00Z",
+//	      "window_end": "2024-01-01T10:01:00Z",
+//	      "first_seen": "2024-01-01T10:00:03Z",
+//	      "last_seen": "2024-01-01T10:00:58Z",
+//	      "executions": 57,
+//	      "failed_queries": 55
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {"window": "1m0s", "min_count": 10}
+//	}
+func (h *QueryLogHandler) GetRetryBursts(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	window := burstDefaultWindow
+	if value := c.Query("burst_window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Second {
+			respondError(c, models.ErrCodeInvalidParams, "burst_window must be a duration of at least 1s (e.g. 1m)")
+			return
+		}
+		window = parsed.Truncate(time.Second)
+	}
+
+	minCount := int64(burstDefaultMinCount)
+	if value := c.Query("min_count"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 2 {
+			respondError(c, models.ErrCodeInvalidParams, "min_count must be an integer of at least 2")
+			return
+		}
+		minCount = parsed
+	}
+
+	bursts, err := h.repo.GetRetryBursts(c.Request.Context(), filter, window, minCount)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve retry bursts")
+		return
+	}
+	for i := range bursts {
+		bursts[i].WindowStart = bursts[i].WindowStart.In(loc)
+		bursts[i].WindowEnd = bursts[i].WindowEnd.In(loc)
+		bursts[i].FirstSeen = bursts[i].FirstSeen.In(loc)
+		bursts[i].LastSeen = bursts[i].LastSeen.In(loc)
+	}
+
+	respondData(c, bursts, models.RetryBurstMeta{
+		Window:   window.String(),
+		MinCount: minCount,
+	})
+}
+
+const (
+	// burstDefaultWindow and burstDefaultMinCount define a retry burst when
+	// the request doesn't
+	burstDefaultWindow   = time.Minute
+	burstDefaultMinCount = 10
+)
+
+// GetPatternTrend handles GET /api/v1/logs/patterns/:hash/trend
+//
+// Returns time-bucketed statistics for all executions of one normalized query,
+// to pinpoint when it regressed. Bucket sizes follow the metrics endpoint.
+//
+// Path Parameters:
+//   - hash: The normalized_query_hash of the query (unsigned 64-bit integer)
+//
+// Query Parameters:
+//   - All filter parameters from GetQueryLogs (except limit/offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "time_bucket": "2024-01-01T00:00:00Z",
+//	      "executions": 12,
+//	      "avg_duration_ms": 45.5,
+//	      "p95_duration_ms": 120,
+//	      "avg_read_bytes": 1048576,
+//	      "p95_read_bytes": 4194304
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {
+//	    "normalized_query_hash": "1234567890123456789",
+//	    "bucket_size": "1h",
+//	    "bucket_label": "1 HOUR"
+//	  }
+//	}
+func (h *QueryLogHandler) GetPatternTrend(c *gin.Context) {
+	hash, err := strconv.ParseUint(c.Param("hash"), 10, 64)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidHash, "hash must be an unsigned 64-bit integer (normalized_query_hash)")
+		return
+	}
+
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	points, bucket, err := h.repo.GetPatternTrend(c.Request.Context(), filter, hash)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve pattern trend")
+		return
+	}
+	for i := range points {
+		points[i].TimeBucket = points[i].TimeBucket.In(loc)
+	}
+
+	respondData(c, points, models.PatternTrendMeta{
+		NormalizedQueryHash: strconv.FormatUint(hash, 10),
+		BucketSize:          bucket.Label,
+		BucketLabel:         bucket.Interval,
+		BucketClamped:       bucket.Clamped,
+	})
+}
+
+// GetPatternTreemap handles GET /api/v1/logs/patterns/treemap
+//
+// Returns where query time goes as a tree for treemap/sunburst rendering: the
+// root's children are query kinds, and each kind's children are its top_n
+// normalized query patterns by total duration, plus an "other" node for the
+// remaining patterns. value is the total query_duration_ms of the node.
+//
+// Query Parameters:
+//   - top_n: Patterns per kind (default: 10, max: 100)
+//   - All filter parameters from GetQueryLogs (except limit/offset/columns/sort)
+//
+// Response:
+//
+//	{
+//	  "data": {
+//	    "name": "all", "value": 90000, "share": 1, "executions": 1200,
+//	    "children": [
+//	      {
+//	        "name": "Select", "value": 60000, "share": 0.667, "executions": 1000,
+//	        "children": [
+//	          {"name": "SELECT ... FROM events WHERE id = ?", "value": 40000, "share": 0.444,
+//	           "executions": 800, "normalized_query_hash": "1234567890123456789"},
+//	          {"name": "other", "value": 20000, "share": 0.222, "executions": 200}
+//	        ]
+//	      },
+//	      ...
+//	    ]
+//	  }
+//	}
+func (h *QueryLogHandler) GetPatternTreemap(c *gin.Context) {
+	filter, _, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	topN := treemapDefaultTopN
+	if value := c.Query("top_n"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			respondError(c, models.ErrCodeInvalidParams, "top_n must be a positive integer")
+			return
+		}
+		if parsed > treemapMaxTopN {
+			parsed = treemapMaxTopN
+			addWarning(c, "top_n clamped to %d", treemapMaxTopN)
+		}
+		topN = parsed
+	}
+
+	patterns, err := h.repo.GetPatternTreemap(c.Request.Context(), filter, topN)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve pattern treemap")
+		return
+	}
+
+	respondData(c, buildTreemap(patterns), nil)
+}
+
+const (
+	// treemapDefaultTopN and treemapMaxTopN bound the patterns per query kind
+	treemapDefaultTopN = 10
+	treemapMaxTopN     = 100
+)
+
+// buildTreemap arranges pattern rows (ordered by kind) into a kind -> pattern
+// tree. Each kind gets an "other" child for the duration of the patterns
+// beyond the top N, so children always add up to their parent.
+func buildTreemap(patterns []models.TreemapPattern) models.TreemapNode {
+	root := models.TreemapNode{Name: "all", Children: []models.TreemapNode{}}
+	for i := 0; i < len(patterns); {
+		first := patterns[i]
+		kind := models.TreemapNode{Name: first.QueryKind, Value: first.KindDurationMs, Executions: first.KindExecutions}
+
+		var childDuration, childExecutions uint64
+		for ; i < len(patterns) && patterns[i].QueryKind == first.QueryKind; i++ {
+			p := patterns[i]
+			kind.Children = append(kind.Children, models.TreemapNode{
+				Name:                p.NormalizedQuery,
+				Value:               p.DurationMs,
+				Executions:          p.Executions,
+				NormalizedQueryHash: strconv.FormatUint(p.NormalizedQueryHash, 10),
+			})
+			childDuration += p.DurationMs
+			childExecutions += p.Executions
+		}
+		if kind.Executions > childExecutions {
+			kind.Children = append(kind.Children, models.TreemapNode{
+				Name:       "other",
+				Value:      kind.Value - childDuration,
+				Executions: kind.Executions - childExecutions,
+			})
+		}
+
+		root.Value += kind.Value
+		root.Executions += kind.Executions
+		root.Children = append(root.Children, kind)
+	}
+
+	// Largest kinds first, then compute shares against the root total
+	sort.SliceStable(root.Children, func(a, b int) bool {
+		return root.Children[a].Value > root.Children[b].Value
+	})
+	setTreemapShares(&root, root.Value)
+	return root
+}
+
+// setTreemapShares sets Share on node and its descendants as a fraction of total.
+func setTreemapShares(node *models.TreemapNode, total uint64) {
+	if total > 0 {
+		node.Share = float64(node.Value) / float64(total)
+	}
+	for i := range node.Children {
+		setTreemapShares(&node.Children[i], total)
+	}
+}
+
+// GetGroupedStats handles GET /api/v1/logs/group-by
+//
+// Returns aggregated metrics grouped by a single dimension column.
+//
+// Query Parameters:
+//   - dimension: Column to group by (required). One of: user, initial_user,
+//     client_hostname, http_user_agent, os_user, client_name, type, query_kind,
+//     exception_code
+//   - sort_by: Aggregate to sort by (default: total_queries)
+//   - sort_order: "asc" or "desc" (default: desc)
+//   - limit: Maximum number of groups to return (default: 100, max: 1000)
+//   - All other filter parameters from GetQueryLogs (except offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "key": "default",
+//	      "total_queries": 150,
+//	      "avg_duration_ms": 45.5,
+//	      "max_duration_ms": 1200,
+//	      "total_read_bytes": 50000000,
+//	      "total_written_bytes": 1000000,
+//	      "failed_queries": 2,
+//	      "error_rate": 0.0133
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {"dimension": "user"}
+//	}
+//
+// With dimension=exception_code each group also has "error_name", the
+// ClickHouse name of the code (e.g. "MEMORY_LIMIT_EXCEEDED").
+func (h *QueryLogHandler) GetGroupedStats(c *gin.Context) {
+	filter, _, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	var params models.GroupByParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return
+	}
+
+	// Dimension and sort column are interpolated into the SQL, so validate against allowlists
+	if !models.ValidGroupByDimensions[params.Dimension] {
+		respondError(c, models.ErrCodeInvalidDimension, fmt.Sprintf("invalid dimension: %q", params.Dimension))
+		return
+	}
+
+	if err := repository.ValidateSort(filter.SortBy, filter.SortOrder, models.ValidGroupBySortColumns); err != nil {
+		respondError(c, models.ErrCodeInvalidSort, err.Error())
+		return
+	}
+
+	// Only report adjustments here; the repository applies the same clamp
+	effectiveLimit(c, filter.Limit)
+
+	stats, err := h.repo.GetGroupedStats(c.Request.Context(), filter, params)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve grouped stats")
+		return
+	}
+
+	respondData(c, stats, models.GroupByMeta{
+		Dimension: params.Dimension,
+	})
+}
+
+// GetUserShares handles GET /api/v1/logs/user-share
+//
+// Returns each user's share of total query duration, memory and read bytes
+// within the filtered range, for spotting noisy neighbors on shared clusters.
+// Users with any share at or above the threshold have exceeds_threshold set.
+//
+// Query Parameters:
+//   - share_threshold: Share percentage to flag (default: NOISY_NEIGHBOR_THRESHOLD)
+//   - All filter parameters from GetQueryLogs (except limit/offset/columns)
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "user": "etl",
+//	      "total_queries": 1200,
+//	      "total_duration_ms": 5400000,
+//	      "total_memory_usage": 98765432100,
+//	      "total_read_bytes": 123456789000,
+//	      "duration_share": 72.5,
+//	      "memory_share": 64.1,
+//	      "read_bytes_share": 80.3,
+//	      "exceeds_threshold": true
+//	    },
+//	    ...
+//	  ],
+//	  "meta": {"share_threshold": 50}
+//	}
+func (h *QueryLogHandler) GetUserShares(c *gin.Context) {
+	filter, _, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	threshold := h.cfg.NoisyNeighborThreshold
+	if value := c.Query("share_threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 100 {
+			respondError(c, models.ErrCodeInvalidParams, "share_threshold must be a number between 0 and 100")
+			return
+		}
+		threshold = parsed
+	}
+
+	shares, err := h.repo.GetUserShares(c.Request.Context(), filter)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve user shares")
+		return
+	}
+
+	for i := range shares {
+		s := &shares[i]
+		s.ExceedsThreshold = s.DurationShare >= threshold ||
+			s.MemoryShare >= threshold ||
+			s.ReadBytesShare >= threshold
+	}
+
+	respondData(c, shares, models.UserShareMeta{
+		ShareThreshold: threshold,
+	})
+}
+
+// ExportCSV handles GET /api/v1/logs/export
+//
+// Exports query logs as a CSV or TSV file with user-specified columns and limit.
+//
+// Query Parameters:
+//   - columns: Comma-separated list of columns to export (required)
+//   - headers: Comma-separated header names, one per column, replacing the raw
+//     column names in the header row (e.g. columns=query,query_duration_ms&headers=SQL,Duration (ms));
+//     names can't contain commas. Defaults to the column names
+//   - format: "csv" (default) or "tsv" (ClickHouse TabSeparatedWithNames, suitable
+//     for re-importing with INSERT ... FORMAT TabSeparatedWithNames)
+//   - limit: Maximum number of records to export (default: 1000, max: 100000)
+//   - destination: "http" (default) streams the file as the response; "s3"
+//     uploads it to EXPORT_S3_BUCKET and responds with its location
+//   - All other filter parameters from GetQueryLogs
+//
+// Response: CSV or TSV file download, or {"data": ExportResult} for s3
+//
+// At most MAX_CONCURRENT_EXPORTS exports run at once; further requests get
+// 429 too_many_exports with a Retry-After header.
+func (h *QueryLogHandler) ExportCSV(c *gin.Context) {
+	filter, loc, ok := h.bindFilter(c)
+	if !ok {
+		return
+	}
+	h.applyDefaultLookback(c, &filter)
+
+	// Parse columns - required for CSV export
+	if filter.Columns == "" {
+		respondError(c, models.ErrCodeMissingColumns, "columns parameter is required for CSV export")
+		return
+	}
+
+	columns, err := repository.ParseColumns(filter.Columns)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidColumns, err.Error())
+		return
+	}
+	if !h.checkColumns(c, columns) {
+		return
+	}
+
+	headers, err := parseExportHeaders(c.Query("headers"), columns)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidHeaders, err.Error())
+		return
+	}
+
+	// Export goes through the dynamic query path; validate sort_by the same way as the list endpoint
+	if err := repository.ValidateSort(filter.SortBy, filter.SortOrder, models.ValidSortColumns); err != nil {
+		respondError(c, models.ErrCodeInvalidSort, err.Error())
+		return
+	}
+	h.applyDefaultSort(&filter)
+
+	format, ok := exportFormats[c.DefaultQuery("format", "csv")]
+	if !ok {
+		respondError(c, models.ErrCodeInvalidFormat, fmt.Sprintf("invalid format: %q (expected csv or tsv)", c.Query("format")))
+		return
+	}
+
+	destination, ok := h.exportDestination(c)
+	if !ok {
+		return
+	}
+
+	// Exports are long and heavy, so they have their own cap on top of the
+	// general query concurrency limit
+	release, ok := h.acquireExport()
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(exportRetryAfterSeconds))
+		respondError(c, models.ErrCodeTooManyExports, "Too many exports are running, please retry later")
+		return
+	}
+	defer release()
+
+	// Set higher limit for CSV export (max 100000)
+	if filter.Limit <= 0 {
+		filter.Limit = 1000
+	} else if filter.Limit > 100000 {
+		filter.Limit = 100000
+	}
+
+	// Generate filename with timestamp
+	filename := fmt.Sprintf("query_logs_%s.%s", time.Now().Format("20060102_150405"), format.Extension)
+
+	sink, ok := h.newExportSink(c, destination, filename, format.ContentType)
+	if !ok {
+		return
+	}
+	writer := format.NewWriter(sink.Writer())
+
+	// The header row is written lazily on the first row so that errors raised
+	// before anything is written (e.g. circuit open) still get a JSON error.
+	// SELECT list and row values follow the same columns slice, and headers is
+	// parallel to it; the repository rejects a result set whose columns differ.
+	started := false
+	start := func() error {
+		started = true
+		if err := writer.WriteHeader(headers); err != nil {
+			return err
+		}
+		return flushExport(sink, writer)
+	}
+
+	startedAt := time.Now()
+	written := 0
+	err = h.repo.StreamQueryLogsDynamic(c.Request.Context(), filter, columns, func(row map[string]interface{}) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		localizeRow(row, loc)
+		if err := writer.WriteRow(columns, row); err != nil {
+			return err
+		}
+		written++
+
+		// Flush periodically so the download streams instead of buffering
+		if written%exportFlushRows == 0 {
+			if err := flushExport(sink, writer); err != nil {
+				return err
+			}
+		}
+		if written%exportProgressRows == 0 {
+			log.Printf("export progress: file=%s rows=%d limit=%d elapsed=%s", filename, written, filter.Limit, time.Since(startedAt).Round(time.Millisecond))
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = flushExport(sink, writer)
+	}
+	if err != nil {
+		sink.Finalize(c.Request.Context(), err)
+		if !started || destination != "http" {
+			writeDatabaseError(c, err, "Failed to retrieve query logs for export")
+			return
+		}
+		// Headers are already sent; all we can do is log and cut the download short
+		log.Printf("export aborted: file=%s rows=%d error=%v", filename, written, err)
+		return
+	}
+
+	if completeExport(c, sink, filename, written) {
+		log.Printf("export finished: file=%s destination=%s rows=%d elapsed=%s", filename, destination, written, time.Since(startedAt).Round(time.Millisecond))
+	}
+}
+
+// bindFilter binds the shared filter parameters (see the package-level
+// bindFilter) and additionally checks shard against the configured hosts and
+// the filter's cost against MAX_FILTER_COST.
+func (h *QueryLogHandler) bindFilter(c *gin.Context) (models.QueryLogFilter, *time.Location, bool) {
+	filter, loc, ok := bindFilter(c)
+	if !ok {
+		return filter, nil, false
+	}
+
+	if !h.repo.ValidShard(filter.Shard) {
+		respondError(c, models.ErrCodeInvalidShard, fmt.Sprintf("unknown shard: %q", filter.Shard))
+		return filter, nil, false
+	}
+
+	if filter.DBName != "" && !h.repo.AllowedDatabase(filter.DBName) {
+		respondError(c, models.ErrCodeForbiddenDatabase, fmt.Sprintf("database %q is not exposed by this server", filter.DBName))
+		return filter, nil, false
+	}
+
+	if filter.MinPeakMemoryUsage > 0 && !h.checkColumns(c, []string{"peak_memory_usage"}) {
+		return filter, nil, false
+	}
+
+	for _, feature := range filter.UsedFeatures() {
+		if !h.checkColumns(c, []string{feature.Column}) {
+			return filter, nil, false
+		}
+	}
+
+	if cost := repository.FilterCost(filter); h.cfg.MaxFilterCost > 0 && cost > h.cfg.MaxFilterCost {
+		respondError(c, models.ErrCodeFilterTooComplex, fmt.Sprintf("filter cost %d exceeds the limit of %d; substring matches and long lists (e.g. exception_codes) cost the most", cost, h.cfg.MaxFilterCost))
+		return filter, nil, false
+	}
+
+	return filter, loc, true
+}
+
+// checkColumns rejects requests for optional columns the server's query_log
+// doesn't have. It writes the error response and returns false on failure.
+func (h *QueryLogHandler) checkColumns(c *gin.Context, columns []string) bool {
+	for _, col := range columns {
+		if !models.OptionalColumns[col] {
+			continue
+		}
+		ok, err := h.repo.HasColumn(c.Request.Context(), col)
+		if err != nil {
+			writeDatabaseError(c, err, "Failed to inspect query_log columns")
+			return false
+		}
+		if !ok {
+			respondError(c, models.ErrCodeUnsupportedColumn, fmt.Sprintf("column %q is not available on this ClickHouse server", col))
+			return false
+		}
+	}
+	return true
+}
+
+// applyDefaultLookback restricts filters without any time bound to the configured
+// lookback window, so clients that omit a range don't scan the whole query_log.
+func (h *QueryLogHandler) applyDefaultLookback(c *gin.Context, filter *models.QueryLogFilter) {
+	if h.cfg.DefaultLookback <= 0 || filter.StartTime != nil || filter.EndTime != nil || filter.After != nil {
+		return
+	}
+	start := time.Now().Add(-h.cfg.DefaultLookback)
+	filter.StartTime = &start
+	addWarning(c, "no time range given, using the last %s", h.cfg.DefaultLookback)
+}
+
+// applyDefaultSort fills in the configured DEFAULT_SORT_BY and
+// DEFAULT_SORT_ORDER for a list or export request that didn't set them.
+func (h *QueryLogHandler) applyDefaultSort(filter *models.QueryLogFilter) {
+	if filter.SortBy == "" {
+		filter.SortBy = h.cfg.DefaultSortBy
+	}
+	if filter.SortOrder == "" {
+		filter.SortOrder = h.cfg.DefaultSortOrder
+	}
+}
+
+// sampleRatio returns the sample rate applied to a list query for meta, or 0
+// when the rows were not sampled.
+func sampleRatio(filter models.QueryLogFilter) float64 {
+	if filter.Sample >= 1 {
+		return 0
+	}
+	return filter.Sample
+}
+
+// parseOmit parses the omit parameter into the set of fields to leave out of
+// the full response, writing a 400 response if it is invalid. Each name must
+// be in ValidColumns and a field of the full QueryLog record; omit can't be
+// combined with columns, which already picks the fields.
+func parseOmit(c *gin.Context, columns string) (map[string]bool, bool) {
+	value := c.Query("omit")
+	if value == "" {
+		return nil, true
+	}
+	if columns != "" {
+		respondError(c, models.ErrCodeInvalidParams, "omit can't be combined with columns")
+		return nil, false
+	}
+
+	names, err := repository.ParseColumns(value)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidColumns, fmt.Sprintf("invalid omit: %v", err))
+		return nil, false
+	}
+	omit := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !models.IsQueryLogField(name) {
+			respondError(c, models.ErrCodeInvalidColumns, fmt.Sprintf("invalid omit: %s is not part of the full response; use columns to select it", name))
+			return nil, false
+		}
+		omit[name] = true
+	}
+	return omit, true
+}
+
+// toColumnar transposes dynamic rows into one value slice per column.
+func toColumnar(columns []string, rows []map[string]interface{}) map[string][]interface{} {
+	data := make(map[string][]interface{}, len(columns))
+	for _, col := range columns {
+		values := make([]interface{}, len(rows))
+		for i, row := range rows {
+			values[i] = row[col]
+		}
+		data[col] = values
+	}
+	return data
+}
+
+// flattenArrays replaces array values in dynamic rows with their CSV string form,
+// so JSON consumers see the same representation as the CSV export.
+func flattenArrays(rows []map[string]interface{}) {
+	for _, row := range rows {
+		for col, v := range row {
+			if arr, ok := v.([]string); ok {
+				row[col] = formatCSVValue(arr)
+			}
+		}
 	}
 }
 
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+// mockStore is a QueryLogStore returning canned results. Methods the tests
+// don't configure panic through the nil embedded interface.
+type mockStore struct {
+	repository.QueryLogStore
+
+	logs  []models.QueryLog
+	count uint64
+	err   error
+
+	// calls counts store reads; filter is the filter of the last one
+	calls  int
+	filter models.QueryLogFilter
+
+	threads    []models.QueryThread
+	threadsErr error
+	explain    []string
+	explainErr error
+	explained  int
+}
+
+func (m *mockStore) HasColumn(ctx context.Context, name string) (bool, error) { return true, nil }
+func (m *mockStore) AllowedDatabase(name string) bool                         { return true }
+func (m *mockStore) ValidShard(shard string) bool                             { return shard == "" }
+
+func (m *mockStore) GetQueryLogs(ctx context.Context, filter models.QueryLogFilter) ([]models.QueryLog, error) {
+	m.calls++
+	m.filter = filter
+	return m.logs, m.err
+}
+
+func (m *mockStore) CountQueryLogs(ctx context.Context, filter models.QueryLogFilter) (uint64, error) {
+	m.calls++
+	m.filter = filter
+	return m.count, m.err
+}
+
+func (m *mockStore) GetQueryLogByID(ctx context.Context, queryID string) (*models.QueryLog, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	for i := range m.logs {
+		if m.logs[i].QueryID == queryID {
+			log := m.logs[i]
+			return &log, nil
+		}
+	}
+	return nil, fmt.Errorf("query %s: %w", queryID, sql.ErrNoRows)
+}
+
+func (m *mockStore) FormatQuery(ctx context.Context, query string) (string, error) {
+	return query, nil
+}
+
+func (m *mockStore) GetProfileEvents(ctx context.Context, queryID string) (map[string]uint64, error) {
+	return map[string]uint64{"Query": 1}, nil
+}
+
+func (m *mockStore) GetQueryThreads(ctx context.Context, queryID string, since time.Time) ([]models.QueryThread, error) {
+	return m.threads, m.threadsErr
+}
+
+func (m *mockStore) ExplainQuery(ctx context.Context, query string) ([]string, error) {
+	m.explained++
+	return m.explain, m.explainErr
+}
+
+// mockAnnotations is an AnnotationStore returning no annotations, or err.
+type mockAnnotations struct {
+	err error
+}
+
+func (m *mockAnnotations) Add(ctx context.Context, annotation models.Annotation) (models.Annotation, error) {
+	return annotation, m.err
+}
+
+func (m *mockAnnotations) List(ctx context.Context, queryID string) ([]models.Annotation, error) {
+	return []models.Annotation{}, m.err
+}
+
+func newTestRouter(store *mockStore, annotations *mockAnnotations) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewQueryLogHandler(store, annotations, config.APIConfig{}, nil)
+	router := gin.New()
+	router.GET("/logs", h.GetQueryLogs)
+	router.GET("/logs/count", h.CountQueryLogs)
+	router.GET("/logs/:id", h.GetQueryLogByID)
+	router.GET("/logs/:id/bundle", h.GetQueryBundle)
+	return router
+}
+
+func serve(router *gin.Engine, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+// newDemoRouter returns a router serving the list, export, group-by and metrics
+// handlers from a demo repository generated at now. The handler is returned so
+// tests can read reference rows from h.repo or set up an export store.
+func newDemoRouter(now time.Time) (*gin.Engine, *QueryLogHandler) {
+	gin.SetMode(gin.TestMode)
+	h := NewQueryLogHandler(repository.NewDemoRepository(now, repository.Options{}), nil, config.APIConfig{}, nil)
+	router := gin.New()
+	router.GET("/logs", h.GetQueryLogs)
+	router.GET("/export", h.ExportCSV)
+	router.GET("/group-by", h.GetGroupedStats)
+	router.GET("/metrics", h.GetAggregatedMetrics)
+	router.GET("/metrics/export", h.ExportMetrics)
+	return router, h
+}
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+	var body models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+var testLogs = []models.QueryLog{
+	{QueryID: "q-1", Query: "SELECT 1", Type: "QueryFinish", User: "alice", EventTime: time.Date(2024, 1, 22, 10, 0, 0, 0, time.UTC), Databases: []string{"analytics"}, Tables: []string{}},
+	{QueryID: "q-2", Query: "SELEC 1", Type: "ExceptionBeforeStart", User: "alice", ExceptionCode: 62, EventTime: time.Date(2024, 1, 22, 9, 0, 0, 0, time.UTC), Databases: []string{}, Tables: []string{}},
+}
+
+func TestDatabaseErrorMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{name: "circuit open", err: fmt.Errorf("query: %w", database.ErrCircuitOpen), wantCode: models.ErrCodeDBUnavailable},
+		{name: "queue full", err: repository.ErrQueryQueueFull, wantCode: models.ErrCodeTooManyQueries},
+		{name: "request deadline", err: fmt.Errorf("failed to query query_log: %w", context.DeadlineExceeded), wantCode: models.ErrCodeTimeout},
+		{name: "max_execution_time", err: &clickhouse.Exception{Code: 159, Name: "TIMEOUT_EXCEEDED"}, wantCode: models.ErrCodeTimeout},
+		{name: "result too large over HTTP", err: errors.New("code: 396, message: Limit for result exceeded (TOO_MANY_ROWS_OR_BYTES)"), wantCode: models.ErrCodeResultTooLarge},
+		{name: "log not enabled", err: repository.ErrLogNotEnabled, wantCode: models.ErrCodeLogNotEnabled},
+		{name: "other failure", err: errors.New("connection reset by peer"), wantCode: models.ErrCodeDBError},
+	}
+
+	for _, tt := range tests {
+		for _, target := range []string{"/logs", "/logs/count", "/logs/q-1"} {
+			t.Run(tt.name+" "+target, func(t *testing.T) {
+				store := &mockStore{err: tt.err}
+				w := serve(newTestRouter(store, &mockAnnotations{}), target)
+
+				if want := models.ErrorStatus[tt.wantCode]; w.Code != want {
+					t.Errorf("status = %d, want %d", w.Code, want)
+				}
+				if body := decodeError(t, w); body.Error != tt.wantCode || body.Message == "" {
+					t.Errorf("body = %+v, want code %q with a message", body, tt.wantCode)
+				}
+			})
+		}
+	}
+}
+
+func TestGetQueryLogsResponse(t *testing.T) {
+	store := &mockStore{logs: testLogs}
+	w := serve(newTestRouter(store, &mockAnnotations{}), "/logs?user=alice&limit=2&offset=4&start_time=2024-01-22T00:00:00Z")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data []models.QueryLog `json:"data"`
+		Meta models.ListMeta   `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Data) != 2 || body.Data[0].QueryID != "q-1" || body.Data[1].ExceptionCode != 62 {
+		t.Errorf("data = %+v, want the store's rows in order", body.Data)
+	}
+	if want := (models.Pagination{Limit: 2, Offset: 4, Count: 2}); body.Meta.Pagination != want {
+		t.Errorf("pagination = %+v, want %+v", body.Meta.Pagination, want)
+	}
+
+	// The bound filter reaches the store
+	if store.filter.User != "alice" || store.filter.Limit != 2 || store.filter.Offset != 4 {
+		t.Errorf("filter = %+v, want user alice, limit 2, offset 4", store.filter)
+	}
+	if store.filter.StartTime == nil || !store.filter.StartTime.Equal(time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("start time = %v, want 2024-01-22T00:00:00Z", store.filter.StartTime)
+	}
+}
+
+func TestCountQueryLogsResponse(t *testing.T) {
+	store := &mockStore{count: 1234}
+	w := serve(newTestRouter(store, &mockAnnotations{}), "/logs/count?only_failed=true&start_time=2024-01-22T00:00:00Z")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data struct {
+			Count uint64 `json:"count"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Data.Count != 1234 {
+		t.Errorf("count = %d, want 1234", body.Data.Count)
+	}
+	if !store.filter.OnlyFailed {
+		t.Error("only_failed did not reach the store")
+	}
+}
+
+// TestInvalidParameters checks that malformed requests are rejected with 400
+// before the store is queried.
+func TestInvalidParameters(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantCode string
+	}{
+		{target: "/logs?tz=Mars/Olympus", wantCode: models.ErrCodeInvalidTimezone},
+		{target: "/logs?start_time=yesterday", wantCode: models.ErrCodeInvalidParams},
+		{target: "/logs?type=QueryFinish&only_failed=true", wantCode: models.ErrCodeConflictingFilters},
+		{target: "/logs?type=QueryStart", wantCode: models.ErrCodeInvalidParams},
+		{target: "/logs?sort_by=password", wantCode: models.ErrCodeInvalidSort},
+		{target: "/logs?columns=password", wantCode: models.ErrCodeInvalidColumns},
+		{target: "/logs?shard=evil:9000", wantCode: models.ErrCodeInvalidShard},
+		{target: "/logs/count?exception_codes=1,x", wantCode: models.ErrCodeInvalidParams},
+		{target: "/logs/q-1?tz=Nowhere", wantCode: models.ErrCodeInvalidTimezone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			store := &mockStore{logs: testLogs}
+			w := serve(newTestRouter(store, &mockAnnotations{}), tt.target)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (body %s)", w.Code, w.Body.String())
+			}
+			if body := decodeError(t, w); body.Error != tt.wantCode {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+			}
+			if store.calls != 0 {
+				t.Errorf("store was queried %d times for an invalid request", store.calls)
+			}
+		})
+	}
+}
+
+func TestGetQueryLogByID(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		annotations *mockAnnotations
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "found", id: "q-1", annotations: &mockAnnotations{}, wantStatus: http.StatusOK},
+		{name: "not found", id: "missing", annotations: &mockAnnotations{}, wantStatus: http.StatusNotFound, wantCode: models.ErrCodeNotFound},
+		{name: "annotation store is not read", id: "q-1", annotations: &mockAnnotations{err: errors.New("disk full")}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(newTestRouter(&mockStore{logs: testLogs}, tt.annotations), "/logs/"+tt.id)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				if body := decodeError(t, w); body.Error != tt.wantCode {
+					t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+				}
+				return
+			}
+
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Data["query_id"] != tt.id {
+				t.Errorf("query_id = %v, want %q", body.Data["query_id"], tt.id)
+			}
+			if _, ok := body.Data["annotations"]; ok {
+				t.Error("detail carries annotations, which would be hidden by the immutable cache")
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("missing ETag header")
+			}
+		})
+	}
+}
+
+// TestGetQueryBundle checks that the bundle carries threads and EXPLAIN output
+// and that every section it couldn't gather is reported in warnings.
+func TestGetQueryBundle(t *testing.T) {
+	threads := []models.QueryThread{{ThreadName: "QueryPipelineEx", ThreadID: 7, QueryDurationMs: 120}}
+	logs := append(slices.Clone(testLogs),
+		models.QueryLog{QueryID: "q-3", Query: "INSERT INTO t VALUES (1)", Type: "QueryFinish", Databases: []string{}, Tables: []string{}},
+		models.QueryLog{QueryID: "q-4", Query: "SELECT * FROM url('http://10.0.0.1/data.csv', CSV)", Type: "QueryFinish", Databases: []string{}, Tables: []string{}},
+	)
+
+	tests := []struct {
+		name          string
+		id            string
+		store         *mockStore
+		wantThreads   int
+		wantExplain   int
+		wantExplained bool
+		wantWarnings  []string
+	}{
+		{
+			name:          "everything available",
+			id:            "q-1",
+			store:         &mockStore{threads: threads, explain: []string{"Expression ((Projection + Before ORDER BY))", "  ReadFromStorage (SystemOne)"}},
+			wantThreads:   1,
+			wantExplain:   2,
+			wantExplained: true,
+		},
+		{
+			name:          "thread log disabled",
+			id:            "q-1",
+			store:         &mockStore{threadsErr: fmt.Errorf("query_thread_log: %w", repository.ErrLogNotEnabled), explain: []string{"Expression"}},
+			wantExplain:   1,
+			wantExplained: true,
+			wantWarnings:  []string{"threads: system.query_thread_log is not enabled on the server"},
+		},
+		{
+			name:          "no thread rows and explain failing",
+			id:            "q-1",
+			store:         &mockStore{threads: []models.QueryThread{}, explainErr: errors.New("code: 60, UNKNOWN_TABLE")},
+			wantExplained: true,
+			wantWarnings: []string{
+				"threads: query_thread_log has no rows for this query (log_query_threads may be disabled)",
+				"explain: code: 60, UNKNOWN_TABLE",
+			},
+		},
+		{
+			name:         "insert is not explained",
+			id:           "q-3",
+			store:        &mockStore{threads: threads},
+			wantThreads:  1,
+			wantWarnings: []string{"explain: skipped: only SELECT queries are explained"},
+		},
+		{
+			name:         "table function is not explained",
+			id:           "q-4",
+			store:        &mockStore{threads: threads},
+			wantThreads:  1,
+			wantWarnings: []string{"explain: skipped: query uses table function url()"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.logs = logs
+			w := serve(newTestRouter(tt.store, &mockAnnotations{}), "/logs/"+tt.id+"/bundle")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+
+			var body struct {
+				Data     models.QueryBundle `json:"data"`
+				Warnings []string           `json:"warnings"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Data.Threads == nil || len(body.Data.Threads) != tt.wantThreads {
+				t.Errorf("threads = %v, want %d", body.Data.Threads, tt.wantThreads)
+			}
+			if body.Data.Explain == nil || len(body.Data.Explain) != tt.wantExplain {
+				t.Errorf("explain = %v, want %d lines", body.Data.Explain, tt.wantExplain)
+			}
+			if explained := tt.store.explained > 0; explained != tt.wantExplained {
+				t.Errorf("EXPLAIN run = %v, want %v", explained, tt.wantExplained)
+			}
+			if !slices.Equal(body.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", body.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestGetQueryLogByIDCacheControl(t *testing.T) {
+	const immutable = "private, max-age=86400, immutable"
+	logs := append(slices.Clone(testLogs), models.QueryLog{QueryID: "q-running", Query: "SELECT sleep(3)", Type: "QueryStart", Databases: []string{}, Tables: []string{}})
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "q-1", want: immutable},
+		{id: "q-2", want: immutable},
+		{id: "q-running", want: "private, no-cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			router := newTestRouter(&mockStore{logs: logs}, &mockAnnotations{})
+			w := serve(router, "/logs/"+tt.id)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+
+			// A revalidation answered with 304 carries the same policy
+			req := httptest.NewRequest(http.MethodGet, "/logs/"+tt.id, nil)
+			req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			revalidated := httptest.NewRecorder()
+			router.ServeHTTP(revalidated, req)
+			if revalidated.Code != http.StatusNotModified {
+				t.Fatalf("revalidation status = %d, want 304", revalidated.Code)
+			}
+			if got := revalidated.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("304 Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
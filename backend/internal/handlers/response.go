@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/middleware"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// respondData writes a 200 response using the standard success envelope:
+//
+//	{"data": ..., "meta": {...}}
+//
+// meta is omitted when nil. Endpoints returning lists always respond 200 with
+// "data": [] when nothing matches, never null or 204; repositories initialize
+// their result slices so empty results serialize as [].
+//
+// Endpoints that combine several independent queries (currently the dashboard)
+// use a partial-success contract: they respond 200 with the parts that
+// succeeded in data and an "errors" object in meta mapping each failed part to
+// a message. Parts are queried with an errgroup whose goroutines record their
+// error instead of returning it, so one failure doesn't cancel the rest. Only
+// when every part fails is the request answered with an error response.
+//
+// With ?string_numbers=true, integers in data are
+// written as strings so JavaScript clients don't lose precision above 2^53.
+// With ?include_meta=true, meta also reports the ClickHouse settings applied to
+// the request's queries under "settings" (empty when served from a cache).
+// Warnings recorded with addWarning are included as "warnings".
+func respondData(c *gin.Context, data interface{}, meta interface{}) {
+	if stringNumbersRequested(c) {
+		data = stringifyIntegers(data)
+	}
+	if c.GetBool(middleware.IncludeMetaKey) {
+		meta = withSettings(meta, database.AppliedSettings(c.Request.Context()))
+	}
+	render(c, http.StatusOK, models.Response{Data: data, Meta: meta, Warnings: requestWarnings(c)})
+}
+
+// respondCreated writes a 201 response using the standard success envelope.
+func respondCreated(c *gin.Context, data interface{}) {
+	render(c, http.StatusCreated, models.Response{Data: data})
+}
+
+// respondError writes an error response using the standard error envelope:
+//
+//	{"error": "machine_readable_code", "message": "Human readable message"}
+//
+// code is one of the models.ErrCode constants; the HTTP status is taken from
+// models.ErrorStatus so a code is always sent with the same status.
+func respondError(c *gin.Context, code string, message string) {
+	render(c, errorStatus(code), models.ErrorResponse{Error: code, Message: message})
+}
+
+// errorStatus returns the HTTP status for code, or 500 for an unknown code.
+func errorStatus(code string) int {
+	if status, ok := models.ErrorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// render writes obj as JSON, indented when the request asked for pretty output.
+// Compact JSON is the default for performance.
+func render(c *gin.Context, status int, obj interface{}) {
+	if c.GetBool(middleware.PrettyJSONKey) {
+		c.IndentedJSON(status, obj)
+		return
+	}
+	c.JSON(status, obj)
+}
+
+// withSettings returns meta as a JSON object with an added "settings" field.
+// meta is round-tripped through JSON so any meta type can be extended; it is
+// returned unchanged if it doesn't encode to an object.
+func withSettings(meta interface{}, settings map[string]interface{}) interface{} {
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+
+	extended := map[string]interface{}{}
+	if meta != nil {
+		encoded, err := json.Marshal(meta)
+		if err != nil {
+			return meta
+		}
+		if err := json.Unmarshal(encoded, &extended); err != nil {
+			return meta
+		}
+	}
+	extended["settings"] = settings
+	return extended
+}
+
+// stringNumbersRequested reports whether the request asked for integers as strings.
+func stringNumbersRequested(c *gin.Context) bool {
+	requested, err := strconv.ParseBool(c.Query("string_numbers"))
+	return err == nil && requested
+}
+
+// stringifyIntegers round-trips data through JSON and replaces the value of
+// every integer-typed Go field, map entry or element with its decimal string.
+// Which values to convert is decided from the Go types in data, not the encoded
+// text, so a float that happens to be whole (an error_rate of 0) stays a number.
+// All integers are converted, not just large ones, so a field keeps the same
+// JSON type in every row. data is returned unchanged if it cannot be re-encoded.
+func stringifyIntegers(data interface{}) interface{} {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return data
+	}
+	return stringifyNumbers(reflect.ValueOf(data), decoded)
+}
+
+// stringifyNumbers walks v and its decoded JSON encoding side by side and
+// replaces the json.Number of every integer-kinded value in v with a string.
+func stringifyNumbers(v reflect.Value, decoded interface{}) interface{} {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return decoded
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := decoded.(json.Number); ok {
+			return n.String()
+		}
+	case reflect.Struct:
+		if obj, ok := decoded.(map[string]interface{}); ok {
+			stringifyFields(v, obj)
+		}
+	case reflect.Map:
+		obj, ok := decoded.(map[string]interface{})
+		if !ok {
+			break
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if item, ok := obj[key]; ok {
+				obj[key] = stringifyNumbers(iter.Value(), item)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := decoded.([]interface{})
+		if !ok || len(arr) != v.Len() {
+			break
+		}
+		for i := range arr {
+			arr[i] = stringifyNumbers(v.Index(i), arr[i])
+		}
+	}
+	return decoded
+}
+
+// stringifyFields converts the integer fields of struct v in its decoded JSON
+// object obj, following the names encoding/json gives them. Fields of embedded
+// structs without a JSON name are promoted into obj as encoding/json does.
+func stringifyFields(v reflect.Value, obj map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				stringifyFields(embedded, obj)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if item, ok := obj[name]; ok {
+			obj[name] = stringifyNumbers(v.Field(i), item)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestStringifyIntegers(t *testing.T) {
+	bucket := time.Date(2024, 1, 22, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{
+			name: "whole floats stay numbers",
+			data: []models.QueryLogMetrics{
+				{TimeBucket: bucket, TotalQueries: 15, FailedQueries: 0, ErrorRate: 0, AvgDurationMs: 12},
+				{TimeBucket: bucket, TotalQueries: 15, FailedQueries: 2, ErrorRate: 0.1333, AvgDurationMs: 12.5},
+			},
+			want: `[
+				{"time_bucket":"2024-01-22T10:00:00Z","total_queries":"15","avg_duration_ms":12,"max_duration_ms":"0","avg_memory_usage":0,"max_memory_usage":"0","max_peak_memory_usage":"0","total_read_bytes":"0","total_written_bytes":"0","failed_queries":"0","error_rate":0,"queries_per_second":0},
+				{"time_bucket":"2024-01-22T10:00:00Z","total_queries":"15","avg_duration_ms":12.5,"max_duration_ms":"0","avg_memory_usage":0,"max_memory_usage":"0","max_peak_memory_usage":"0","total_read_bytes":"0","total_written_bytes":"0","failed_queries":"2","error_rate":0.1333,"queries_per_second":0}
+			]`,
+		},
+		{
+			name: "large unsigned integer keeps its digits",
+			data: map[string]interface{}{"read_bytes": uint64(18446744073709551615), "ratio": float64(3)},
+			want: `{"read_bytes":"18446744073709551615","ratio":3}`,
+		},
+		{
+			name: "dynamic rows by value type",
+			data: []map[string]interface{}{
+				{"query_id": "q-1", "read_rows": uint64(10), "query_duration_s": float64(1), "interface": models.EnumValue{Raw: 1, Label: "TCP"}},
+				{"query_id": "q-2", "read_rows": uint64(0), "query_duration_s": 0.25, "interface": models.EnumValue{Raw: 2, Label: "HTTP"}},
+			},
+			want: `[
+				{"query_id":"q-1","read_rows":"10","query_duration_s":1,"interface":{"raw":"1","label":"TCP"}},
+				{"query_id":"q-2","read_rows":"0","query_duration_s":0.25,"interface":{"raw":"2","label":"HTTP"}}
+			]`,
+		},
+		{
+			name: "embedded struct through custom marshaler",
+			data: models.TrimQueryLogs([]models.QueryLog{{QueryID: "q-1", ReadRows: 42, ExceptionCode: 62}}, omitAllBut("query_id", "read_rows", "exception_code")),
+			want: `[{"query_id":"q-1","read_rows":"42","exception_code":"62"}]`,
+		},
+		{
+			name: "integer slices and pointers",
+			data: struct {
+				Codes []int32 `json:"codes"`
+				Limit *int    `json:"limit"`
+				None  *int    `json:"none"`
+				Raw   []byte  `json:"raw"`
+			}{Codes: []int32{60, 62}, Limit: intPtr(5), Raw: []byte{1}},
+			want: `{"codes":["60","62"],"limit":"5","none":null,"raw":"AQ=="}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(stringifyIntegers(tt.data))
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatalf("bad want: %v", err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// omitAllBut returns an Omit set covering every QueryLog field except keep.
+func omitAllBut(keep ...string) map[string]bool {
+	encoded, _ := json.Marshal(models.QueryLog{})
+	var fields map[string]interface{}
+	_ = json.Unmarshal(encoded, &fields)
+
+	omit := make(map[string]bool, len(fields))
+	for name := range fields {
+		omit[name] = true
+	}
+	for _, name := range keep {
+		delete(omit, name)
+	}
+	return omit
+}
+
+func intPtr(v int) *int { return &v }
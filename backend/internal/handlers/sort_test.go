@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestSortByRejected(t *testing.T) {
+	router, _ := newDemoRouter(time.Now())
+
+	tests := []struct {
+		name       string
+		path       string
+		sortBy     string
+		sortOrder  string
+		wantStatus int
+	}{
+		{name: "export injection", path: "/export?columns=query_id,query", sortBy: "1;DROP TABLE system.query_log", wantStatus: http.StatusBadRequest},
+		{name: "export expression", path: "/export?columns=query_id", sortBy: "sleep(3)", wantStatus: http.StatusBadRequest},
+		{name: "export unsortable column", path: "/export?columns=query_id", sortBy: "query", wantStatus: http.StatusBadRequest},
+		{name: "export bad order", path: "/export?columns=query_id", sortBy: "event_time", sortOrder: "asc;DROP", wantStatus: http.StatusBadRequest},
+		{name: "list with columns injection", path: "/logs?columns=query_id", sortBy: "event_time DESC, (SELECT 1)", wantStatus: http.StatusBadRequest},
+		{name: "list injection", path: "/logs?limit=1", sortBy: "1;DROP TABLE x", wantStatus: http.StatusBadRequest},
+		{name: "export allowed", path: "/export?columns=query_id,read_rows", sortBy: "read_rows", sortOrder: "asc", wantStatus: http.StatusOK},
+		{name: "list allowed", path: "/logs?columns=query_id&limit=1", sortBy: "query_duration_ms", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.path + "&sort_by=" + url.QueryEscape(tt.sortBy)
+			if tt.sortOrder != "" {
+				target += "&sort_order=" + url.QueryEscape(tt.sortOrder)
+			}
+			w := serve(router, target)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+			if body := decodeError(t, w); body.Error != models.ErrCodeInvalidSort {
+				t.Errorf("error = %q, want %q", body.Error, models.ErrCodeInvalidSort)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// GetQueryViews handles GET /api/v1/views
+//
+// Returns materialized view executions from system.query_views_log, newest
+// first. The log must be enabled on the server (log_query_views = 1).
+//
+// Query Parameters:
+//   - start_time, end_time, tz: Time range, parsed like GetQueryLogs
+//   - query_id: Filter by the triggering INSERT's query_id
+//   - view_name: Filter by view name as database.view (exact match)
+//   - only_failed: If "true", return only view executions that raised an exception
+//   - min_duration_ms: Filter executions that took at least this many milliseconds
+//   - include_query: If "true", include the triggering INSERT's text from query_log
+//   - limit: Maximum number of results (default: 100, max: 1000)
+//   - offset: Number of results to skip for pagination
+//
+// Response:
+//
+//	{
+//	  "data": [
+//	    {
+//	      "event_time": "2024-01-22T10:30:00Z",
+//	      "initial_query_id": "abc-123",
+//	      "view_name": "default.events_mv",
+//	      "view_type": "Materialized",
+//	      "view_target": "default.events_daily",
+//	      "view_duration_ms": 12,
+//	      "read_rows": 1000,
+//	      "read_bytes": 64000,
+//	      "written_rows": 10,
+//	      "written_bytes": 640,
+//	      "peak_memory_usage": 4194304,
+//	      "status": "QueryFinish",
+//	      "exception_code": 0,
+//	      "exception": ""
+//	    }
+//	  ],
+//	  "meta": {
+//	    "pagination": {"limit": 100, "offset": 0, "count": 1}
+//	  }
+//	}
+func (h *QueryLogHandler) GetQueryViews(c *gin.Context) {
+	var filter models.QueryViewFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, err.Error())
+		return
+	}
+
+	loc, err := loadLocation(filter.TZ)
+	if err != nil {
+		respondError(c, models.ErrCodeInvalidTimezone, err.Error())
+		return
+	}
+
+	if filter.StartTime, err = parseTimeParam(c.Query("start_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid start_time: %v", err))
+		return
+	}
+
+	if filter.EndTime, err = parseTimeParam(c.Query("end_time"), loc); err != nil {
+		respondError(c, models.ErrCodeInvalidParams, fmt.Sprintf("invalid end_time: %v", err))
+		return
+	}
+
+	limit := effectiveLimit(c, filter.Limit)
+	filter.Offset = effectiveOffset(c, filter.Offset)
+
+	views, err := h.repo.GetQueryViews(c.Request.Context(), filter)
+	if err != nil {
+		writeDatabaseError(c, err, "Failed to retrieve view executions")
+		return
+	}
+	for i := range views {
+		views[i].EventTime = views[i].EventTime.In(loc)
+	}
+
+	respondData(c, views, models.ListMeta{
+		Pagination: models.Pagination{
+			Limit:  limit,
+			Offset: filter.Offset,
+			Count:  len(views),
+		},
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+// warningsKey is the gin context key collecting the request's warnings.
+const warningsKey = "warnings"
+
+// addWarning records an adjustment the server made to the request, such as a
+// clamped limit. Warnings are returned in the response's "warnings" array.
+func addWarning(c *gin.Context, format string, args ...interface{}) {
+	var warnings []string
+	if existing, ok := c.Get(warningsKey); ok {
+		warnings = existing.([]string)
+	}
+	c.Set(warningsKey, append(warnings, fmt.Sprintf(format, args...)))
+}
+
+// requestWarnings returns the warnings recorded for the request, if any.
+func requestWarnings(c *gin.Context) []string {
+	if warnings, ok := c.Get(warningsKey); ok {
+		return warnings.([]string)
+	}
+	return nil
+}
+
+// effectiveLimit returns the limit the repository will apply, warning when the
+// requested value was clamped or replaced by the default.
+func effectiveLimit(c *gin.Context, limit int) int {
+	switch {
+	case limit < 0:
+		addWarning(c, "limit %d is invalid, using %d", limit, repository.DefaultLimit)
+		return repository.DefaultLimit
+	case limit == 0:
+		return repository.DefaultLimit
+	case limit > repository.MaxLimit:
+		addWarning(c, "limit clamped from %d to %d", limit, repository.MaxLimit)
+		return repository.MaxLimit
+	}
+	return limit
+}
+
+// effectiveOffset returns the offset to apply, warning when a negative value
+// was replaced by 0.
+func effectiveOffset(c *gin.Context, offset int) int {
+	if offset < 0 {
+		addWarning(c, "offset %d is invalid, using 0", offset)
+		return 0
+	}
+	return offset
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// APIKeyHeader is the request header carrying the API key.
+const APIKeyHeader = "X-API-Key"
+
+// RequireAPIKey rejects requests whose X-API-Key header does not match key.
+// If key is empty, every request is rejected, so routes behind it are disabled
+// unless a key has been configured.
+func RequireAPIKey(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			c.AbortWithStatusJSON(models.ErrorStatus[models.ErrCodeForbidden], models.ErrorResponse{
+				Error:   models.ErrCodeForbidden,
+				Message: "Admin endpoints are disabled (ADMIN_API_KEY is not set)",
+			})
+			return
+		}
+
+		provided := c.GetHeader(APIKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+			c.AbortWithStatusJSON(models.ErrorStatus[models.ErrCodeUnauthorized], models.ErrorResponse{
+				Error:   models.ErrCodeUnauthorized,
+				Message: "Missing or invalid API key",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// ErrorLog is a fixed-size ring buffer of recent internal errors. It is safe
+// for concurrent use.
+type ErrorLog struct {
+	mu     sync.Mutex
+	events []models.ErrorEvent
+	next   int
+	full   bool
+}
+
+// NewErrorLog creates an ErrorLog keeping the last size events. It returns
+// nil when size is 0, which disables recording.
+func NewErrorLog(size int) *ErrorLog {
+	if size <= 0 {
+		return nil
+	}
+	return &ErrorLog{events: make([]models.ErrorEvent, size)}
+}
+
+// Add records an event, overwriting the oldest one when the buffer is full.
+func (l *ErrorLog) Add(event models.ErrorEvent) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the recorded events, newest first.
+func (l *ErrorLog) Recent() []models.ErrorEvent {
+	recent := make([]models.ErrorEvent, 0)
+	if l == nil {
+		return recent
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.events)
+	}
+	for i := 1; i <= count; i++ {
+		recent = append(recent, l.events[(l.next-i+len(l.events))%len(l.events)])
+	}
+	return recent
+}
+
+// RecordErrors records requests that end with a 5xx status or panic into
+// errorLog. Handlers attach the underlying error with c.Error; panics are
+// re-raised for gin's Recovery middleware to answer.
+func RecordErrors(errorLog *ErrorLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if errorLog == nil {
+			c.Next()
+			return
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				event := newErrorEvent(c, http.StatusInternalServerError, fmt.Sprint(r))
+				event.Panic = true
+				errorLog.Add(event)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			message := http.StatusText(status)
+			if len(c.Errors) > 0 {
+				messages := make([]string, len(c.Errors))
+				for i, err := range c.Errors {
+					messages[i] = err.Error()
+				}
+				message = strings.Join(messages, "; ")
+			}
+			errorLog.Add(newErrorEvent(c, status, message))
+		}
+	}
+}
+
+// newErrorEvent describes the current request for the error log.
+func newErrorEvent(c *gin.Context, status int, message string) models.ErrorEvent {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return models.ErrorEvent{
+		Time:      time.Now().UTC(),
+		Method:    c.Request.Method,
+		Route:     route,
+		Status:    status,
+		Error:     message,
+		RequestID: c.GetHeader("X-Request-ID"),
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+)
+
+// IncludeMetaKey is the context key set to true when the response meta should
+// report the ClickHouse settings applied to the request's queries.
+const IncludeMetaKey = "include_meta"
+
+// IncludeMeta records the ClickHouse settings used by requests with
+// ?include_meta=true so handlers can report them in the response meta.
+func IncludeMeta() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if include, err := strconv.ParseBool(c.Query("include_meta")); err == nil && include {
+			c.Set(IncludeMetaKey, true)
+			c.Request = c.Request.WithContext(database.WithSettingsRecorder(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
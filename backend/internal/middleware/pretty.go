@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrettyJSONKey is the context key set to true when JSON responses should be indented.
+const PrettyJSONKey = "pretty_json"
+
+// PrettyJSON marks requests whose JSON responses should be indented.
+// The pretty query parameter overrides the server-wide default.
+func PrettyJSON(defaultPretty bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pretty := defaultPretty
+		if value, ok := c.GetQuery("pretty"); ok {
+			if parsed, err := strconv.ParseBool(value); err == nil {
+				pretty = parsed
+			}
+		}
+		c.Set(PrettyJSONKey, pretty)
+		c.Next()
+	}
+}
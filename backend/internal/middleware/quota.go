@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+const (
+	// QuotaWindow is the sliding window API key quotas are counted over.
+	QuotaWindow = 24 * time.Hour
+
+	// quotaSlots is how many slots the window is split into. Usage is counted
+	// per slot, so requests leave the window an hour's worth at a time.
+	quotaSlots = 24
+	quotaSlot  = QuotaWindow / quotaSlots
+)
+
+// Quotas enforces the API_KEY_QUOTAS request quotas of the live config over a
+// sliding QuotaWindow. It is safe for concurrent use. Usage is kept in memory,
+// so it is per process and starts over on restart; it survives reloads, so a
+// changed limit applies to the requests already counted.
+type Quotas struct {
+	live *config.LiveConfig
+
+	mu    sync.Mutex
+	usage map[string]*quotaCounter
+
+	// unauthorized counts requests rejected for a missing or unknown key
+	unauthorized atomic.Uint64
+}
+
+// quotaCounter is a ring of per-slot request counts for one key.
+type quotaCounter struct {
+	counts   [quotaSlots]int
+	slots    [quotaSlots]int64 // slot number (since the epoch) each count belongs to
+	allowed  uint64
+	rejected uint64
+}
+
+// NewQuotas creates a Quotas that reads the limits from live on every request,
+// so keys and limits changed by POST /admin/reload take effect immediately.
+func NewQuotas(live *config.LiveConfig) *Quotas {
+	return &Quotas{live: live, usage: make(map[string]*quotaCounter)}
+}
+
+// enabled reports whether any quotas are configured.
+func (q *Quotas) enabled() bool {
+	return len(q.live.Load().KeyQuotas) > 0
+}
+
+// counter returns the counter of key, creating it on the key's first request.
+// q.mu must be held.
+func (q *Quotas) counter(key string) *quotaCounter {
+	counter, ok := q.usage[key]
+	if !ok {
+		counter = &quotaCounter{}
+		q.usage[key] = counter
+	}
+	return counter
+}
+
+// Allow counts a request by key against its quota and reports whether it may
+// proceed, along with the resulting usage. Keys without a quota are always
+// allowed and reported as not metered.
+func (q *Quotas) Allow(key string, now time.Time) (usage models.QuotaUsage, allowed, metered bool) {
+	limit, ok := q.live.Load().KeyQuotas[key]
+	if !ok {
+		return models.QuotaUsage{}, true, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	counter := q.counter(key)
+	slot := now.UnixNano() / int64(quotaSlot)
+	if counter.used(slot) >= limit {
+		counter.rejected++
+		return counter.snapshot(key, limit, slot), false, true
+	}
+	i := slot % quotaSlots
+	if counter.slots[i] != slot {
+		counter.slots[i], counter.counts[i] = slot, 0
+	}
+	counter.counts[i]++
+	counter.allowed++
+	return counter.snapshot(key, limit, slot), true, true
+}
+
+// Usage returns the current usage of every configured key, ordered by key.
+// Keys removed from the config by a reload are not reported.
+func (q *Quotas) Usage(now time.Time) []models.QuotaUsage {
+	usage, _ := q.usageWithAllowed(now)
+	return usage
+}
+
+// usageWithAllowed returns Usage along with the requests each key was allowed
+// since startup, indexed like the usage.
+func (q *Quotas) usageWithAllowed(now time.Time) ([]models.QuotaUsage, []uint64) {
+	limits := q.live.Load().KeyQuotas
+	keys := make([]string, 0, len(limits))
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	usage := make([]models.QuotaUsage, 0, len(keys))
+	allowed := make([]uint64, 0, len(keys))
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	slot := now.UnixNano() / int64(quotaSlot)
+	for _, key := range keys {
+		counter := q.counter(key)
+		usage = append(usage, counter.snapshot(key, limits[key], slot))
+		allowed = append(allowed, counter.allowed)
+	}
+	return usage, allowed
+}
+
+// WriteMetrics writes the quota counters of the configured keys in the
+// Prometheus text exposition format, labelled by masked key. It writes only the
+// unauthorized counter when no quotas are configured.
+func (q *Quotas) WriteMetrics(w io.Writer, now time.Time) error {
+	usage, allowed := q.usageWithAllowed(now)
+
+	metrics := []struct {
+		name, help, typ string
+		value           func(i int) string
+	}{
+		{"quota_limit", "Requests the API key may make per sliding 24 hours.", "gauge",
+			func(i int) string { return strconv.Itoa(usage[i].Limit) }},
+		{"quota_used", "Requests the API key made in the current 24 hour window.", "gauge",
+			func(i int) string { return strconv.Itoa(usage[i].Used) }},
+		{"quota_remaining", "Requests the API key has left in the current 24 hour window.", "gauge",
+			func(i int) string { return strconv.Itoa(usage[i].Remaining) }},
+		{"quota_requests_total", "Requests counted against the API key's quota since startup.", "counter",
+			func(i int) string { return strconv.FormatUint(allowed[i], 10) }},
+		{"quota_rejected_total", "Requests rejected with 429 quota_exceeded since startup.", "counter",
+			func(i int) string { return strconv.FormatUint(usage[i].Rejected, 10) }},
+	}
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, m.name, m.help, metricsPrefix, m.name, m.typ)
+		for i, u := range usage {
+			fmt.Fprintf(&b, "%s%s{key=%q} %s\n", metricsPrefix, m.name, u.Key, m.value(i))
+		}
+	}
+	fmt.Fprintf(&b, "# HELP %squota_unauthorized_total Requests rejected with 401 for a missing or unknown API key since startup.\n", metricsPrefix)
+	fmt.Fprintf(&b, "# TYPE %squota_unauthorized_total counter\n", metricsPrefix)
+	fmt.Fprintf(&b, "%squota_unauthorized_total %d\n", metricsPrefix, q.unauthorized.Load())
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricsPrefix namespaces the metrics written by WriteMetrics.
+const metricsPrefix = "clickhouse_monitoring_"
+
+// used sums the counts of the slots still inside the window ending at slot.
+func (c *quotaCounter) used(slot int64) int {
+	total := 0
+	for i, s := range c.slots {
+		if s > slot-quotaSlots {
+			total += c.counts[i]
+		}
+	}
+	return total
+}
+
+// snapshot describes the counter as of slot.
+func (c *quotaCounter) snapshot(key string, limit int, slot int64) models.QuotaUsage {
+	used := c.used(slot)
+	usage := models.QuotaUsage{
+		Key:       models.MaskAPIKey(key),
+		Limit:     limit,
+		Used:      used,
+		Remaining: max(limit-used, 0),
+		Rejected:  c.rejected,
+		Window:    QuotaWindow.String(),
+	}
+
+	// The oldest slot with requests frees its share once it leaves the window
+	oldest := int64(math.MaxInt64)
+	for i, s := range c.slots {
+		if s > slot-quotaSlots && c.counts[i] > 0 && s < oldest {
+			oldest = s
+		}
+	}
+	if oldest != math.MaxInt64 {
+		resetAt := time.Unix(0, (oldest+quotaSlots)*int64(quotaSlot)).UTC()
+		usage.ResetAt = &resetAt
+	}
+	return usage
+}
+
+// EnforceQuotas counts each request against the quota of its X-API-Key and
+// answers 429 quota_exceeded once the key's quota is used up, with Retry-After
+// set to when the oldest counted requests leave the window. Metered responses
+// carry X-Quota-Limit and X-Quota-Remaining.
+//
+// With quotas configured every request must identify itself: requests with a
+// missing or unknown key get 401, except those sending the admin key or a
+// valid signed export URL (see RequireSignedURL), which pass unmetered since
+// both are issued by the operator. While no quotas are configured every request
+// passes through.
+func EnforceQuotas(quotas *Quotas, adminKey, signingSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !quotas.enabled() {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		provided := c.GetHeader(APIKeyHeader)
+		usage, allowed, metered := quotas.Allow(provided, now)
+		if !metered {
+			if adminKey != "" && provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) == 1 {
+				c.Next()
+				return
+			}
+			if provided == "" && signingSecret != "" && verifyQuery(signingSecret, c.Request.URL.Path, c.Request.URL.Query(), now) == nil {
+				c.Next()
+				return
+			}
+			quotas.unauthorized.Add(1)
+			c.AbortWithStatusJSON(models.ErrorStatus[models.ErrCodeUnauthorized], models.ErrorResponse{
+				Error:   models.ErrCodeUnauthorized,
+				Message: "Missing or invalid API key; API_KEY_QUOTAS requires a listed key in X-API-Key",
+			})
+			return
+		}
+
+		c.Header("X-Quota-Limit", strconv.Itoa(usage.Limit))
+		c.Header("X-Quota-Remaining", strconv.Itoa(usage.Remaining))
+		if allowed {
+			c.Next()
+			return
+		}
+
+		if usage.ResetAt != nil {
+			retryAfter := int(math.Ceil(usage.ResetAt.Sub(now).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		}
+		c.AbortWithStatusJSON(models.ErrorStatus[models.ErrCodeQuotaExceeded], models.QuotaErrorResponse{
+			ErrorResponse: models.ErrorResponse{
+				Error:   models.ErrCodeQuotaExceeded,
+				Message: fmt.Sprintf("API key quota of %d requests per 24 hours exhausted", usage.Limit),
+			},
+			Quota: usage,
+		})
+	}
+}
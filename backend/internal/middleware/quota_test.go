@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+)
+
+func TestEnforceQuotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		adminKey = "admin-secret-key"
+		secret   = "signing-secret"
+	)
+	quotas := NewQuotas(config.NewLiveConfig(&config.RuntimeConfig{KeyQuotas: map[string]int{"team-alpha": 2}}))
+	router := gin.New()
+	router.GET("/api/v1/logs/export", EnforceQuotas(quotas, adminKey, secret), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	signed := SignQuery(secret, "/api/v1/logs/export", url.Values{"limit": {"10"}}, time.Now().Add(time.Minute)).Encode()
+	expired := SignQuery(secret, "/api/v1/logs/export", url.Values{"limit": {"10"}}, time.Now().Add(-time.Minute)).Encode()
+
+	// Steps run in order against the same quotas
+	steps := []struct {
+		name          string
+		key           string
+		query         string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{name: "missing key", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", key: "team-xray", wantStatus: http.StatusUnauthorized},
+		{name: "expired signature", query: expired, wantStatus: http.StatusUnauthorized},
+		{name: "first request", key: "team-alpha", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "second request", key: "team-alpha", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "over quota", key: "team-alpha", wantStatus: http.StatusTooManyRequests, wantRemaining: "0"},
+		{name: "admin key passes unmetered", key: adminKey, wantStatus: http.StatusOK},
+		{name: "signed URL passes unmetered", query: signed, wantStatus: http.StatusOK},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/logs/export?"+step.query, nil)
+		if step.key != "" {
+			req.Header.Set(APIKeyHeader, step.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d (body %s)", step.name, w.Code, step.wantStatus, w.Body.String())
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != step.wantRemaining {
+			t.Errorf("%s: X-Quota-Remaining = %q, want %q", step.name, got, step.wantRemaining)
+		}
+		if step.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After", step.name)
+		}
+	}
+
+	var metrics strings.Builder
+	if err := quotas.WriteMetrics(&metrics, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`clickhouse_monitoring_quota_limit{key="****lpha"} 2`,
+		`clickhouse_monitoring_quota_used{key="****lpha"} 2`,
+		`clickhouse_monitoring_quota_requests_total{key="****lpha"} 2`,
+		`clickhouse_monitoring_quota_rejected_total{key="****lpha"} 1`,
+		`clickhouse_monitoring_quota_unauthorized_total 3`,
+		`# TYPE clickhouse_monitoring_quota_rejected_total counter`,
+	} {
+		if !strings.Contains(metrics.String(), want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestEnforceQuotasDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", EnforceQuotas(NewQuotas(config.NewLiveConfig(&config.RuntimeConfig{})), "", ""), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 with no quotas configured", w.Code)
+	}
+}
+
+func TestEnforceQuotasReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("API_KEY_QUOTAS", "")
+	live := config.NewLiveConfig(&config.RuntimeConfig{})
+	router := gin.New()
+	router.GET("/", EnforceQuotas(NewQuotas(live), "", ""), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Steps run in order; each reloads API_KEY_QUOTAS when set
+	steps := []struct {
+		name       string
+		quotas     string
+		wantErr    bool
+		key        string
+		wantStatus int
+	}{
+		{name: "no quotas", wantStatus: http.StatusOK},
+		{name: "quotas added", quotas: "team-alpha:1", key: "team-alpha", wantStatus: http.StatusOK},
+		{name: "quota used up", key: "team-alpha", wantStatus: http.StatusTooManyRequests},
+		{name: "missing key", wantStatus: http.StatusUnauthorized},
+		{name: "limit raised", quotas: "team-alpha:2", key: "team-alpha", wantStatus: http.StatusOK},
+		{name: "invalid reload keeps quotas", quotas: "team-alpha:0", wantErr: true, key: "team-alpha", wantStatus: http.StatusTooManyRequests},
+		{name: "key removed", quotas: "team-bravo:5", key: "team-alpha", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		if step.quotas != "" {
+			t.Setenv("API_KEY_QUOTAS", step.quotas)
+			if _, err := live.Reload(); (err != nil) != step.wantErr {
+				t.Fatalf("%s: Reload error = %v, want error %v", step.name, err, step.wantErr)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if step.key != "" {
+			req.Header.Set(APIKeyHeader, step.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d (body %s)", step.name, w.Code, step.wantStatus, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// Query parameters added to signed URLs.
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// SignQuery returns a copy of query with an expiry and an HMAC-SHA256 signature
+// over path and the remaining parameters, so the URL can be used without an
+// API key until expires.
+func SignQuery(secret, path string, query url.Values, expires time.Time) url.Values {
+	signed := make(url.Values, len(query)+2)
+	for key, values := range query {
+		if key == ExpiresParam || key == SignatureParam {
+			continue
+		}
+		signed[key] = append([]string(nil), values...)
+	}
+	signed.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	signed.Set(SignatureParam, signature(secret, path, signed))
+	return signed
+}
+
+// verifyQuery checks the signature and expiry of a URL produced by SignQuery.
+func verifyQuery(secret, path string, query url.Values, now time.Time) error {
+	provided := query.Get(SignatureParam)
+	if provided == "" {
+		return errors.New("missing signature")
+	}
+
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return errors.New("invalid expires parameter")
+	}
+
+	unsigned := make(url.Values, len(query))
+	for key, values := range query {
+		if key != SignatureParam {
+			unsigned[key] = values
+		}
+	}
+	if !hmac.Equal([]byte(provided), []byte(signature(secret, path, unsigned))) {
+		return errors.New("invalid signature")
+	}
+
+	if now.Unix() >= expires {
+		return errors.New("signed URL has expired")
+	}
+	return nil
+}
+
+// signature computes the hex HMAC-SHA256 of path and the encoded query
+// (url.Values.Encode sorts keys, so parameter order doesn't matter).
+func signature(secret, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "?" + query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequireSignedURL accepts requests carrying either a valid X-API-Key header or
+// a valid, unexpired URL signature from SignQuery. If secret is empty, signing
+// is disabled and every request passes through unchanged.
+func RequireSignedURL(secret, apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader(APIKeyHeader)
+		if apiKey != "" && provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) == 1 {
+			c.Next()
+			return
+		}
+
+		if err := verifyQuery(secret, c.Request.URL.Path, c.Request.URL.Query(), time.Now()); err != nil {
+			c.AbortWithStatusJSON(models.ErrorStatus[models.ErrCodeUnauthorized], models.ErrorResponse{
+				Error:   models.ErrCodeUnauthorized,
+				Message: "Missing or invalid download signature: " + err.Error(),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
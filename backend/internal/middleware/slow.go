@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SlowRequests logs a warning for requests whose total handling time, including
+// response serialization, exceeds threshold. A threshold of 0 disables it.
+func SlowRequests(threshold time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if threshold <= 0 {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+
+		if elapsed > threshold {
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			requestID := c.GetHeader("X-Request-ID")
+			if requestID == "" {
+				requestID = "-"
+			}
+			log.Printf("WARN slow request: method=%s route=%s status=%d duration_ms=%d threshold_ms=%d request_id=%s",
+				c.Request.Method, route, c.Writer.Status(), elapsed.Milliseconds(), threshold.Milliseconds(), requestID)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Annotation is a note attached to a query ID by a user.
+// Annotations are stored locally since system.query_log is read-only.
+type Annotation struct {
+	// ID uniquely identifies the annotation
+	ID string `json:"id"`
+
+	// QueryID is the query_log query_id the note refers to
+	QueryID string `json:"query_id" binding:"required"`
+
+	// Note is the free-text annotation body
+	Note string `json:"note" binding:"required"`
+
+	// Author identifies who wrote the note
+	Author string `json:"author"`
+
+	// CreatedAt is when the annotation was created
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueryLogDetail is a single query log entry with a human-readable version of
+// the query text.
+type QueryLogDetail struct {
+	QueryLog
+
+	// FormattedQuery is the query pretty-printed by ClickHouse's formatQuery(),
+	// or the raw query text if formatting failed
+	FormattedQuery string `json:"formatted_query"`
+}
+
+// QueryBundle gathers everything known about one query into a single
+// document for attaching to a support ticket.
+type QueryBundle struct {
+	QueryLogDetail
+
+	// Annotations are the notes attached to the query
+	Annotations []Annotation `json:"annotations"`
+
+	// ProfileEvents are the query's ProfileEvents counters from query_log
+	ProfileEvents map[string]uint64 `json:"profile_events"`
+
+	// Threads is the per-thread breakdown from query_thread_log, busiest
+	// first; empty when the log is disabled or has no rows for the query
+	Threads []QueryThread `json:"threads"`
+
+	// Explain is the EXPLAIN output of the query, one line per element; empty
+	// for queries that aren't SELECTs or when EXPLAIN fails
+	Explain []string `json:"explain"`
+
+	// GeneratedAt is when the bundle was assembled
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// QueryThread is one thread's row of system.query_thread_log.
+type QueryThread struct {
+	ThreadName      string `json:"thread_name"`
+	ThreadID        uint64 `json:"thread_id"`
+	MasterThreadID  uint64 `json:"master_thread_id"`
+	QueryDurationMs uint64 `json:"query_duration_ms"`
+	ReadRows        uint64 `json:"read_rows"`
+	ReadBytes       uint64 `json:"read_bytes"`
+	WrittenRows     uint64 `json:"written_rows"`
+	WrittenBytes    uint64 `json:"written_bytes"`
+	MemoryUsage     int64  `json:"memory_usage"`
+	PeakMemoryUsage int64  `json:"peak_memory_usage"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// AsyncInsertLog represents one asynchronous insert from
+// system.asynchronous_insert_log.
+type AsyncInsertLog struct {
+	EventTime time.Time `json:"event_time"`
+	QueryID   string    `json:"query_id"`
+	Database  string    `json:"database"`
+	Table     string    `json:"table"`
+	Format    string    `json:"format"`
+	Bytes     uint64    `json:"bytes"`
+	Rows      uint64    `json:"rows"`
+
+	// Status is Ok, ParsingError or FlushError
+	Status    string `json:"status"`
+	Exception string `json:"exception"`
+
+	// FlushTime is when the buffered batch containing this insert was flushed
+	FlushTime time.Time `json:"flush_time"`
+
+	// FlushQueryID is the query_id of the flush that wrote the batch
+	FlushQueryID string `json:"flush_query_id"`
+
+	// FlushDelayMs is the time between the insert and its flush, i.e. how long
+	// the data was not yet visible
+	FlushDelayMs int64 `json:"flush_delay_ms"`
+}
+
+// AsyncInsertFilter contains the filter options for asynchronous insert queries.
+type AsyncInsertFilter struct {
+	// Database filters by target database (exact match)
+	Database string `form:"database"`
+
+	// Table filters by target table (exact match)
+	Table string `form:"table"`
+
+	// Status filters by insert status (must be in ValidAsyncInsertStatuses)
+	Status string `form:"status"`
+
+	// QueryID filters by the insert's query_id
+	QueryID string `form:"query_id"`
+
+	// Time range filters, parsed by the handler like the query_log filters
+	StartTime *time.Time `form:"-"`
+	EndTime   *time.Time `form:"-"`
+
+	// TZ is the IANA time zone for parsing and returning times (default UTC)
+	TZ string `form:"tz"`
+
+	// Pagination
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// ValidAsyncInsertStatuses defines the accepted values of the async insert
+// status filter, matching the status enum in system.asynchronous_insert_log.
+var ValidAsyncInsertStatuses = map[string]bool{
+	"Ok":           true,
+	"ParsingError": true,
+	"FlushError":   true,
+}
@@ -0,0 +1,124 @@
+package models
+
+import "net/http"
+
+// Error codes sent in ErrorResponse.Error. They are part of the API contract:
+// clients should branch on the code rather than the message, and each code is
+// always sent with the HTTP status listed in ErrorStatus.
+const (
+	// 400 Bad Request: the request is invalid and retrying it unchanged won't help
+
+	// ErrCodeInvalidParams covers malformed query parameters without a more specific code
+	ErrCodeInvalidParams      = "invalid_parameters"
+	ErrCodeInvalidBody        = "invalid_body"
+	ErrCodeMissingParameter   = "missing_parameter"
+	ErrCodeInvalidTimezone    = "invalid_timezone"
+	ErrCodeInvalidSort        = "invalid_sort"
+	ErrCodeInvalidColumns     = "invalid_columns"
+	ErrCodeMissingColumns     = "missing_columns"
+	ErrCodeUnsupportedColumn  = "unsupported_column"
+	ErrCodeInvalidFormat      = "invalid_format"
+	ErrCodeInvalidDestination = "invalid_destination"
+	ErrCodeInvalidHeaders     = "invalid_headers"
+	ErrCodeInvalidShard       = "invalid_shard"
+	ErrCodeInvalidPanel       = "invalid_panel"
+	ErrCodeInvalidHash        = "invalid_hash"
+	ErrCodeInvalidDimension   = "invalid_dimension"
+	ErrCodeInvalidTarget      = "invalid_target"
+	ErrCodeMissingUser        = "missing_user"
+	ErrCodeConflictingFilters = "conflicting_filters"
+	ErrCodeFilterTooComplex   = "filter_too_complex"
+
+	// 401, 403, 404, 405: authentication, authorization and routing
+
+	ErrCodeUnauthorized      = "unauthorized"
+	ErrCodeForbidden         = "forbidden"
+	ErrCodeForbiddenDatabase = "forbidden_database"
+	ErrCodeNotFound          = "not_found"
+
+	// ErrCodeLogNotEnabled means the system log table backing the endpoint is
+	// not enabled on the ClickHouse server
+	ErrCodeLogNotEnabled    = "log_not_enabled"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+
+	// 422: the query ran but its result exceeds CLICKHOUSE_MAX_RESULT_ROWS/BYTES
+	ErrCodeResultTooLarge = "result_too_large"
+
+	// 429 and 503: load shedding; retry later (429 responses carry Retry-After)
+
+	ErrCodeTooManyExports = "too_many_exports"
+	ErrCodeTooManyQueries = "too_many_queries"
+
+	// ErrCodeQuotaExceeded means the API key used up its API_KEY_QUOTAS
+	// request quota; the response carries the quota usage
+	ErrCodeQuotaExceeded = "quota_exceeded"
+
+	// ErrCodeDBUnavailable means ClickHouse is unreachable or the circuit
+	// breaker is rejecting queries
+	ErrCodeDBUnavailable = "database_unavailable"
+
+	// ErrCodeCircuitOpen is reported by the readiness probe when ClickHouse
+	// answers but the circuit breaker is still open
+	ErrCodeCircuitOpen = "circuit_open"
+
+	// 504: the query hit max_execution_time or the request deadline; narrow
+	// the filters or time range
+	ErrCodeTimeout = "timeout"
+
+	// 500 and 502: server-side failures
+
+	// ErrCodeDBError is any other ClickHouse failure
+	ErrCodeDBError            = "database_error"
+	ErrCodeStorageError       = "storage_error"
+	ErrCodeExportError        = "export_error"
+	ErrCodeExportUploadFailed = "export_upload_failed"
+
+	// ErrCodeInvalidConfig means POST /admin/reload read invalid settings and
+	// kept the current ones; fix the .env file or environment and reload again
+	ErrCodeInvalidConfig = "invalid_config"
+)
+
+// ErrorStatus maps each error code to the HTTP status it is sent with.
+var ErrorStatus = map[string]int{
+	ErrCodeInvalidParams:      http.StatusBadRequest,
+	ErrCodeInvalidBody:        http.StatusBadRequest,
+	ErrCodeMissingParameter:   http.StatusBadRequest,
+	ErrCodeInvalidTimezone:    http.StatusBadRequest,
+	ErrCodeInvalidSort:        http.StatusBadRequest,
+	ErrCodeInvalidColumns:     http.StatusBadRequest,
+	ErrCodeMissingColumns:     http.StatusBadRequest,
+	ErrCodeUnsupportedColumn:  http.StatusBadRequest,
+	ErrCodeInvalidFormat:      http.StatusBadRequest,
+	ErrCodeInvalidDestination: http.StatusBadRequest,
+	ErrCodeInvalidHeaders:     http.StatusBadRequest,
+	ErrCodeInvalidShard:       http.StatusBadRequest,
+	ErrCodeInvalidPanel:       http.StatusBadRequest,
+	ErrCodeInvalidHash:        http.StatusBadRequest,
+	ErrCodeInvalidDimension:   http.StatusBadRequest,
+	ErrCodeInvalidTarget:      http.StatusBadRequest,
+	ErrCodeMissingUser:        http.StatusBadRequest,
+	ErrCodeConflictingFilters: http.StatusBadRequest,
+	ErrCodeFilterTooComplex:   http.StatusBadRequest,
+
+	ErrCodeUnauthorized:      http.StatusUnauthorized,
+	ErrCodeForbidden:         http.StatusForbidden,
+	ErrCodeForbiddenDatabase: http.StatusForbidden,
+	ErrCodeNotFound:          http.StatusNotFound,
+	ErrCodeLogNotEnabled:     http.StatusNotFound,
+	ErrCodeMethodNotAllowed:  http.StatusMethodNotAllowed,
+
+	ErrCodeResultTooLarge: http.StatusUnprocessableEntity,
+
+	ErrCodeTooManyExports: http.StatusTooManyRequests,
+	ErrCodeQuotaExceeded:  http.StatusTooManyRequests,
+	ErrCodeTooManyQueries: http.StatusServiceUnavailable,
+	ErrCodeDBUnavailable:  http.StatusServiceUnavailable,
+	ErrCodeCircuitOpen:    http.StatusServiceUnavailable,
+	ErrCodeTimeout:        http.StatusGatewayTimeout,
+
+	ErrCodeDBError:            http.StatusInternalServerError,
+	ErrCodeStorageError:       http.StatusInternalServerError,
+	ErrCodeExportError:        http.StatusInternalServerError,
+	ErrCodeExportUploadFailed: http.StatusBadGateway,
+	ErrCodeInvalidConfig:      http.StatusInternalServerError,
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ErrorEvent is an internal error recorded while handling a request, as
+// returned by GET /admin/errors.
+type ErrorEvent struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+
+	// Route is the matched route pattern, or the raw path when none matched
+	Route  string `json:"route"`
+	Status int    `json:"status"`
+
+	// Error is the underlying error, or the recovered panic value
+	Error string `json:"error"`
+
+	// Panic is true when the request panicked
+	Panic bool `json:"panic,omitempty"`
+
+	// RequestID is the request's X-Request-ID header, when sent
+	RequestID string `json:"request_id,omitempty"`
+}
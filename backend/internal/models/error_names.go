@@ -0,0 +1,116 @@
+package models
+
+// ErrorCodeNames maps common ClickHouse exception codes to their names as
+// errorCodeToName returns them (src/Common/ErrorCodes.cpp). It is used in place
+// of errorCodeToName on servers that don't have the function.
+var ErrorCodeNames = map[int32]string{
+	1:    "UNSUPPORTED_METHOD",
+	2:    "UNSUPPORTED_PARAMETER",
+	3:    "UNEXPECTED_END_OF_FILE",
+	4:    "EXPECTED_END_OF_FILE",
+	6:    "CANNOT_PARSE_TEXT",
+	7:    "INCORRECT_NUMBER_OF_COLUMNS",
+	8:    "THERE_IS_NO_COLUMN",
+	9:    "SIZES_OF_COLUMNS_DOESNT_MATCH",
+	10:   "NOT_FOUND_COLUMN_IN_BLOCK",
+	11:   "POSITION_OUT_OF_BOUND",
+	12:   "PARAMETER_OUT_OF_BOUND",
+	13:   "SIZES_OF_COLUMNS_IN_TUPLE_DOESNT_MATCH",
+	15:   "DUPLICATE_COLUMN",
+	16:   "NO_SUCH_COLUMN_IN_TABLE",
+	19:   "SIZE_OF_FIXED_STRING_DOESNT_MATCH",
+	20:   "NUMBER_OF_COLUMNS_DOESNT_MATCH",
+	23:   "CANNOT_READ_FROM_ISTREAM",
+	24:   "CANNOT_WRITE_TO_OSTREAM",
+	25:   "CANNOT_PARSE_ESCAPE_SEQUENCE",
+	26:   "CANNOT_PARSE_QUOTED_STRING",
+	27:   "CANNOT_PARSE_INPUT_ASSERTION_FAILED",
+	32:   "ATTEMPT_TO_READ_AFTER_EOF",
+	33:   "CANNOT_READ_ALL_DATA",
+	34:   "TOO_MANY_ARGUMENTS_FOR_FUNCTION",
+	35:   "TOO_FEW_ARGUMENTS_FOR_FUNCTION",
+	36:   "BAD_ARGUMENTS",
+	37:   "UNKNOWN_ELEMENT_IN_AST",
+	38:   "CANNOT_PARSE_DATE",
+	39:   "TOO_LARGE_SIZE_COMPRESSED",
+	40:   "CHECKSUM_DOESNT_MATCH",
+	41:   "CANNOT_PARSE_DATETIME",
+	42:   "NUMBER_OF_ARGUMENTS_DOESNT_MATCH",
+	43:   "ILLEGAL_TYPE_OF_ARGUMENT",
+	44:   "ILLEGAL_COLUMN",
+	46:   "UNKNOWN_FUNCTION",
+	47:   "UNKNOWN_IDENTIFIER",
+	48:   "NOT_IMPLEMENTED",
+	49:   "LOGICAL_ERROR",
+	50:   "UNKNOWN_TYPE",
+	51:   "EMPTY_LIST_OF_COLUMNS_QUERIED",
+	52:   "COLUMN_QUERIED_MORE_THAN_ONCE",
+	53:   "TYPE_MISMATCH",
+	56:   "UNKNOWN_STORAGE",
+	57:   "TABLE_ALREADY_EXISTS",
+	60:   "UNKNOWN_TABLE",
+	62:   "SYNTAX_ERROR",
+	63:   "UNKNOWN_AGGREGATE_FUNCTION",
+	69:   "ARGUMENT_OUT_OF_BOUND",
+	70:   "CANNOT_CONVERT_TYPE",
+	72:   "CANNOT_PARSE_NUMBER",
+	73:   "UNKNOWN_FORMAT",
+	76:   "CANNOT_OPEN_FILE",
+	80:   "INCORRECT_QUERY",
+	81:   "UNKNOWN_DATABASE",
+	82:   "DATABASE_ALREADY_EXISTS",
+	107:  "FILE_DOESNT_EXIST",
+	115:  "UNKNOWN_SETTING",
+	117:  "INCORRECT_DATA",
+	153:  "ILLEGAL_DIVISION",
+	158:  "TOO_MANY_ROWS",
+	159:  "TIMEOUT_EXCEEDED",
+	160:  "TOO_SLOW",
+	161:  "TOO_MANY_COLUMNS",
+	164:  "READONLY",
+	184:  "ILLEGAL_AGGREGATION",
+	192:  "UNKNOWN_USER",
+	193:  "WRONG_PASSWORD",
+	194:  "REQUIRED_PASSWORD",
+	195:  "IP_ADDRESS_NOT_ALLOWED",
+	198:  "DNS_ERROR",
+	201:  "QUOTA_EXCEEDED",
+	202:  "TOO_MANY_SIMULTANEOUS_QUERIES",
+	203:  "NO_FREE_CONNECTION",
+	209:  "SOCKET_TIMEOUT",
+	210:  "NETWORK_ERROR",
+	215:  "NOT_AN_AGGREGATE",
+	216:  "QUERY_WITH_SAME_ID_IS_ALREADY_RUNNING",
+	218:  "TABLE_IS_DROPPED",
+	236:  "ABORTED",
+	241:  "MEMORY_LIMIT_EXCEEDED",
+	242:  "TABLE_IS_READ_ONLY",
+	252:  "TOO_MANY_PARTS",
+	279:  "ALL_CONNECTION_TRIES_FAILED",
+	285:  "TOO_FEW_LIVE_REPLICAS",
+	290:  "LIMIT_EXCEEDED",
+	291:  "DATABASE_ACCESS_DENIED",
+	306:  "TOO_DEEP_RECURSION",
+	307:  "TOO_MANY_BYTES",
+	319:  "UNKNOWN_STATUS_OF_INSERT",
+	344:  "SUPPORT_IS_DISABLED",
+	349:  "CANNOT_INSERT_NULL_IN_ORDINARY_COLUMN",
+	352:  "AMBIGUOUS_COLUMN_NAME",
+	394:  "QUERY_WAS_CANCELLED",
+	396:  "TOO_MANY_ROWS_OR_BYTES",
+	407:  "DECIMAL_OVERFLOW",
+	439:  "CANNOT_SCHEDULE_TASK",
+	473:  "DEADLOCK_AVOIDED",
+	497:  "ACCESS_DENIED",
+	516:  "AUTHENTICATION_FAILED",
+	999:  "KEEPER_EXCEPTION",
+	1000: "POCO_EXCEPTION",
+	1001: "STD_EXCEPTION",
+	1002: "UNKNOWN_EXCEPTION",
+}
+
+// ErrorCodeName returns the ClickHouse name of an exception code from
+// ErrorCodeNames, or an empty string for 0 and codes it doesn't list.
+func ErrorCodeName(code int32) string {
+	return ErrorCodeNames[code]
+}
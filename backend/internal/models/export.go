@@ -0,0 +1,14 @@
+package models
+
+// ExportResult describes an export written to a destination other than the
+// HTTP response.
+type ExportResult struct {
+	// Destination is the export destination, e.g. "s3"
+	Destination string `json:"destination"`
+
+	// Location is where the file was written, e.g. s3://bucket/prefix/file.csv
+	Location string `json:"location"`
+
+	// Rows is the number of rows exported
+	Rows int `json:"rows"`
+}
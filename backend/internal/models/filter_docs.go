@@ -0,0 +1,236 @@
+package models
+
+// FilterDescription describes one query parameter accepted by the query log
+// endpoints, as returned by GET /api/v1/filters.
+type FilterDescription struct {
+	// Name is the query parameter name
+	Name string `json:"name"`
+
+	// Type is the parameter's value type: string, boolean, integer, timestamp,
+	// date (YYYY-MM-DD), duration (e.g. 10m) or integer_list (comma-separated)
+	Type string `json:"type"`
+
+	// Operator is the SQL condition the parameter produces, with ? for the value;
+	// empty for parameters that don't filter rows (paging, sorting, output)
+	Operator string `json:"operator,omitempty"`
+
+	Description string `json:"description"`
+	Example     string `json:"example"`
+
+	// Values lists the accepted values when the parameter takes a fixed set
+	Values []string `json:"values,omitempty"`
+}
+
+// FilterDoc is the hand-written part of a FilterDescription. The name and type
+// are derived from the QueryLogFilter field.
+type FilterDoc struct {
+	Operator    string
+	Description string
+	Example     string
+}
+
+// FilterDocs documents each QueryLogFilter parameter, keyed by parameter name.
+// Operators mirror the conditions built by the repository.
+var FilterDocs = map[string]FilterDoc{
+	"db_name": {
+		Operator:    "has(databases, ?)",
+		Description: "Queries that touched this database (exact name)",
+		Example:     "analytics",
+	},
+	"query_id": {
+		Operator:    "query_id = ?",
+		Description: "A single query by ID",
+		Example:     "5f8e7c0a-1b2c-4d3e-8f9a-0b1c2d3e4f5a",
+	},
+	"initial_query_id": {
+		Operator:    "initial_query_id = ?",
+		Description: "Every row of one distributed query: the initial query and the sub-queries it started on other hosts",
+		Example:     "5f8e7c0a-1b2c-4d3e-8f9a-0b1c2d3e4f5a",
+	},
+	"only_failed": {
+		Operator:    "(exception_code != 0 OR type = 'ExceptionBeforeStart')",
+		Description: "Only failed queries when true",
+		Example:     "true",
+	},
+	"only_success": {
+		Operator:    "(type = 'QueryFinish' AND exception_code = 0)",
+		Description: "Only successfully completed queries when true",
+		Example:     "true",
+	},
+	"type": {
+		Operator:    "type = ?",
+		Description: "Exact event type; combinations that can't match only_failed/only_success/has_exception are rejected",
+		Example:     "ExceptionWhileProcessing",
+	},
+	"has_exception": {
+		Operator:    "(exception_code != 0 OR exception != '' OR type LIKE 'Exception%')",
+		Description: "Anything that looks like a failure when true; a superset of only_failed",
+		Example:     "true",
+	},
+	"cache_usage": {
+		Operator:    "query_cache_usage = ?",
+		Description: "Query cache usage: Read is a hit, Write stored the result, None did not use the cache",
+		Example:     "Read",
+	},
+	"shard": {
+		Description: "Read one configured shard host's local query_log instead of the connected server",
+		Example:     "clickhouse-2:9000",
+	},
+	"exception_codes": {
+		Operator:    "exception_code IN (?, ...)",
+		Description: "Any of the listed exception codes",
+		Example:     "241,159,160",
+	},
+	"min_duration_ms": {
+		Operator:    "query_duration_ms >= ?",
+		Description: "Queries that took at least this many milliseconds (inclusive)",
+		Example:     "1000",
+	},
+	"min_peak_memory_usage": {
+		Operator:    "peak_memory_usage >= ?",
+		Description: "Queries whose peak memory usage is at least this many bytes; only on servers with the column",
+		Example:     "1073741824",
+	},
+	"min_memory_per_row": {
+		Operator:    "memory_usage / greatest(read_rows, 1) >= ?",
+		Description: "Queries using at least this many bytes of memory per row read; finds memory-inefficient queries",
+		Example:     "1024",
+	},
+	"min_read_rows": {
+		Operator:    "read_rows >= ?",
+		Description: "Queries that read at least this many rows (0 = unset)",
+		Example:     "1000000",
+	},
+	"min_tables": {
+		Operator:    "length(tables) >= ?",
+		Description: "Queries touching at least this many tables (0 = unset)",
+		Example:     "3",
+	},
+	"min_databases": {
+		Operator:    "length(databases) >= ?",
+		Description: "Queries touching at least this many databases (0 = unset)",
+		Example:     "2",
+	},
+	"user": {
+		Operator:    "user = ?",
+		Description: "Exact user",
+		Example:     "default",
+	},
+	"os_user": {
+		Operator:    "os_user = ?",
+		Description: "Exact operating system user of the client",
+		Example:     "alice",
+	},
+	"client_name": {
+		Operator:    "client_name = ?",
+		Description: "Exact client name",
+		Example:     "ClickHouse client",
+	},
+	"insert_target": {
+		Operator:    "(query_kind = 'Insert' AND has(tables, ?))",
+		Description: "INSERT queries into this table (db.table); query_log doesn't separate read from written tables, so an INSERT ... SELECT also matches its source tables",
+		Example:     "events.raw",
+	},
+	"used_function": {
+		Operator:    "has(used_functions, ?)",
+		Description: "Queries that used this function; requires used_functions in query_log",
+		Example:     "toStartOfHour",
+	},
+	"used_aggregate_function": {
+		Operator:    "has(used_aggregate_functions, ?)",
+		Description: "Queries that used this aggregate function; requires used_aggregate_functions in query_log",
+		Example:     "uniqExact",
+	},
+	"used_table_function": {
+		Operator:    "has(used_table_functions, ?)",
+		Description: "Queries that used this table function; requires used_table_functions in query_log",
+		Example:     "s3",
+	},
+	"used_storage": {
+		Operator:    "has(used_storages, ?)",
+		Description: "Queries that touched a table with this storage engine; requires used_storages in query_log",
+		Example:     "StripeLog",
+	},
+	"used_data_type_family": {
+		Operator:    "has(used_data_type_families, ?)",
+		Description: "Queries that used this data type family; requires used_data_type_families in query_log",
+		Example:     "Object",
+	},
+	"query_contains": {
+		Operator:    "positionCaseInsensitive(query, ?) > 0",
+		Description: "Query text contains this substring; position(query, ?) > 0 with case_sensitive=true",
+		Example:     "GROUP BY",
+	},
+	"query_starts_with": {
+		Operator:    "startsWith(lowerUTF8(query), lowerUTF8(?))",
+		Description: "Query text starts with this prefix; startsWith(query, ?) with case_sensitive=true",
+		Example:     "INSERT INTO staging",
+	},
+	"case_sensitive": {
+		Description: "Make query_contains and query_starts_with match case exactly",
+		Example:     "true",
+	},
+	"start_time": {
+		Operator:    "event_time >= ?",
+		Description: "Queries at or after this time (RFC 3339, or a local time interpreted in tz); also bounds event_date",
+		Example:     "2024-01-22T10:00:00Z",
+	},
+	"end_time": {
+		Operator:    "event_time <= ?",
+		Description: "Queries at or before this time (same formats as start_time)",
+		Example:     "2024-01-22T12:00:00Z",
+	},
+	"start_date": {
+		Operator:    "event_time >= ?",
+		Description: "Queries on or after this calendar day (YYYY-MM-DD) in tz; translated to the local midnight, with event_date bounds derived on the server",
+		Example:     "2024-01-21",
+	},
+	"end_date": {
+		Operator:    "event_time <= ?",
+		Description: "Queries on or before this calendar day (YYYY-MM-DD) in tz, up to the last second before the next local midnight",
+		Example:     "2024-01-21",
+	},
+	"around": {
+		Operator:    "event_time >= ? AND event_time <= ?",
+		Description: "Center of a time range of length window (requires window); combined with start_time/end_time or start_date/end_date the narrower bound wins",
+		Example:     "2024-01-22T10:30:00Z",
+	},
+	"window": {
+		Description: "Length of the range centered on around, as a Go duration",
+		Example:     "10m",
+	},
+	"after": {
+		Operator:    "event_time > ?",
+		Description: "Only queries strictly newer than this time, oldest first, for incremental polling; overrides sort_by",
+		Example:     "2024-01-22T12:00:00Z",
+	},
+	"sample": {
+		Operator:    "sipHash64(query_id) % 10000 < ?",
+		Description: "Fraction of matching queries to consider (0 < sample <= 1), for list and metrics queries only; reported in meta as sample_ratio",
+		Example:     "0.1",
+	},
+	"tz": {
+		Description: "IANA time zone for response timestamps and for time filters without a UTC offset (default UTC)",
+		Example:     "America/New_York",
+	},
+	"limit": {
+		Description: "Maximum number of records to return (default 100, max 1000)",
+		Example:     "50",
+	},
+	"offset": {
+		Description: "Number of records to skip for pagination",
+		Example:     "100",
+	},
+	"sort_by": {
+		Description: "Column to order results by (default DEFAULT_SORT_BY, event_time unless configured)",
+		Example:     "query_duration_ms",
+	},
+	"sort_order": {
+		Description: "asc or desc (default DEFAULT_SORT_ORDER, desc unless configured)",
+		Example:     "asc",
+	},
+	"columns": {
+		Description: "Comma-separated fields to return (default: all fields)",
+		Example:     "query_id,query_duration_ms,user",
+	},
+}
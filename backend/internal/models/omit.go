@@ -0,0 +1,84 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// queryLogField is a QueryLog struct field as encoding/json sees it.
+type queryLogField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// queryLogFields lists QueryLog's JSON fields in encoding order.
+var queryLogFields = func() []queryLogField {
+	t := reflect.TypeOf(QueryLog{})
+	fields := make([]queryLogField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, queryLogField{index: i, name: name, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}()
+
+// IsQueryLogField reports whether name is a JSON field of the full QueryLog
+// record, i.e. whether it can be omitted from a TrimmedQueryLog.
+func IsQueryLogField(name string) bool {
+	for _, field := range queryLogFields {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimmedQueryLog is a QueryLog whose JSON encoding skips the fields named in
+// Omit. The remaining fields keep their names, types and order, so clients of
+// the full record can shrink the payload without switching to the dynamic
+// columns response.
+type TrimmedQueryLog struct {
+	QueryLog
+	Omit map[string]bool
+}
+
+// MarshalJSON encodes the QueryLog fields not listed in Omit.
+func (l TrimmedQueryLog) MarshalJSON() ([]byte, error) {
+	v := reflect.ValueOf(l.QueryLog)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, field := range queryLogFields {
+		value := v.Field(field.index)
+		if l.Omit[field.name] || (field.omitEmpty && value.IsZero()) {
+			continue
+		}
+		encoded, err := json.Marshal(value.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", field.name, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", field.name)
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// TrimQueryLogs wraps logs so their JSON encoding skips the omitted fields.
+func TrimQueryLogs(logs []QueryLog, omit map[string]bool) []TrimmedQueryLog {
+	trimmed := make([]TrimmedQueryLog, len(logs))
+	for i, log := range logs {
+		trimmed[i] = TrimmedQueryLog{QueryLog: log, Omit: omit}
+	}
+	return trimmed
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -22,6 +23,10 @@ type QueryLog struct {
 	// EventDate is the date portion of EventTime (used for partitioning)
 	EventDate time.Time `json:"event_date" ch:"event_date"`
 
+	// EventTimeLocal is EventTime in the requested time zone, set only when a
+	// request asks for local_time; EventTime and EventDate then stay in UTC
+	EventTimeLocal *time.Time `json:"event_time_local,omitempty"`
+
 	// Type indicates the query event type:
 	// 1 = QueryStart, 2 = QueryFinish, 3 = ExceptionBeforeStart, 4 = ExceptionWhileProcessing
 	Type string `json:"type" ch:"type"`
@@ -79,6 +84,14 @@ type QueryLog struct {
 
 	// IsInitialQuery is true if this is the initial query (not a distributed sub-query)
 	IsInitialQuery uint8 `json:"is_initial_query" ch:"is_initial_query"`
+
+	// ErrorName is the ClickHouse name of ExceptionCode (e.g. MEMORY_LIMIT_EXCEEDED);
+	// empty when ExceptionCode is 0
+	ErrorName string `json:"error_name"`
+
+	// TraceID is extracted from log_comment with LOG_COMMENT_TRACE_PATTERN;
+	// empty when no pattern is configured or the comment doesn't match
+	TraceID string `json:"trace_id"`
 }
 
 // QueryLogFilter contains optional filters for querying the query_log table.
@@ -90,6 +103,10 @@ type QueryLogFilter struct {
 	// QueryID filters by exact query ID match
 	QueryID string `form:"query_id"`
 
+	// InitialQueryID filters by exact initial_query_id match, returning every
+	// row that belongs to one distributed query, including the initial query itself
+	InitialQueryID string `form:"initial_query_id"`
+
 	// OnlyFailed when true, returns only queries with exceptions
 	// (exception_code != 0 OR type = 'ExceptionBeforeStart')
 	OnlyFailed bool `form:"only_failed"`
@@ -98,20 +115,124 @@ type QueryLogFilter struct {
 	// (type = 'QueryFinish' AND exception_code = 0)
 	OnlySuccess bool `form:"only_success"`
 
-	// MinDurationMs filters queries with duration greater than this value
+	// Type filters by exact query_log event type (must be in ValidQueryTypes).
+	// Conflicting combinations with OnlySuccess/OnlyFailed/HasException are rejected.
+	Type string `form:"type"`
+
+	// HasException when true, returns anything that looks like a failure, a superset
+	// of OnlyFailed: (exception_code != 0 OR exception != '' OR type LIKE 'Exception%')
+	HasException bool `form:"has_exception"`
+
+	// CacheUsage filters by query cache usage (must be in ValidCacheUsage):
+	// Read is a cache hit, Write stored the result, None did not use the cache
+	CacheUsage string `form:"cache_usage"`
+
+	// Shard reads a single shard host's local query_log instead of the server the
+	// service is connected to. Must be one of the configured shard hosts.
+	Shard string `form:"shard"`
+
+	// ExceptionCodes filters by any of the listed exception codes.
+	// Parsed by the handler from the comma-separated exception_codes parameter.
+	ExceptionCodes []int32 `form:"-"`
+
+	// MinDurationMs filters queries whose duration is at least this value
+	// (inclusive: query_duration_ms >= MinDurationMs)
 	MinDurationMs uint64 `form:"min_duration_ms"`
 
+	// MinPeakMemoryUsage filters queries whose peak memory usage is at least this
+	// many bytes. Only available on servers whose query_log has peak_memory_usage.
+	MinPeakMemoryUsage uint64 `form:"min_peak_memory_usage"`
+
+	// MinMemoryPerRow filters queries using at least this many bytes of
+	// memory per row read (memory_usage / greatest(read_rows, 1)), to find
+	// memory-inefficient queries that absolute thresholds miss. 0 = unset.
+	MinMemoryPerRow float64 `form:"min_memory_per_row"`
+
+	// MinReadRows filters queries that read at least this many rows
+	// (read_rows >= MinReadRows; 0 = unset)
+	MinReadRows uint64 `form:"min_read_rows"`
+
+	// MinTables filters queries touching at least this many tables
+	// (length(tables) >= MinTables; 0 = unset)
+	MinTables uint64 `form:"min_tables"`
+
+	// MinDatabases filters queries touching at least this many databases
+	// (length(databases) >= MinDatabases; 0 = unset)
+	MinDatabases uint64 `form:"min_databases"`
+
 	// User filters by exact user match
 	User string `form:"user"`
 
-	// QueryContains filters queries containing this substring (case-insensitive)
+	// OSUser filters by exact match on the client's operating system user
+	OSUser string `form:"os_user"`
+
+	// ClientName filters by exact match on the client name (e.g. "ClickHouse client")
+	ClientName string `form:"client_name"`
+
+	// InsertTarget filters INSERT queries whose tables include this table
+	// (query_kind = 'Insert' AND has(tables, InsertTarget)), given as db.table.
+	// query_log doesn't separate read from written tables, so an INSERT ... SELECT
+	// also matches the tables it reads from.
+	InsertTarget string `form:"insert_target"`
+
+	// UsedFunction, UsedAggregateFunction, UsedTableFunction, UsedStorage and
+	// UsedDataTypeFamily filter queries whose matching used_* array contains the
+	// name (has(used_functions, UsedFunction) etc.), for feature-usage audits
+	// such as finding who still uses a deprecated engine. Only available on
+	// servers whose query_log has the column (see UsedFeatures).
+	UsedFunction          string `form:"used_function"`
+	UsedAggregateFunction string `form:"used_aggregate_function"`
+	UsedTableFunction     string `form:"used_table_function"`
+	UsedStorage           string `form:"used_storage"`
+	UsedDataTypeFamily    string `form:"used_data_type_family"`
+
+	// QueryContains filters queries containing this substring
+	// (case-insensitive unless CaseSensitive is set)
 	QueryContains string `form:"query_contains"`
 
-	// StartTime filters queries after this time
-	StartTime *time.Time `form:"start_time" time_format:"2006-01-02T15:04:05Z07:00"`
-
-	// EndTime filters queries before this time
-	EndTime *time.Time `form:"end_time" time_format:"2006-01-02T15:04:05Z07:00"`
+	// QueryStartsWith filters queries beginning with this prefix
+	// (case-insensitive unless CaseSensitive is set)
+	QueryStartsWith string `form:"query_starts_with"`
+
+	// CaseSensitive makes QueryContains and QueryStartsWith match case exactly
+	CaseSensitive bool `form:"case_sensitive"`
+
+	// StartTime filters queries after this time.
+	// Parsed from the start_time parameter by the handler so that inputs without
+	// a UTC offset can be interpreted in the requested time zone (see TZ).
+	StartTime *time.Time `form:"-"`
+
+	// EndTime filters queries before this time (parsed from end_time, see StartTime)
+	EndTime *time.Time `form:"-"`
+
+	// StartDate and EndDate (YYYY-MM-DD) filter by calendar day in the requested
+	// time zone, inclusive. The handler folds them into StartTime/EndTime as the
+	// local day boundaries, so the event_date bounds are derived in the server's
+	// time zone and "yesterday" follows the viewer's tz rather than the server's.
+	StartDate string `form:"start_date"`
+	EndDate   string `form:"end_date"`
+
+	// Around and Window select the Window-long range centered on Around, e.g.
+	// around=2024-01-22T10:30:00Z&window=10m for 10:25 to 10:35. Around is
+	// parsed like start_time and Window with time.ParseDuration; the handler
+	// folds them into StartTime/EndTime, and combined with start_time/end_time
+	// or start_date/end_date the narrower bound wins.
+	Around *time.Time `form:"-"`
+	Window string     `form:"window"`
+
+	// After returns only queries strictly newer than this event_time, oldest first,
+	// for incremental polling (parsed from after, see StartTime). It overrides sort_by.
+	After *time.Time `form:"-"`
+
+	// Sample keeps roughly this fraction of the matching rows (0 < Sample <= 1)
+	// in list and aggregated metrics queries, for cheap browsing of a huge
+	// query_log. 0 = unsampled.
+	Sample float64 `form:"sample"`
+
+	// TZ is an IANA time zone name (e.g. "America/New_York") used to render
+	// event_time/event_date in responses and to interpret time filters that
+	// carry no UTC offset. Defaults to UTC.
+	TZ string `form:"tz"`
 
 	// Limit is the maximum number of records to return (default: 100, max: 1000)
 	Limit int `form:"limit"`
@@ -119,43 +240,192 @@ type QueryLogFilter struct {
 	// Offset is the number of records to skip for pagination
 	Offset int `form:"offset"`
 
+	// SortBy is the column to order results by (default: event_time, or
+	// DEFAULT_SORT_BY for list and export). List and export endpoints accept
+	// ValidSortColumns; the group-by endpoint accepts ValidGroupBySortColumns.
+	SortBy string `form:"sort_by"`
+
+	// SortOrder is "asc" or "desc" (default: desc, or DEFAULT_SORT_ORDER for list and export)
+	SortOrder string `form:"sort_order"`
+
 	// Columns specifies which fields to return in the response (comma-separated).
 	// If empty, returns all fields.
 	// Valid values: query_id, query, event_time, event_date, type, query_duration_ms,
 	// memory_usage, read_rows, read_bytes, written_rows, written_bytes, result_rows,
 	// result_bytes, databases, tables, exception_code, exception, user, client_hostname,
-	// http_user_agent, initial_user, initial_query_id, is_initial_query
+	// http_user_agent, initial_user, initial_query_id, is_initial_query,
+	// os_user, client_name, query_cache_usage, peak_memory_usage, interface, the used_*
+	// feature columns (see UsedFeatureColumns), and the derived columns
+	// tables_count, databases_count, query_duration_s, error_name, trace_id
 	Columns string `form:"columns"`
 }
 
 // ValidColumns defines all valid column names for the query_log table.
 var ValidColumns = map[string]bool{
-	"query_id":         true,
-	"query":            true,
-	"event_time":       true,
-	"event_date":       true,
-	"type":             true,
+	"query_id":          true,
+	"query":             true,
+	"event_time":        true,
+	"event_date":        true,
+	"type":              true,
 	"query_duration_ms": true,
-	"memory_usage":     true,
-	"read_rows":        true,
-	"read_bytes":       true,
-	"written_rows":     true,
-	"written_bytes":    true,
-	"result_rows":      true,
-	"result_bytes":     true,
-	"databases":        true,
-	"tables":           true,
-	"exception_code":   true,
-	"exception":        true,
-	"user":             true,
-	"client_hostname":  true,
-	"http_user_agent":  true,
-	"initial_user":     true,
-	"initial_query_id": true,
-	"is_initial_query": true,
-}
-
-// AllColumns returns all valid column names in a consistent order.
+	"memory_usage":      true,
+	"read_rows":         true,
+	"read_bytes":        true,
+	"written_rows":      true,
+	"written_bytes":     true,
+	"result_rows":       true,
+	"result_bytes":      true,
+	"databases":         true,
+	"tables":            true,
+	"exception_code":    true,
+	"exception":         true,
+	"user":              true,
+	"client_hostname":   true,
+	"http_user_agent":   true,
+	"initial_user":      true,
+	"initial_query_id":  true,
+	"is_initial_query":  true,
+
+	// Client attribution columns, selectable but not part of the full record
+	"os_user":     true,
+	"client_name": true,
+
+	// Query cache usage (Unknown, None, Write, Read)
+	"query_cache_usage": true,
+
+	// Only present on newer servers (see OptionalColumns)
+	"peak_memory_usage": true,
+
+	// SQL features the query used (see UsedFeatureColumns)
+	"used_aggregate_functions":            true,
+	"used_aggregate_function_combinators": true,
+	"used_database_engines":               true,
+	"used_data_type_families":             true,
+	"used_dictionaries":                   true,
+	"used_formats":                        true,
+	"used_functions":                      true,
+	"used_storages":                       true,
+	"used_table_functions":                true,
+
+	// Numeric enum columns returned as EnumValue (see EnumLabels)
+	"interface": true,
+
+	// Derived columns computed from other columns (see DerivedColumns)
+	"tables_count":     true,
+	"databases_count":  true,
+	"query_duration_s": true,
+	"error_name":       true,
+	"trace_id":         true,
+}
+
+// OptionalColumns are valid columns that older ClickHouse versions don't have
+// in system.query_log. Requests using them are checked against the server first.
+var OptionalColumns = map[string]bool{
+	"peak_memory_usage": true,
+
+	"used_aggregate_functions":            true,
+	"used_aggregate_function_combinators": true,
+	"used_database_engines":               true,
+	"used_data_type_families":             true,
+	"used_dictionaries":                   true,
+	"used_formats":                        true,
+	"used_functions":                      true,
+	"used_storages":                       true,
+	"used_table_functions":                true,
+}
+
+// UsedFeatureColumns are the Array(String) columns listing the SQL features a
+// query used: functions, storages, formats and so on, by name. They vary by
+// ClickHouse version, so they are also OptionalColumns.
+var UsedFeatureColumns = []string{
+	"used_aggregate_functions",
+	"used_aggregate_function_combinators",
+	"used_database_engines",
+	"used_data_type_families",
+	"used_dictionaries",
+	"used_formats",
+	"used_functions",
+	"used_storages",
+	"used_table_functions",
+}
+
+// UsedFeature is a set used_* filter: queries match when Column contains Name.
+type UsedFeature struct {
+	Column string
+	Name   string
+}
+
+// UsedFeatures returns the used_* filters that are set, in a fixed order.
+func (f QueryLogFilter) UsedFeatures() []UsedFeature {
+	var used []UsedFeature
+	for _, feature := range []UsedFeature{
+		{"used_functions", f.UsedFunction},
+		{"used_aggregate_functions", f.UsedAggregateFunction},
+		{"used_table_functions", f.UsedTableFunction},
+		{"used_storages", f.UsedStorage},
+		{"used_data_type_families", f.UsedDataTypeFamily},
+	} {
+		if feature.Name != "" {
+			used = append(used, feature)
+		}
+	}
+	return used
+}
+
+// DerivedColumns maps pseudo-columns to the SQL expression that computes them.
+// These are selectable via the columns parameter but are not part of AllColumns.
+var DerivedColumns = map[string]string{
+	"tables_count":     "length(tables)",
+	"databases_count":  "length(databases)",
+	"query_duration_s": "query_duration_ms / 1000",
+	"error_name":       ErrorNameExpr,
+
+	// Selects the raw comment; the repository extracts the trace ID from it
+	"trace_id": "log_comment",
+}
+
+// ErrorNameExpr resolves exception_code to its ClickHouse error name, or an
+// empty string for successful queries. Servers without errorCodeToName get names
+// from ErrorCodeNames instead.
+const ErrorNameExpr = "if(exception_code = 0, '', errorCodeToName(exception_code))"
+
+// ValidCacheUsage defines the accepted values of the cache_usage filter,
+// matching the query_cache_usage enum in system.query_log.
+var ValidCacheUsage = map[string]bool{
+	"Unknown": true,
+	"None":    true,
+	"Write":   true,
+	"Read":    true,
+}
+
+// ValidQueryTypes defines the accepted values of the type filter. QueryStart is
+// not included since QueryStart rows are always excluded.
+var ValidQueryTypes = map[string]bool{
+	"QueryFinish":              true,
+	"ExceptionBeforeStart":     true,
+	"ExceptionWhileProcessing": true,
+}
+
+// ValidSortColumns defines the columns list and export results may be sorted by.
+// The sort column is interpolated into the ORDER BY clause, so only these values are accepted.
+var ValidSortColumns = map[string]bool{
+	"event_time":        true,
+	"query_duration_ms": true,
+	"memory_usage":      true,
+	"read_rows":         true,
+	"read_bytes":        true,
+	"written_rows":      true,
+	"written_bytes":     true,
+	"result_rows":       true,
+	"result_bytes":      true,
+	"exception_code":    true,
+	"user":              true,
+	"type":              true,
+	"query_id":          true,
+}
+
+// AllColumns returns the columns of the full QueryLog record in a consistent order.
+// Attribution, enum and derived columns are selectable via the columns parameter but not included.
 func AllColumns() []string {
 	return []string{
 		"query_id", "query", "event_time", "event_date", "type",
@@ -167,10 +437,52 @@ func AllColumns() []string {
 	}
 }
 
-// QueryLogResponse wraps the query results with pagination metadata.
-type QueryLogResponse struct {
-	Data       []QueryLog `json:"data"`
+// EnumLabels maps numeric enum columns to the labels of their values.
+// To expose a new numeric enum column, add its value labels here and give it
+// an integer scan target in the repository.
+var EnumLabels = map[string]map[int64]string{
+	// interface is the protocol the query arrived through
+	"interface": {
+		1: "TCP",
+		2: "HTTP",
+		3: "gRPC",
+		4: "MySQL",
+		5: "PostgreSQL",
+		6: "Local",
+		7: "TCP_Interserver",
+	},
+}
+
+// EnumValue is a numeric enum column value together with its label.
+// Unknown values have an empty label.
+type EnumValue struct {
+	Raw   int64  `json:"raw"`
+	Label string `json:"label"`
+}
+
+// NewEnumValue looks up the label for raw in the enum map for col.
+func NewEnumValue(col string, raw int64) EnumValue {
+	return EnumValue{Raw: raw, Label: EnumLabels[col][raw]}
+}
+
+// String returns the label, or the raw value when the label is unknown.
+func (e EnumValue) String() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return strconv.FormatInt(e.Raw, 10)
+}
+
+// ListMeta is the response metadata for query log list endpoints.
+type ListMeta struct {
 	Pagination Pagination `json:"pagination"`
+
+	// Columns lists the returned fields when specific columns were requested
+	Columns []string `json:"columns,omitempty"`
+
+	// SampleRatio is the fraction of matching rows the page was drawn from.
+	// Omitted when the data was not sampled.
+	SampleRatio float64 `json:"sample_ratio,omitempty"`
 }
 
 // Pagination contains pagination metadata for list responses.
@@ -180,30 +492,284 @@ type Pagination struct {
 	Count  int `json:"count"` // Number of records returned in this response
 }
 
-// QueryLogDynamicResponse wraps query results with variable columns.
-// Used when the client requests specific columns via the columns parameter.
-type QueryLogDynamicResponse struct {
-	Data       []map[string]interface{} `json:"data"`
-	Columns    []string                 `json:"columns"`
-	Pagination Pagination               `json:"pagination"`
-}
-
 // QueryLogMetrics represents time-bucketed aggregated metrics for charts.
 type QueryLogMetrics struct {
-	TimeBucket        time.Time `json:"time_bucket"`
-	TotalQueries      int64     `json:"total_queries"`
-	AvgDurationMs     float64   `json:"avg_duration_ms"`
-	MaxDurationMs     uint64    `json:"max_duration_ms"`
-	AvgMemoryUsage    float64   `json:"avg_memory_usage"`
-	MaxMemoryUsage    int64     `json:"max_memory_usage"`
-	TotalReadBytes    uint64    `json:"total_read_bytes"`
-	TotalWrittenBytes uint64    `json:"total_written_bytes"`
-	FailedQueries     int64     `json:"failed_queries"`
-}
-
-// QueryLogMetricsResponse wraps aggregated metrics with bucket info.
-type QueryLogMetricsResponse struct {
-	Data         []QueryLogMetrics `json:"data"`
-	BucketSize   string            `json:"bucket_size"`
-	BucketLabel  string            `json:"bucket_label"`
+	TimeBucket     time.Time `json:"time_bucket"`
+	TotalQueries   int64     `json:"total_queries"`
+	AvgDurationMs  float64   `json:"avg_duration_ms"`
+	MaxDurationMs  uint64    `json:"max_duration_ms"`
+	AvgMemoryUsage float64   `json:"avg_memory_usage"`
+	MaxMemoryUsage int64     `json:"max_memory_usage"`
+	// MaxPeakMemoryUsage is 0 on servers whose query_log lacks peak_memory_usage
+	MaxPeakMemoryUsage int64   `json:"max_peak_memory_usage"`
+	TotalReadBytes     uint64  `json:"total_read_bytes"`
+	TotalWrittenBytes  uint64  `json:"total_written_bytes"`
+	FailedQueries      int64   `json:"failed_queries"`
+	ErrorRate          float64 `json:"error_rate"` // failed_queries / total_queries (0-1)
+
+	// QueriesPerSecond is TotalQueries divided by the bucket length in seconds,
+	// so rates stay comparable when the bucket size changes. Partially covered
+	// edge buckets are divided by the full bucket length.
+	QueriesPerSecond float64 `json:"queries_per_second"`
+}
+
+// MetricsMeta is the response metadata for aggregated metrics.
+type MetricsMeta struct {
+	BucketSize  string `json:"bucket_size"`
+	BucketLabel string `json:"bucket_label"`
+
+	// BucketAlignment is "epoch" when buckets start at interval boundaries
+	// counted from the Unix epoch (e.g. :00, :05, :10 for 5m buckets), so the
+	// first and last buckets may only partly overlap the range, or "start"
+	// when they start at start_time
+	BucketAlignment string `json:"bucket_alignment"`
+
+	// Downsampled is true when the query was estimated to scan too many rows
+	// and a coarser bucket and/or sampling was applied
+	Downsampled bool `json:"downsampled"`
+
+	// SampleRatio is the fraction of rows sampled; counts and sums are scaled
+	// back up. Omitted when the data was not sampled.
+	SampleRatio float64 `json:"sample_ratio,omitempty"`
+
+	// EstimatedRows is ClickHouse's estimate of the rows the query would scan
+	EstimatedRows uint64 `json:"estimated_rows,omitempty"`
+
+	// BucketClamped is true when the bucket was widened to respect MAX_BUCKETS
+	BucketClamped bool `json:"bucket_clamped,omitempty"`
+}
+
+// GroupByParams contains the grouping options for the group-by endpoint.
+// Filtering and sorting are handled by QueryLogFilter.
+type GroupByParams struct {
+	// Dimension is the column to group by (must be in ValidGroupByDimensions)
+	Dimension string `form:"dimension"`
+}
+
+// ValidGroupByDimensions defines the columns that may be used as a group-by dimension.
+// The dimension is interpolated into the SQL, so only these values are accepted.
+var ValidGroupByDimensions = map[string]bool{
+	"user":            true,
+	"initial_user":    true,
+	"client_hostname": true,
+	"http_user_agent": true,
+	"os_user":         true,
+	"client_name":     true,
+	"type":            true,
+	"query_kind":      true,
+	"exception_code":  true,
+}
+
+// ValidGroupBySortColumns defines the aggregates that group-by results may be sorted by.
+var ValidGroupBySortColumns = map[string]bool{
+	"total_queries":       true,
+	"avg_duration_ms":     true,
+	"max_duration_ms":     true,
+	"total_read_bytes":    true,
+	"total_written_bytes": true,
+	"failed_queries":      true,
+	"error_rate":          true,
+}
+
+// QueryLogGroupStats represents aggregated metrics for a single group-by key.
+type QueryLogGroupStats struct {
+	Key               string  `json:"key"`
+	TotalQueries      int64   `json:"total_queries"`
+	AvgDurationMs     float64 `json:"avg_duration_ms"`
+	MaxDurationMs     uint64  `json:"max_duration_ms"`
+	TotalReadBytes    uint64  `json:"total_read_bytes"`
+	TotalWrittenBytes uint64  `json:"total_written_bytes"`
+	FailedQueries     int64   `json:"failed_queries"`
+	ErrorRate         float64 `json:"error_rate"` // failed_queries / total_queries (0-1)
+
+	// ErrorName is the ClickHouse error name of Key when grouping by exception_code
+	ErrorName string `json:"error_name,omitempty"`
+}
+
+// DashboardRequest is the body of POST /api/v1/dashboard.
+type DashboardRequest struct {
+	// Panels lists the panels to return (must be in ValidDashboardPanels);
+	// all panels are returned when empty
+	Panels []string `json:"panels"`
+}
+
+// ValidDashboardPanels defines the panels the dashboard endpoint can return.
+var ValidDashboardPanels = map[string]bool{
+	"count":   true, // number of matching queries
+	"metrics": true, // time-bucketed aggregated metrics
+	"slowest": true, // slowest matching queries
+	"errors":  true, // failed queries grouped by exception code
+
+	"scan_efficiency": true, // rows returned per row read
+}
+
+// ScanEfficiency compares the rows the matching queries returned with the rows
+// they read. A low ratio means queries read far more than they return, which
+// often points at a missing index or an unsuitable ORDER BY key.
+type ScanEfficiency struct {
+	TotalReadRows   uint64 `json:"total_read_rows"`
+	TotalResultRows uint64 `json:"total_result_rows"`
+
+	// Ratio is TotalResultRows / TotalReadRows (0 when nothing was read)
+	Ratio float64 `json:"ratio"`
+}
+
+// DashboardMeta is the response metadata for the dashboard endpoint.
+type DashboardMeta struct {
+	// Metrics is the metrics panel's bucket metadata, when it was requested
+	Metrics *MetricsMeta `json:"metrics,omitempty"`
+
+	// Errors maps each failed panel to its error message; the other panels
+	// are still returned
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// GroupByMeta is the response metadata for group-by results.
+type GroupByMeta struct {
+	Dimension string `json:"dimension"`
+}
+
+// InsertStats holds INSERT performance for one table within a time bucket.
+type InsertStats struct {
+	TimeBucket      time.Time `json:"time_bucket"`
+	Table           string    `json:"table"`
+	Inserts         int64     `json:"inserts"`
+	WrittenRows     uint64    `json:"written_rows"`
+	WrittenBytes    uint64    `json:"written_bytes"`
+	RowsPerSecond   float64   `json:"rows_per_second"`
+	AvgPartsCreated float64   `json:"avg_parts_created"`
+	FailedInserts   int64     `json:"failed_inserts"`
+}
+
+// QuerySession is a burst of one user's queries with no idle gap longer than
+// the requested session gap between consecutive queries.
+type QuerySession struct {
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	QueryCount      int64     `json:"query_count"`
+	TotalDurationMs uint64    `json:"total_duration_ms"`
+	FailedQueries   int64     `json:"failed_queries"`
+
+	// QueryIDs holds up to the first 100 query IDs of the session in time order
+	QueryIDs []string `json:"query_ids"`
+}
+
+// SessionMeta is the response metadata for sessions.
+type SessionMeta struct {
+	User string `json:"user"`
+	Gap  string `json:"gap"`
+}
+
+// PatternTrendPoint holds the metrics of one normalized query within a time bucket.
+type PatternTrendPoint struct {
+	TimeBucket    time.Time `json:"time_bucket"`
+	Executions    int64     `json:"executions"`
+	AvgDurationMs float64   `json:"avg_duration_ms"`
+	P95DurationMs float64   `json:"p95_duration_ms"`
+	AvgReadBytes  float64   `json:"avg_read_bytes"`
+	P95ReadBytes  float64   `json:"p95_read_bytes"`
+}
+
+// PatternTrendMeta is the response metadata for a pattern trend.
+type PatternTrendMeta struct {
+	// NormalizedQueryHash is a string so it survives JSON clients limited to 2^53
+	NormalizedQueryHash string `json:"normalized_query_hash"`
+	BucketSize          string `json:"bucket_size"`
+	BucketLabel         string `json:"bucket_label"`
+	BucketClamped       bool   `json:"bucket_clamped,omitempty"`
+}
+
+// RetryBurst is a normalized query that one user ran at least a threshold
+// number of times within a single window, a sign of a client retry loop.
+type RetryBurst struct {
+	// NormalizedQueryHash is a string so it survives JSON clients limited to 2^53
+	NormalizedQueryHash string `json:"normalized_query_hash"`
+	NormalizedQuery     string `json:"normalized_query"`
+	User                string `json:"user"`
+
+	// WindowStart and WindowEnd bound the fixed window the executions fell in
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+
+	// FirstSeen and LastSeen are the first and last executions in the window
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	Executions    int64 `json:"executions"`
+	FailedQueries int64 `json:"failed_queries"`
+}
+
+// RetryBurstMeta is the response metadata for retry bursts.
+type RetryBurstMeta struct {
+	Window   string `json:"window"`
+	MinCount int64  `json:"min_count"`
+}
+
+// TreemapNode is a node of the query pattern treemap: the root, a query kind,
+// or a normalized query pattern within a kind.
+type TreemapNode struct {
+	// Name is "all" for the root, the query_kind for a kind, the normalized
+	// query text for a pattern, or "other" for the patterns beyond the top N
+	Name string `json:"name"`
+
+	// Value is the total query_duration_ms of the node and its children
+	Value uint64 `json:"value"`
+
+	// Share is Value as a fraction (0-1) of the root's total duration
+	Share float64 `json:"share"`
+
+	Executions uint64 `json:"executions"`
+
+	// NormalizedQueryHash identifies a pattern node (as a string for JSON clients
+	// limited to 2^53); it can be passed to /logs/patterns/:hash/trend
+	NormalizedQueryHash string `json:"normalized_query_hash,omitempty"`
+
+	Children []TreemapNode `json:"children,omitempty"`
+}
+
+// TreemapPattern is one (query_kind, normalized_query_hash) row of the treemap
+// aggregation, with the totals of its kind.
+type TreemapPattern struct {
+	QueryKind           string
+	NormalizedQueryHash uint64
+	NormalizedQuery     string
+	Executions          uint64
+	DurationMs          uint64
+	KindExecutions      uint64
+	KindDurationMs      uint64
+}
+
+// UserShare represents a user's share of cluster resources within a time range.
+// Share fields are percentages (0-100) of the total across all users.
+type UserShare struct {
+	User             string  `json:"user"`
+	TotalQueries     int64   `json:"total_queries"`
+	TotalDurationMs  uint64  `json:"total_duration_ms"`
+	TotalMemoryUsage int64   `json:"total_memory_usage"`
+	TotalReadBytes   uint64  `json:"total_read_bytes"`
+	DurationShare    float64 `json:"duration_share"`
+	MemoryShare      float64 `json:"memory_share"`
+	ReadBytesShare   float64 `json:"read_bytes_share"`
+	ExceedsThreshold bool    `json:"exceeds_threshold"`
+}
+
+// UserShareMeta is the response metadata for user shares.
+type UserShareMeta struct {
+	ShareThreshold float64 `json:"share_threshold"`
+}
+
+// QueryLogCoverage describes how much data system.query_log currently holds.
+type QueryLogCoverage struct {
+	// OldestEventTime and NewestEventTime are nil when the table is empty
+	OldestEventTime *time.Time `json:"oldest_event_time"`
+	NewestEventTime *time.Time `json:"newest_event_time"`
+	TotalRows       uint64     `json:"total_rows"`
+
+	// BytesOnDisk is the size of the whole table, so it is null when
+	// AllowedDatabases restricts the rows that may be described
+	BytesOnDisk *uint64 `json:"bytes_on_disk"`
+
+	// ExceedsRetention is set when the request's start_time is older than the
+	// oldest retained row, meaning part of the requested range has no data
+	ExceedsRetention *bool `json:"exceeds_retention,omitempty"`
 }
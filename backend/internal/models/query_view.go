@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// QueryViewLog represents one view execution from system.query_views_log,
+// recorded when an INSERT triggers a materialized (or live/window) view.
+type QueryViewLog struct {
+	EventTime time.Time `json:"event_time"`
+
+	// InitialQueryID is the query_id of the INSERT that triggered the view
+	InitialQueryID string `json:"initial_query_id"`
+
+	// ViewName is the fully qualified view name (database.view)
+	ViewName string `json:"view_name"`
+
+	// ViewType is Default, Materialized, Live or Window
+	ViewType string `json:"view_type"`
+
+	// ViewTarget is the table the view writes to
+	ViewTarget string `json:"view_target"`
+
+	ViewDurationMs  uint64 `json:"view_duration_ms"`
+	ReadRows        uint64 `json:"read_rows"`
+	ReadBytes       uint64 `json:"read_bytes"`
+	WrittenRows     uint64 `json:"written_rows"`
+	WrittenBytes    uint64 `json:"written_bytes"`
+	PeakMemoryUsage int64  `json:"peak_memory_usage"`
+
+	// Status is QueryFinish, ExceptionBeforeStart or ExceptionWhileProcessing
+	Status        string `json:"status"`
+	ExceptionCode int32  `json:"exception_code"`
+	Exception     string `json:"exception"`
+
+	// TriggeringQuery is the text of the INSERT that triggered the view.
+	// Only set when requested with include_query=true.
+	TriggeringQuery string `json:"triggering_query,omitempty"`
+}
+
+// QueryViewFilter contains the filter options for view execution queries.
+type QueryViewFilter struct {
+	// QueryID filters by the triggering INSERT's query_id (initial_query_id)
+	QueryID string `form:"query_id"`
+
+	// ViewName filters by fully qualified view name (database.view, exact match)
+	ViewName string `form:"view_name"`
+
+	// OnlyFailed returns only view executions that raised an exception
+	OnlyFailed bool `form:"only_failed"`
+
+	// MinDurationMs filters view executions that took at least this long (inclusive)
+	MinDurationMs uint64 `form:"min_duration_ms"`
+
+	// IncludeQuery joins the triggering query's text from system.query_log
+	IncludeQuery bool `form:"include_query"`
+
+	// Time range filters, parsed by the handler like the query_log filters
+	StartTime *time.Time `form:"-"`
+	EndTime   *time.Time `form:"-"`
+
+	// TZ is the IANA time zone for parsing and returning times (default UTC)
+	TZ string `form:"tz"`
+
+	// Pagination
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
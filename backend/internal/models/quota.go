@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// QuotaUsage is one API key's usage of its request quota over the sliding
+// QuotaWindow.
+type QuotaUsage struct {
+	// Key identifies the API key without revealing it: only its last four
+	// characters are kept
+	Key string `json:"key"`
+
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+
+	// Rejected counts the requests answered with 429 quota_exceeded since startup
+	Rejected uint64 `json:"rejected"`
+
+	// Window is the length of the sliding window, e.g. "24h0m0s"
+	Window string `json:"window"`
+
+	// ResetAt is when the oldest counted requests leave the window and free up
+	// quota; omitted while nothing is counted
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// QuotaErrorResponse is the 429 quota_exceeded body: an ErrorResponse plus the
+// usage of the exhausted quota.
+type QuotaErrorResponse struct {
+	ErrorResponse
+	Quota QuotaUsage `json:"quota"`
+}
+
+// MaskAPIKey hides all but the last four characters of an API key so it can be
+// logged and reported.
+func MaskAPIKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
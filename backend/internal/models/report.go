@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// HealthReport is the periodic query health summary posted to the report webhook.
+type HealthReport struct {
+	// PeriodStart and PeriodEnd bound the queries covered by the report
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+
+	TotalQueries  uint64 `json:"total_queries"`
+	FailedQueries uint64 `json:"failed_queries"`
+
+	// ErrorRate is FailedQueries / TotalQueries (0 when there were no queries)
+	ErrorRate float64 `json:"error_rate"`
+
+	// SlowestQueries are the slowest queries of the period
+	SlowestQueries []QueryLog `json:"slowest_queries"`
+
+	// Errors are the most frequent exception codes among failed queries
+	Errors []QueryLogGroupStats `json:"errors"`
+
+	// ExportLocation is where the slowest queries CSV was uploaded, when enabled
+	ExportLocation string `json:"export_location,omitempty"`
+}
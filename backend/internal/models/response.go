@@ -0,0 +1,20 @@
+package models
+
+// Response is the standard success envelope for API responses.
+type Response struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta,omitempty"`
+
+	// Warnings lists adjustments the server made to the request, e.g. a
+	// clamped limit or a default time range. Omitted when there are none.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ErrorResponse is the standard error envelope for API responses.
+type ErrorResponse struct {
+	// Error is a machine-readable error code
+	Error string `json:"error"`
+
+	// Message is a human-readable description of the error
+	Message string `json:"message"`
+}
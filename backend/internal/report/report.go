@@ -0,0 +1,228 @@
+// Package report sends a periodic query health summary to a webhook.
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
+	"github.com/actio/clickhouse-monitoring/internal/repository"
+)
+
+// Scheduler generates a HealthReport every Interval and posts it to the webhook.
+type Scheduler struct {
+	repo   repository.QueryLogStore
+	store  *objectstore.S3
+	cfg    config.ReportConfig
+	client *http.Client
+}
+
+// NewScheduler creates a report scheduler. It returns nil when no webhook is
+// configured. store may be nil, which disables the CSV upload.
+func NewScheduler(repo repository.QueryLogStore, store *objectstore.S3, cfg config.ReportConfig) (*Scheduler, error) {
+	if cfg.WebhookURL == "" {
+		return nil, nil
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("REPORT_INTERVAL must be positive")
+	}
+	if cfg.At != "" {
+		if _, err := time.Parse("15:04", cfg.At); err != nil {
+			return nil, fmt.Errorf("invalid REPORT_AT %q (expected HH:MM)", cfg.At)
+		}
+	}
+	if cfg.ExportCSV && store == nil {
+		return nil, fmt.Errorf("REPORT_EXPORT_CSV requires EXPORT_S3_BUCKET")
+	}
+	if cfg.TopN <= 0 {
+		cfg.TopN = 10
+	}
+	return &Scheduler{repo: repo, store: store, cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Run sends reports until ctx is cancelled. A failed report is logged and the
+// schedule continues.
+func (s *Scheduler) Run(ctx context.Context) {
+	next := s.firstRun(time.Now().UTC())
+	for {
+		log.Printf("Next query health report at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := s.send(ctx, next.Add(-s.cfg.Interval), next); err != nil {
+			log.Printf("Failed to send query health report: %v", err)
+		}
+		next = next.Add(s.cfg.Interval)
+	}
+}
+
+// firstRun returns the first report time: the next occurrence of At, or one
+// Interval from now when At is not set.
+func (s *Scheduler) firstRun(now time.Time) time.Time {
+	if s.cfg.At == "" {
+		return now.Add(s.cfg.Interval)
+	}
+	at, _ := time.Parse("15:04", s.cfg.At)
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// send builds the report for [start, end) and posts it to the webhook.
+func (s *Scheduler) send(ctx context.Context, start, end time.Time) error {
+	report, err := s.build(ctx, start, end)
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.ExportCSV {
+		name := fmt.Sprintf("report_slowest_%s.csv", end.Format("20060102_150405"))
+		if err := s.upload(ctx, name, report.SlowestQueries); err != nil {
+			// The webhook is still sent without the attachment
+			log.Printf("Failed to upload report CSV: %v", err)
+		} else {
+			report.ExportLocation = s.store.URI(name)
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text":   formatText(report),
+		"report": report,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	log.Printf("Sent query health report: queries=%d failed=%d", report.TotalQueries, report.FailedQueries)
+	return nil
+}
+
+// build queries the report data for [start, end).
+func (s *Scheduler) build(ctx context.Context, start, end time.Time) (*models.HealthReport, error) {
+	filter := models.QueryLogFilter{StartTime: &start, EndTime: &end}
+	report := &models.HealthReport{PeriodStart: start, PeriodEnd: end}
+
+	total, err := s.repo.CountQueryLogs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queries: %w", err)
+	}
+	report.TotalQueries = total
+
+	failedFilter := filter
+	failedFilter.OnlyFailed = true
+	failed, err := s.repo.CountQueryLogs(ctx, failedFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed queries: %w", err)
+	}
+	report.FailedQueries = failed
+	if total > 0 {
+		report.ErrorRate = float64(failed) / float64(total)
+	}
+
+	slowFilter := filter
+	slowFilter.SortBy = "query_duration_ms"
+	slowFilter.SortOrder = "desc"
+	slowFilter.Limit = s.cfg.TopN
+	report.SlowestQueries, err = s.repo.GetQueryLogs(ctx, slowFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slowest queries: %w", err)
+	}
+
+	failedFilter.Limit = s.cfg.TopN
+	report.Errors, err = s.repo.GetGroupedStats(ctx, failedFilter, models.GroupByParams{Dimension: "exception_code"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get error breakdown: %w", err)
+	}
+	return report, nil
+}
+
+// upload writes the slowest queries as CSV to the export store.
+func (s *Scheduler) upload(ctx context.Context, name string, logs []models.QueryLog) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"event_time", "query_id", "user", "query_duration_ms", "read_rows", "memory_usage", "exception_code", "query"})
+	for _, l := range logs {
+		w.Write([]string{
+			l.EventTime.Format(time.RFC3339),
+			l.QueryID,
+			l.User,
+			strconv.FormatUint(l.QueryDurationMs, 10),
+			strconv.FormatUint(l.ReadRows, 10),
+			strconv.FormatInt(l.MemoryUsage, 10),
+			strconv.Itoa(int(l.ExceptionCode)),
+			l.Query,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return s.store.PutObject(ctx, name, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "text/csv")
+}
+
+// formatText renders the report as plain text for chat webhooks.
+func formatText(r *models.HealthReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ClickHouse query health report (%s to %s UTC)\n",
+		r.PeriodStart.Format("2006-01-02 15:04"), r.PeriodEnd.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Queries: %d, failed: %d (%.2f%%)\n", r.TotalQueries, r.FailedQueries, r.ErrorRate*100)
+
+	if len(r.SlowestQueries) > 0 {
+		b.WriteString("\nSlowest queries:\n")
+		for i, q := range r.SlowestQueries {
+			fmt.Fprintf(&b, "%d. %d ms, %s: %s\n", i+1, q.QueryDurationMs, q.User, truncate(q.Query, 120))
+		}
+	}
+	if len(r.Errors) > 0 {
+		b.WriteString("\nErrors by exception code:\n")
+		for _, e := range r.Errors {
+			fmt.Fprintf(&b, "- code %s %s: %d queries\n", e.Key, e.ErrorName, e.TotalQueries)
+		}
+	}
+	if r.ExportLocation != "" {
+		fmt.Fprintf(&b, "\nCSV: %s\n", r.ExportLocation)
+	}
+	return b.String()
+}
+
+// truncate shortens s to at most n runes on a single line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// AnnotationStore persists annotations attached to query IDs.
+type AnnotationStore interface {
+	// Add stores a new annotation, assigning its ID and creation time.
+	Add(ctx context.Context, annotation models.Annotation) (models.Annotation, error)
+
+	// List returns annotations for the given query ID, or all annotations if queryID is empty.
+	List(ctx context.Context, queryID string) ([]models.Annotation, error)
+}
+
+// FileAnnotationStore is an AnnotationStore backed by a single JSON file.
+// The whole file is loaded at startup and rewritten on every change,
+// which is fine for the small number of notes a team produces.
+type FileAnnotationStore struct {
+	path        string
+	mu          sync.RWMutex
+	annotations []models.Annotation
+}
+
+// NewFileAnnotationStore creates a FileAnnotationStore, loading any existing
+// annotations from path. A missing file is treated as an empty store.
+func NewFileAnnotationStore(path string) (*FileAnnotationStore, error) {
+	store := &FileAnnotationStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotations file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.annotations); err != nil {
+		return nil, fmt.Errorf("failed to parse annotations file: %w", err)
+	}
+
+	return store, nil
+}
+
+// Add stores a new annotation and persists the file.
+func (s *FileAnnotationStore) Add(ctx context.Context, annotation models.Annotation) (models.Annotation, error) {
+	id, err := newAnnotationID()
+	if err != nil {
+		return models.Annotation{}, err
+	}
+	annotation.ID = id
+	annotation.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := append(s.annotations, annotation)
+	if err := s.save(updated); err != nil {
+		return models.Annotation{}, err
+	}
+	s.annotations = updated
+
+	return annotation, nil
+}
+
+// List returns annotations for queryID in creation order.
+func (s *FileAnnotationStore) List(ctx context.Context, queryID string) ([]models.Annotation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]models.Annotation, 0)
+	for _, a := range s.annotations {
+		if queryID == "" || a.QueryID == queryID {
+			result = append(result, a)
+		}
+	}
+
+	return result, nil
+}
+
+// save writes annotations to a temporary file and renames it into place,
+// so a crash mid-write never leaves a truncated file behind.
+func (s *FileAnnotationStore) save(annotations []models.Annotation) error {
+	data, err := json.MarshalIndent(annotations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode annotations: %w", err)
+	}
+
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create annotations directory: %w", err)
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write annotations file: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace annotations file: %w", err)
+	}
+
+	return nil
+}
+
+// newAnnotationID generates a random 16-byte hex identifier.
+func newAnnotationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate annotation ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
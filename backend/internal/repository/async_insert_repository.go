@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// ErrLogNotEnabled is returned when an optional system log table doesn't exist
+// on the server because the corresponding log is not enabled.
+var ErrLogNotEnabled = errors.New("system log table is not enabled")
+
+// GetAsyncInserts retrieves asynchronous inserts from
+// system.asynchronous_insert_log, newest first. Returns ErrLogNotEnabled when
+// the server doesn't have the table.
+func (r *QueryLogRepository) GetAsyncInserts(ctx context.Context, filter models.AsyncInsertFilter) ([]models.AsyncInsertLog, error) {
+	query, args := r.buildAsyncInsertsQuery(filter)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if database.IsUnknownTable(err) {
+			return nil, fmt.Errorf("asynchronous_insert_log: %w", ErrLogNotEnabled)
+		}
+		return nil, fmt.Errorf("failed to query async inserts: %w", err)
+	}
+	defer rows.Close()
+
+	inserts := make([]models.AsyncInsertLog, 0)
+	for rows.Next() {
+		var a models.AsyncInsertLog
+		err := rows.Scan(
+			&a.EventTime,
+			&a.QueryID,
+			&a.Database,
+			&a.Table,
+			&a.Format,
+			&a.Bytes,
+			&a.Rows,
+			&a.Status,
+			&a.Exception,
+			&a.FlushTime,
+			&a.FlushQueryID,
+			&a.FlushDelayMs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan async insert row: %w", err)
+		}
+		inserts = append(inserts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating async insert rows: %w", err)
+	}
+
+	return inserts, nil
+}
+
+// buildAsyncInsertsQuery constructs the SQL query for asynchronous inserts.
+func (r *QueryLogRepository) buildAsyncInsertsQuery(filter models.AsyncInsertFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.StartTime != nil {
+		conditions = append(conditions, "event_date >= toDate(?, timezone())", "event_time >= ?")
+		args = append(args, *filter.StartTime, *filter.StartTime)
+	}
+
+	if filter.EndTime != nil {
+		conditions = append(conditions, "event_date <= toDate(?, timezone())", "event_time <= ?")
+		args = append(args, *filter.EndTime, *filter.EndTime)
+	}
+
+	if filter.Database != "" {
+		conditions = append(conditions, "database = ?")
+		args = append(args, filter.Database)
+	}
+
+	if filter.Table != "" {
+		conditions = append(conditions, "table = ?")
+		args = append(args, filter.Table)
+	}
+
+	// Validated against ValidAsyncInsertStatuses by the handler
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	if filter.QueryID != "" {
+		conditions = append(conditions, "query_id = ?")
+		args = append(args, filter.QueryID)
+	}
+
+	if len(r.opts.AllowedDatabases) > 0 {
+		conditions = append(conditions, "has(?, database)")
+		args = append(args, r.opts.AllowedDatabases)
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(`
+		SELECT
+			event_time,
+			query_id,
+			database,
+			table,
+			format,
+			bytes,
+			rows,
+			toString(status),
+			exception,
+			flush_time,
+			flush_query_id,
+			toInt64(dateDiff('millisecond', event_time_microseconds, flush_time_microseconds)) AS flush_delay_ms
+		FROM system.asynchronous_insert_log`)
+
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	queryBuilder.WriteString(" ORDER BY event_time DESC, event_time_microseconds DESC, query_id")
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	queryBuilder.WriteString(" LIMIT ? OFFSET ?")
+	args = append(args, limit, filter.Offset)
+
+	return queryBuilder.String(), args
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestParseColumns(t *testing.T) {
+	// One more entry than there are valid columns, all of them valid
+	overCap := strings.TrimSuffix(strings.Repeat("query_id,", len(models.ValidColumns)+1), ",")
+
+	tests := []struct {
+		name    string
+		param   string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty selects the full record", param: "", want: models.AllColumns()},
+		{name: "order preserved", param: "user,query_id,read_rows", want: []string{"user", "query_id", "read_rows"}},
+		{name: "duplicates dropped", param: "query,query,query", want: []string{"query"}},
+		{name: "first occurrence wins", param: "user,query_id,user,read_rows,query_id", want: []string{"user", "query_id", "read_rows"}},
+		{name: "whitespace and blanks ignored", param: " query_id , ,query_id, user ", want: []string{"query_id", "user"}},
+		{name: "derived and array columns", param: "tables,error_name,tables", want: []string{"tables", "error_name"}},
+		{name: "at the cap", param: strings.Join(slices.Sorted(maps.Keys(models.ValidColumns)), ","), want: slices.Sorted(maps.Keys(models.ValidColumns))},
+		{name: "over the cap", param: overCap, wantErr: "too many columns"},
+		{name: "unknown column", param: "query_id,password", wantErr: "invalid column: password"},
+		{name: "only separators", param: ",,", wantErr: "at least one valid column is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseColumns(tt.param)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseColumns(%q) error = %v, want %q", tt.param, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseColumns(%q): %v", tt.param, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseColumns(%q) = %v, want %v", tt.param, got, tt.want)
+			}
+		})
+	}
+}
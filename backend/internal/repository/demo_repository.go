@@ -0,0 +1,1480 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+const (
+	// demoSeed fixes the generator so every demo instance holds the same rows
+	// relative to its start time
+	demoSeed = 20240122
+
+	// demoHistory is how far back the synthetic query_log reaches
+	demoHistory = 7 * 24 * time.Hour
+
+	// demoQueriesPerHour is the average hourly query rate; the actual rate
+	// follows a daily cycle peaking in the afternoon
+	demoQueriesPerHour = 120
+)
+
+// demoFailure is a way a demo query can fail, with its probability.
+type demoFailure struct {
+	rate    float64
+	typ     string
+	code    int32
+	name    string
+	message string
+}
+
+// demoTemplate describes one kind of query in the synthetic workload. The
+// query text uses %d for literals; the normalized pattern replaces them with ?.
+type demoTemplate struct {
+	weight     int
+	kind       string
+	query      string
+	databases  []string
+	tables     []string
+	user       string
+	osUser     string
+	clientName string
+	hostname   string
+	userAgent  string
+	iface      uint8
+
+	// durationMs and readRows are medians; rows vary log-normally around them
+	durationMs float64
+	readRows   float64
+	rowBytes   float64
+
+	// writtenRows is the median batch size of inserts (0 for reads)
+	writtenRows float64
+
+	// cacheHitRate is the fraction of executions served from the query cache
+	cacheHitRate float64
+
+	// traced queries carry a trace ID, as if their client set log_comment
+	traced bool
+
+	// used lists the SQL features the query uses by used_* column (see
+	// models.UsedFeatureColumns); unlisted columns are empty
+	used map[string][]string
+
+	failures []demoFailure
+}
+
+var (
+	demoMemoryLimit = demoFailure{
+		typ:     "ExceptionWhileProcessing",
+		code:    241,
+		name:    "MEMORY_LIMIT_EXCEEDED",
+		message: "Code: 241. DB::Exception: Memory limit (for query) exceeded: would use 9.32 GiB (attempt to allocate chunk of 4194304 bytes), maximum: 9.31 GiB. (MEMORY_LIMIT_EXCEEDED)",
+	}
+	demoTimeout = demoFailure{
+		typ:     "ExceptionWhileProcessing",
+		code:    159,
+		name:    "TIMEOUT_EXCEEDED",
+		message: "Code: 159. DB::Exception: Timeout exceeded: elapsed 70.002 seconds, maximum: 70. (TIMEOUT_EXCEEDED)",
+	}
+	demoCancelled = demoFailure{
+		typ:     "ExceptionWhileProcessing",
+		code:    394,
+		name:    "QUERY_WAS_CANCELLED",
+		message: "Code: 394. DB::Exception: Query was cancelled. (QUERY_WAS_CANCELLED)",
+	}
+)
+
+// demoTemplates is the synthetic workload: dashboards, reports, ETL inserts,
+// point lookups from an API, maintenance and a few broken queries.
+var demoTemplates = []demoTemplate{
+	{
+		weight:       30,
+		kind:         "Select",
+		query:        "SELECT toStartOfHour(ts) AS hour, count() AS events FROM analytics.events WHERE site_id = %d AND ts >= now() - INTERVAL %d HOUR GROUP BY hour ORDER BY hour",
+		databases:    []string{"analytics"},
+		tables:       []string{"analytics.events"},
+		user:         "grafana",
+		osUser:       "grafana",
+		clientName:   "Grafana",
+		hostname:     "grafana-0",
+		userAgent:    "Grafana/10.2.3",
+		iface:        2,
+		durationMs:   180,
+		readRows:     4e6,
+		rowBytes:     24,
+		cacheHitRate: 0.3,
+		failures:     []demoFailure{withRate(demoCancelled, 0.01)},
+		used: map[string][]string{
+			"used_functions":           {"and", "equals", "greaterOrEquals", "minus", "now", "toIntervalHour", "toStartOfHour"},
+			"used_aggregate_functions": {"count"},
+			"used_storages":            {"MergeTree"},
+		},
+	},
+	{
+		weight:     10,
+		kind:       "Select",
+		query:      "SELECT user_id, sum(amount) AS revenue FROM analytics.orders WHERE order_date = today() - %d GROUP BY user_id ORDER BY revenue DESC LIMIT %d",
+		databases:  []string{"analytics"},
+		tables:     []string{"analytics.orders"},
+		user:       "analyst",
+		osUser:     "alice",
+		clientName: "ClickHouse client",
+		hostname:   "laptop-alice",
+		iface:      1,
+		durationMs: 650,
+		readRows:   2.5e7,
+		rowBytes:   32,
+		failures:   []demoFailure{withRate(demoTimeout, 0.01)},
+		used: map[string][]string{
+			"used_functions":           {"equals", "minus", "today"},
+			"used_aggregate_functions": {"sum"},
+			"used_storages":            {"ReplacingMergeTree"},
+		},
+	},
+	{
+		weight:     4,
+		kind:       "Select",
+		query:      "SELECT e.country, uniqExact(e.user_id) AS users FROM analytics.events AS e INNER JOIN crm.customers AS c ON e.user_id = c.id WHERE c.tier = %d GROUP BY e.country ORDER BY users DESC",
+		databases:  []string{"analytics", "crm"},
+		tables:     []string{"analytics.events", "crm.customers"},
+		user:       "analyst",
+		osUser:     "bob",
+		clientName: "DBeaver",
+		hostname:   "laptop-bob",
+		userAgent:  "DBeaver 23.3.0",
+		iface:      2,
+		durationMs: 9000,
+		readRows:   3e8,
+		rowBytes:   40,
+		failures:   []demoFailure{withRate(demoMemoryLimit, 0.08), withRate(demoTimeout, 0.04)},
+		used: map[string][]string{
+			"used_functions":           {"equals"},
+			"used_aggregate_functions": {"uniqExact"},
+			"used_storages":            {"MergeTree", "ReplacingMergeTree"},
+		},
+	},
+	{
+		weight:      20,
+		kind:        "Insert",
+		query:       "INSERT INTO analytics.events (ts, site_id, user_id, event, props) FORMAT RowBinary",
+		databases:   []string{"analytics"},
+		tables:      []string{"analytics.events"},
+		user:        "etl",
+		osUser:      "etl",
+		clientName:  "clickhouse-go",
+		hostname:    "ingest-1",
+		iface:       1,
+		durationMs:  120,
+		rowBytes:    90,
+		writtenRows: 50000,
+		failures:    []demoFailure{withRate(demoMemoryLimit, 0.005)},
+		used: map[string][]string{
+			"used_formats":  {"RowBinary"},
+			"used_storages": {"MergeTree"},
+		},
+	},
+	{
+		weight:      6,
+		kind:        "Insert",
+		query:       "INSERT INTO crm.customers FORMAT JSONEachRow",
+		databases:   []string{"crm"},
+		tables:      []string{"crm.customers"},
+		user:        "api",
+		osUser:      "app",
+		clientName:  "clickhouse-go",
+		hostname:    "api-7f9c",
+		iface:       2,
+		durationMs:  15,
+		rowBytes:    180,
+		writtenRows: 40,
+		traced:      true,
+		used: map[string][]string{
+			"used_formats":  {"JSONEachRow"},
+			"used_storages": {"ReplacingMergeTree"},
+		},
+	},
+	{
+		weight:     25,
+		kind:       "Select",
+		query:      "SELECT id, email, tier, created_at FROM crm.customers WHERE id = %d",
+		databases:  []string{"crm"},
+		tables:     []string{"crm.customers"},
+		user:       "api",
+		osUser:     "app",
+		clientName: "clickhouse-go",
+		hostname:   "api-7f9c",
+		iface:      2,
+		durationMs: 8,
+		readRows:   8192,
+		rowBytes:   120,
+		traced:     true,
+		used: map[string][]string{
+			"used_functions": {"equals"},
+			"used_storages":  {"ReplacingMergeTree"},
+		},
+	},
+	{
+		weight:     1,
+		kind:       "Alter",
+		query:      "ALTER TABLE analytics.events DELETE WHERE ts < now() - INTERVAL %d DAY",
+		databases:  []string{"analytics"},
+		tables:     []string{"analytics.events"},
+		user:       "etl",
+		osUser:     "etl",
+		clientName: "clickhouse-go",
+		hostname:   "ingest-1",
+		iface:      1,
+		durationMs: 40,
+		used: map[string][]string{
+			"used_functions": {"less", "minus", "now", "toIntervalDay"},
+			"used_storages":  {"MergeTree"},
+		},
+	},
+	{
+		weight:     3,
+		kind:       "Select",
+		query:      "SELECT database, table, sum(bytes_on_disk) FROM system.parts WHERE active GROUP BY database, table",
+		databases:  []string{"system"},
+		tables:     []string{"system.parts"},
+		user:       "default",
+		osUser:     "root",
+		clientName: "ClickHouse client",
+		hostname:   "clickhouse-0",
+		iface:      1,
+		durationMs: 5,
+		readRows:   1200,
+		rowBytes:   60,
+		used: map[string][]string{
+			"used_aggregate_functions": {"sum"},
+			"used_storages":            {"SystemParts"},
+		},
+	},
+	{
+		weight:     1,
+		kind:       "Select",
+		query:      "SELEC count() FROM analytics.events WHERE site_id = %d",
+		databases:  []string{},
+		tables:     []string{},
+		user:       "analyst",
+		osUser:     "alice",
+		clientName: "ClickHouse client",
+		hostname:   "laptop-alice",
+		iface:      1,
+		failures: []demoFailure{{
+			rate:    1,
+			typ:     "ExceptionBeforeStart",
+			code:    62,
+			name:    "SYNTAX_ERROR",
+			message: "Code: 62. DB::Exception: Syntax error: failed at position 1 ('SELEC'): SELEC count() FROM analytics.events. Expected one of: Query, SELECT query. (SYNTAX_ERROR)",
+		}},
+	},
+	{
+		weight:     1,
+		kind:       "Select",
+		query:      "SELECT * FROM analytics.events_archive WHERE site_id = %d LIMIT %d",
+		databases:  []string{"analytics"},
+		tables:     []string{"analytics.events_archive"},
+		user:       "grafana",
+		osUser:     "grafana",
+		clientName: "Grafana",
+		hostname:   "grafana-0",
+		userAgent:  "Grafana/10.2.3",
+		iface:      2,
+		failures: []demoFailure{{
+			rate:    1,
+			typ:     "ExceptionBeforeStart",
+			code:    60,
+			name:    "UNKNOWN_TABLE",
+			message: "Code: 60. DB::Exception: Table analytics.events_archive does not exist. (UNKNOWN_TABLE)",
+		}},
+	},
+}
+
+// withRate returns f with the given probability.
+func withRate(f demoFailure, rate float64) demoFailure {
+	f.rate = rate
+	return f
+}
+
+// demoDatabases are the databases listed by GetDatabases in demo mode.
+var demoDatabases = []string{"analytics", "crm", "default", "system"}
+
+// demoRow is a synthetic query_log row together with the columns that
+// QueryLog doesn't carry but filters and aggregations use.
+type demoRow struct {
+	recentEntry
+
+	queryKind       string
+	normalizedHash  uint64
+	normalizedQuery string
+	osUser          string
+	clientName      string
+	cacheUsage      string
+	used            map[string][]string
+	iface           uint8
+	partsCreated    float64
+}
+
+// demoView is a synthetic view execution with the query that triggered it.
+type demoView struct {
+	view  models.QueryViewLog
+	query string
+}
+
+// DemoRepository is a QueryLogStore serving a deterministic synthetic
+// workload from memory, for trying the UI without ClickHouse (DEMO_MODE).
+// The data covers the week before the repository was created and doesn't
+// grow afterwards. Filters, sorting, pagination and AllowedDatabases behave
+// as they do against ClickHouse; the shard filter reads the same data, and
+// ColumnTypes and the recent logs buffer don't apply.
+type DemoRepository struct {
+	opts Options
+
+	// rows are ordered newest first, like the default list order
+	rows    []demoRow
+	views   []demoView
+	inserts []models.AsyncInsertLog
+
+	shards           map[string]bool
+	allowedDatabases map[string]bool
+}
+
+// NewDemoRepository generates the demo data ending at now.
+func NewDemoRepository(now time.Time, opts Options) *DemoRepository {
+	d := &DemoRepository{opts: opts, shards: make(map[string]bool, len(opts.ShardHosts))}
+	for _, host := range opts.ShardHosts {
+		d.shards[host] = true
+	}
+	if len(opts.AllowedDatabases) > 0 {
+		d.allowedDatabases = make(map[string]bool, len(opts.AllowedDatabases))
+		for _, name := range opts.AllowedDatabases {
+			d.allowedDatabases[name] = true
+		}
+	}
+	d.generate(now.Truncate(time.Second))
+	return d
+}
+
+// generate fills the repository with demoHistory of queries up to end.
+func (d *DemoRepository) generate(end time.Time) {
+	rng := rand.New(rand.NewPCG(demoSeed, demoSeed))
+
+	totalWeight := 0
+	for _, t := range demoTemplates {
+		totalWeight += t.weight
+	}
+
+	for hour := end.Add(-demoHistory).Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		// Daily cycle: quiet at night, busiest mid-afternoon UTC
+		load := 1 + 0.8*math.Sin(float64(hour.Hour()-9)/24*2*math.Pi)
+		n := int(demoQueriesPerHour * load * (0.8 + 0.4*rng.Float64()))
+		for range n {
+			eventTime := hour.Add(time.Duration(rng.Int64N(int64(time.Hour)))).Truncate(time.Second)
+			if eventTime.Before(end.Add(-demoHistory)) || eventTime.After(end) {
+				continue
+			}
+
+			pick := rng.IntN(totalWeight)
+			for i := range demoTemplates {
+				if pick < demoTemplates[i].weight {
+					d.addQuery(rng, &demoTemplates[i], eventTime, load)
+					break
+				}
+				pick -= demoTemplates[i].weight
+			}
+		}
+	}
+
+	sort.SliceStable(d.rows, func(i, j int) bool {
+		return demoCompare(&d.rows[i], &d.rows[j], "event_time") > 0
+	})
+	sort.SliceStable(d.views, func(i, j int) bool { return d.views[i].view.EventTime.After(d.views[j].view.EventTime) })
+	sort.SliceStable(d.inserts, func(i, j int) bool { return d.inserts[i].EventTime.After(d.inserts[j].EventTime) })
+}
+
+// addQuery appends one execution of t at eventTime, slowed down under load,
+// together with the view executions and async inserts it causes.
+func (d *DemoRepository) addQuery(rng *rand.Rand, t *demoTemplate, eventTime time.Time, load float64) {
+	literals := make([]any, strings.Count(t.query, "%d"))
+	for i := range literals {
+		literals[i] = 1 + rng.IntN(1000)
+	}
+	normalized := strings.ReplaceAll(t.query, "%d", "?")
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+
+	row := demoRow{
+		queryKind:       t.kind,
+		normalizedHash:  h.Sum64(),
+		normalizedQuery: normalized,
+		osUser:          t.osUser,
+		clientName:      t.clientName,
+		used:            t.used,
+		cacheUsage:      "None",
+		iface:           t.iface,
+	}
+	if t.kind == "Select" && rng.Float64() < t.cacheHitRate {
+		row.cacheUsage = "Read"
+	}
+
+	log := &row.log
+	log.QueryID = demoUUID(rng)
+	log.Query = fmt.Sprintf(t.query, literals...)
+	log.EventTime = eventTime
+	log.EventDate = startOfUTCDay(eventTime)
+	log.Type = "QueryFinish"
+	log.Databases = t.databases
+	log.Tables = t.tables
+	log.User = t.user
+	log.ClientHostname = t.hostname
+	log.HTTPUserAgent = t.userAgent
+	log.InitialUser = t.user
+	log.InitialQueryID = log.QueryID
+	log.IsInitialQuery = 1
+	if t.traced {
+		log.TraceID = fmt.Sprintf("%016x%016x", rng.Uint64(), rng.Uint64())
+	}
+
+	// Log-normal spread around the template's medians
+	spread := math.Exp(rng.NormFloat64() * 0.6)
+	log.QueryDurationMs = uint64(t.durationMs * spread * load)
+	log.ReadRows = uint64(t.readRows * spread)
+	log.ReadBytes = uint64(float64(log.ReadRows) * t.rowBytes)
+	if t.writtenRows > 0 {
+		log.WrittenRows = uint64(t.writtenRows * math.Exp(rng.NormFloat64()*0.5))
+		log.WrittenBytes = uint64(float64(log.WrittenRows) * t.rowBytes)
+		row.partsCreated = float64(1 + rng.IntN(3))
+	} else if log.ReadRows > 0 {
+		log.ResultRows = uint64(1 + rng.IntN(500))
+		log.ResultBytes = log.ResultRows * 48
+	}
+	log.MemoryUsage = int64(4<<20 + float64(log.ReadBytes+log.WrittenBytes)*0.05)
+	row.peakMemory = log.MemoryUsage + log.MemoryUsage/5
+
+	failed := false
+	for _, f := range t.failures {
+		if rng.Float64() < f.rate {
+			log.Type = f.typ
+			log.ExceptionCode = f.code
+			log.ErrorName = f.name
+			log.Exception = f.message
+			if f.typ == "ExceptionBeforeStart" {
+				log.QueryDurationMs, log.ReadRows, log.ReadBytes = 0, 0, 0
+				log.WrittenRows, log.WrittenBytes, log.ResultRows, log.ResultBytes = 0, 0, 0, 0
+				log.MemoryUsage, row.peakMemory = 0, 0
+			}
+			failed = true
+			break
+		}
+	}
+
+	d.rows = append(d.rows, row)
+
+	// Inserts into analytics.events feed a materialized view
+	if t.kind == "Insert" && slices.Contains(t.tables, "analytics.events") {
+		status := "QueryFinish"
+		if failed {
+			status = log.Type
+		}
+		d.views = append(d.views, demoView{
+			view: models.QueryViewLog{
+				EventTime:       eventTime,
+				InitialQueryID:  log.QueryID,
+				ViewName:        "analytics.events_hourly_mv",
+				ViewType:        "Materialized",
+				ViewTarget:      "analytics.events_hourly",
+				ViewDurationMs:  log.QueryDurationMs / 3,
+				ReadRows:        log.WrittenRows,
+				ReadBytes:       log.WrittenBytes,
+				WrittenRows:     log.WrittenRows / 100,
+				WrittenBytes:    log.WrittenBytes / 100,
+				PeakMemoryUsage: log.MemoryUsage / 4,
+				Status:          status,
+				ExceptionCode:   log.ExceptionCode,
+				Exception:       log.Exception,
+			},
+			query: log.Query,
+		})
+	}
+
+	// JSONEachRow inserts from the API use asynchronous inserts
+	if t.kind == "Insert" && strings.HasSuffix(t.query, "JSONEachRow") {
+		insert := models.AsyncInsertLog{
+			EventTime:    eventTime,
+			QueryID:      log.QueryID,
+			Database:     "crm",
+			Table:        "customers",
+			Format:       "JSONEachRow",
+			Bytes:        log.WrittenBytes,
+			Rows:         log.WrittenRows,
+			Status:       "Ok",
+			FlushDelayMs: int64(200 + rng.IntN(800)),
+			FlushQueryID: demoUUID(rng),
+		}
+		insert.FlushTime = eventTime.Add(time.Duration(insert.FlushDelayMs) * time.Millisecond).Truncate(time.Second)
+		if rng.Float64() < 0.02 {
+			insert.Status = "ParsingError"
+			insert.Exception = "Code: 117. DB::Exception: Cannot parse JSON object here: {\"id\": 4021, \"email\": }: (at row 1). (INCORRECT_DATA)"
+			insert.Rows = 0
+		}
+		d.inserts = append(d.inserts, insert)
+	}
+}
+
+// demoUUID returns a random version 4 UUID from rng.
+func demoUUID(rng *rand.Rand) string {
+	hi, lo := rng.Uint64(), rng.Uint64()
+	return fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x",
+		hi>>32, (hi>>16)&0xffff, hi&0xfff, (lo>>48)&0x3fff|0x8000, lo&0xffffffffffff)
+}
+
+// startOfUTCDay returns midnight UTC of t's day, the demo's event_date.
+func startOfUTCDay(t time.Time) time.Time {
+	y, m, day := t.UTC().Date()
+	return time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+}
+
+// HealthCheck always succeeds; it lets the repository stand in for the
+// database in the readiness check.
+func (d *DemoRepository) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// BreakerState reports the circuit breaker as closed.
+func (d *DemoRepository) BreakerState() string {
+	return "closed"
+}
+
+// WriteMetrics writes the metrics of a closed circuit breaker.
+func (d *DemoRepository) WriteMetrics(w io.Writer) error {
+	return database.WriteIdleBreakerMetrics(w)
+}
+
+// LastPing returns the zero time, since there is no database to ping.
+func (d *DemoRepository) LastPing() time.Time {
+	return time.Time{}
+}
+
+// HasColumn reports every valid column as present, including the optional ones.
+func (d *DemoRepository) HasColumn(ctx context.Context, name string) (bool, error) {
+	return models.ValidColumns[name], nil
+}
+
+// AllowedDatabase reports whether name may be exposed by this deployment.
+func (d *DemoRepository) AllowedDatabase(name string) bool {
+	return d.allowedDatabases == nil || d.allowedDatabases[name]
+}
+
+// ValidShard reports whether shard may be used as the shard filter.
+func (d *DemoRepository) ValidShard(shard string) bool {
+	return shard == "" || d.shards[shard]
+}
+
+// matches reports whether row passes filter and the AllowedDatabases scope,
+// mirroring the conditions of buildConditions.
+func (d *DemoRepository) matches(row *demoRow, filter models.QueryLogFilter) bool {
+	log := &row.log
+	failed := log.ExceptionCode != 0 || log.Type == "ExceptionBeforeStart"
+
+	switch {
+	case filter.DBName != "" && !slices.Contains(log.Databases, filter.DBName),
+		filter.QueryID != "" && log.QueryID != filter.QueryID,
+		filter.InitialQueryID != "" && log.InitialQueryID != filter.InitialQueryID,
+		filter.OnlyFailed && !failed,
+		filter.OnlySuccess && (log.Type != "QueryFinish" || log.ExceptionCode != 0),
+		filter.HasException && log.ExceptionCode == 0 && log.Exception == "" && !strings.HasPrefix(log.Type, "Exception"),
+		len(filter.ExceptionCodes) > 0 && !slices.Contains(filter.ExceptionCodes, log.ExceptionCode),
+		log.QueryDurationMs < filter.MinDurationMs,
+		uint64(row.peakMemory) < filter.MinPeakMemoryUsage,
+		filter.MinMemoryPerRow > 0 && float64(log.MemoryUsage)/float64(max(log.ReadRows, 1)) < filter.MinMemoryPerRow,
+		log.ReadRows < filter.MinReadRows,
+		uint64(len(log.Tables)) < filter.MinTables,
+		uint64(len(log.Databases)) < filter.MinDatabases,
+		filter.User != "" && log.User != filter.User,
+		filter.OSUser != "" && row.osUser != filter.OSUser,
+		filter.ClientName != "" && row.clientName != filter.ClientName,
+		filter.InsertTarget != "" && (row.queryKind != "Insert" || !slices.Contains(log.Tables, filter.InsertTarget)),
+		slices.ContainsFunc(filter.UsedFeatures(), func(f models.UsedFeature) bool { return !slices.Contains(row.used[f.Column], f.Name) }),
+		filter.Type != "" && log.Type != filter.Type,
+		filter.CacheUsage != "" && row.cacheUsage != filter.CacheUsage,
+		filter.StartTime != nil && log.EventTime.Before(*filter.StartTime),
+		filter.EndTime != nil && log.EventTime.After(*filter.EndTime),
+		filter.After != nil && !log.EventTime.After(*filter.After):
+		return false
+	}
+
+	query, contains, prefix := log.Query, filter.QueryContains, filter.QueryStartsWith
+	if !filter.CaseSensitive {
+		query, contains, prefix = strings.ToLower(query), strings.ToLower(contains), strings.ToLower(prefix)
+	}
+	if !strings.Contains(query, contains) || !strings.HasPrefix(query, prefix) {
+		return false
+	}
+
+	return d.allowedDatabases == nil || slices.ContainsFunc(log.Databases, d.AllowedDatabase)
+}
+
+// filtered returns the rows matching filter, newest first.
+func (d *DemoRepository) filtered(filter models.QueryLogFilter) []*demoRow {
+	var matched []*demoRow
+	for i := range d.rows {
+		if d.matches(&d.rows[i], filter) {
+			matched = append(matched, &d.rows[i])
+		}
+	}
+	return matched
+}
+
+// demoCompare compares two rows by a ValidSortColumns column, falling back to
+// event_time and query_id so the order is total.
+func demoCompare(a, b *demoRow, column string) int {
+	var c int
+	switch column {
+	case "query_duration_ms":
+		c = cmp.Compare(a.log.QueryDurationMs, b.log.QueryDurationMs)
+	case "memory_usage":
+		c = cmp.Compare(a.log.MemoryUsage, b.log.MemoryUsage)
+	case "read_rows":
+		c = cmp.Compare(a.log.ReadRows, b.log.ReadRows)
+	case "read_bytes":
+		c = cmp.Compare(a.log.ReadBytes, b.log.ReadBytes)
+	case "written_rows":
+		c = cmp.Compare(a.log.WrittenRows, b.log.WrittenRows)
+	case "written_bytes":
+		c = cmp.Compare(a.log.WrittenBytes, b.log.WrittenBytes)
+	case "result_rows":
+		c = cmp.Compare(a.log.ResultRows, b.log.ResultRows)
+	case "result_bytes":
+		c = cmp.Compare(a.log.ResultBytes, b.log.ResultBytes)
+	case "exception_code":
+		c = cmp.Compare(a.log.ExceptionCode, b.log.ExceptionCode)
+	case "user":
+		c = cmp.Compare(a.log.User, b.log.User)
+	case "type":
+		c = cmp.Compare(a.log.Type, b.log.Type)
+	case "query_id":
+		c = cmp.Compare(a.log.QueryID, b.log.QueryID)
+	}
+	if c != 0 {
+		return c
+	}
+	if c = a.log.EventTime.Compare(b.log.EventTime); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.log.QueryID, b.log.QueryID)
+}
+
+// demoSample keeps roughly ratio of rows, chosen by a hash of query_id like
+// sampleCondition (though not the same hash, so not the same rows).
+func demoSample(rows []*demoRow, ratio float64) []*demoRow {
+	if !sampled(ratio) {
+		return rows
+	}
+	kept := rows[:0:0]
+	for _, row := range rows {
+		h := fnv.New64a()
+		h.Write([]byte(row.log.QueryID))
+		if h.Sum64()%10000 < uint64(ratio*10000) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// listed returns the page of rows matching filter in the requested order,
+// like the ORDER BY and LIMIT of buildQueryLogsQuery.
+func (d *DemoRepository) listed(filter models.QueryLogFilter) []*demoRow {
+	matched := demoSample(d.filtered(filter), filter.Sample)
+
+	sortBy, desc := "event_time", !strings.EqualFold(filter.SortOrder, "asc")
+	if models.ValidSortColumns[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	if filter.After != nil {
+		sortBy, desc = "event_time", false
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := demoCompare(matched[i], matched[j], sortBy)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	return page(matched, filter.Limit, filter.Offset)
+}
+
+// page applies the repository's limit defaults and offset to items.
+func page[T any](items []T, limit, offset int) []T {
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset >= len(items) {
+		return make([]T, 0)
+	}
+	items = items[max(offset, 0):]
+	return items[:min(limit, len(items))]
+}
+
+// GetQueryLogs returns the matching synthetic rows.
+func (d *DemoRepository) GetQueryLogs(ctx context.Context, filter models.QueryLogFilter) ([]models.QueryLog, error) {
+	logs := make([]models.QueryLog, 0)
+	for _, row := range d.listed(filter) {
+		logs = append(logs, row.log)
+	}
+	return logs, nil
+}
+
+// GetQueryLogsDynamic returns the matching synthetic rows with only columns.
+func (d *DemoRepository) GetQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string) ([]map[string]interface{}, error) {
+	results := make([]map[string]interface{}, 0)
+	err := d.StreamQueryLogsDynamic(ctx, filter, columns, func(row map[string]interface{}) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamQueryLogsDynamic calls fn with each matching synthetic row. Values
+// have the same Go types as those read from ClickHouse.
+func (d *DemoRepository) StreamQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string, fn func(row map[string]interface{}) error) error {
+	for _, r := range d.listed(filter) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for _, col := range columns {
+			row[col] = r.value(col)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value returns the row's value for a ValidColumns column, typed like
+// QueryLogRepository.extractValue.
+func (r *demoRow) value(col string) interface{} {
+	log := &r.log
+	switch col {
+	case "query_id":
+		return log.QueryID
+	case "query":
+		return log.Query
+	case "event_time":
+		return log.EventTime
+	case "event_date":
+		return log.EventDate
+	case "type":
+		return log.Type
+	case "query_duration_ms":
+		return log.QueryDurationMs
+	case "memory_usage":
+		return log.MemoryUsage
+	case "read_rows":
+		return log.ReadRows
+	case "read_bytes":
+		return log.ReadBytes
+	case "written_rows":
+		return log.WrittenRows
+	case "written_bytes":
+		return log.WrittenBytes
+	case "result_rows":
+		return log.ResultRows
+	case "result_bytes":
+		return log.ResultBytes
+	case "databases":
+		return log.Databases
+	case "tables":
+		return log.Tables
+	case "exception_code":
+		return log.ExceptionCode
+	case "exception":
+		return log.Exception
+	case "user":
+		return log.User
+	case "client_hostname":
+		return log.ClientHostname
+	case "http_user_agent":
+		return log.HTTPUserAgent
+	case "initial_user":
+		return log.InitialUser
+	case "initial_query_id":
+		return log.InitialQueryID
+	case "is_initial_query":
+		return log.IsInitialQuery
+	case "os_user":
+		return r.osUser
+	case "client_name":
+		return r.clientName
+	case "query_cache_usage":
+		return r.cacheUsage
+	case "peak_memory_usage":
+		return r.peakMemory
+	case "interface":
+		return models.NewEnumValue(col, int64(r.iface))
+	case "used_aggregate_functions", "used_aggregate_function_combinators", "used_database_engines",
+		"used_data_type_families", "used_dictionaries", "used_formats", "used_functions",
+		"used_storages", "used_table_functions":
+		if used := r.used[col]; used != nil {
+			return used
+		}
+		return []string{}
+	case "tables_count":
+		return uint64(len(log.Tables))
+	case "databases_count":
+		return uint64(len(log.Databases))
+	case "query_duration_s":
+		return float64(log.QueryDurationMs) / 1000
+	case "error_name":
+		return log.ErrorName
+	case "trace_id":
+		return log.TraceID
+	default:
+		return nil
+	}
+}
+
+// CountQueryLogs counts the matching synthetic rows.
+func (d *DemoRepository) CountQueryLogs(ctx context.Context, filter models.QueryLogFilter) (uint64, error) {
+	return uint64(len(d.filtered(filter))), nil
+}
+
+// GetScanEfficiency totals the rows read and returned by the matching
+// synthetic rows.
+func (d *DemoRepository) GetScanEfficiency(ctx context.Context, filter models.QueryLogFilter) (*models.ScanEfficiency, error) {
+	var efficiency models.ScanEfficiency
+	for _, row := range d.filtered(filter) {
+		efficiency.TotalReadRows += row.log.ReadRows
+		efficiency.TotalResultRows += row.log.ResultRows
+	}
+	if efficiency.TotalReadRows > 0 {
+		efficiency.Ratio = float64(efficiency.TotalResultRows) / float64(efficiency.TotalReadRows)
+	}
+	return &efficiency, nil
+}
+
+// GetCoverage describes the synthetic data set, estimating its size on disk.
+// Like the ClickHouse implementation, only rows within AllowedDatabases are
+// counted and the size is left out when they are restricted.
+func (d *DemoRepository) GetCoverage(ctx context.Context) (*models.QueryLogCoverage, error) {
+	coverage := &models.QueryLogCoverage{}
+	if d.allowedDatabases == nil {
+		bytesOnDisk := uint64(len(d.rows)) * 180
+		coverage.BytesOnDisk = &bytesOnDisk
+	}
+	// Rows are ordered newest first
+	for i := range d.rows {
+		log := &d.rows[i].log
+		if d.allowedDatabases != nil && !slices.ContainsFunc(log.Databases, d.AllowedDatabase) {
+			continue
+		}
+		if coverage.TotalRows == 0 {
+			newest := log.EventTime
+			coverage.NewestEventTime = &newest
+		}
+		oldest := log.EventTime
+		coverage.OldestEventTime = &oldest
+		coverage.TotalRows++
+	}
+	return coverage, nil
+}
+
+// GetDatabases returns the demo databases within AllowedDatabases.
+func (d *DemoRepository) GetDatabases(ctx context.Context) ([]string, error) {
+	databases := make([]string, 0, len(demoDatabases))
+	for _, name := range demoDatabases {
+		if d.AllowedDatabase(name) {
+			databases = append(databases, name)
+		}
+	}
+	return databases, nil
+}
+
+// GetQueryLogByID returns the synthetic row with queryID.
+func (d *DemoRepository) GetQueryLogByID(ctx context.Context, queryID string) (*models.QueryLog, error) {
+	for i := range d.rows {
+		row := &d.rows[i]
+		if row.log.QueryID != queryID {
+			continue
+		}
+		if d.allowedDatabases != nil && !slices.ContainsFunc(row.log.Databases, d.AllowedDatabase) {
+			break
+		}
+		log := row.log
+		return &log, nil
+	}
+	return nil, fmt.Errorf("failed to get query log by ID: %w", sql.ErrNoRows)
+}
+
+// GetProfileEvents derives a few ProfileEvents counters from the synthetic
+// row, since demo rows carry no real profile data.
+func (d *DemoRepository) GetProfileEvents(ctx context.Context, queryID string) (map[string]uint64, error) {
+	log, err := d.GetQueryLogByID(ctx, queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile events: %w", errors.Unwrap(err))
+	}
+	return map[string]uint64{
+		"Query":                1,
+		"SelectedRows":         log.ReadRows,
+		"SelectedBytes":        log.ReadBytes,
+		"InsertedRows":         log.WrittenRows,
+		"InsertedBytes":        log.WrittenBytes,
+		"RealTimeMicroseconds": log.QueryDurationMs * 1000,
+	}, nil
+}
+
+// scaleMetrics scales the counts and sums of metrics aggregated over a sample
+// back up to the full data, like buildAggregationQuery.
+func scaleMetrics(metrics []models.QueryLogMetrics, ratio float64) {
+	for i := range metrics {
+		m := &metrics[i]
+		m.TotalQueries = int64(math.Round(float64(m.TotalQueries) / ratio))
+		m.FailedQueries = int64(math.Round(float64(m.FailedQueries) / ratio))
+		m.TotalReadBytes = uint64(math.Round(float64(m.TotalReadBytes) / ratio))
+		m.TotalWrittenBytes = uint64(math.Round(float64(m.TotalWrittenBytes) / ratio))
+	}
+}
+
+// errDemoFormatQuery is returned by FormatQuery, which needs ClickHouse.
+var errDemoFormatQuery = errors.New("formatQuery is not available in demo mode")
+
+// FormatQuery always fails; callers show the raw query text instead.
+func (d *DemoRepository) FormatQuery(ctx context.Context, query string) (string, error) {
+	return "", errDemoFormatQuery
+}
+
+// GetQueryThreads returns a single synthetic thread carrying the row's
+// totals, since demo rows have no thread breakdown.
+func (d *DemoRepository) GetQueryThreads(ctx context.Context, queryID string, since time.Time) ([]models.QueryThread, error) {
+	threads := make([]models.QueryThread, 0, 1)
+	log, err := d.GetQueryLogByID(ctx, queryID)
+	if err != nil {
+		return threads, nil
+	}
+	return append(threads, models.QueryThread{
+		ThreadName:      "TCPHandler",
+		ThreadID:        1,
+		QueryDurationMs: log.QueryDurationMs,
+		ReadRows:        log.ReadRows,
+		ReadBytes:       log.ReadBytes,
+		WrittenRows:     log.WrittenRows,
+		WrittenBytes:    log.WrittenBytes,
+		MemoryUsage:     log.MemoryUsage,
+		PeakMemoryUsage: log.MemoryUsage,
+	}), nil
+}
+
+// errDemoExplain is returned by ExplainQuery, which needs ClickHouse.
+var errDemoExplain = errors.New("EXPLAIN is not available in demo mode")
+
+// ExplainQuery always fails, like FormatQuery.
+func (d *DemoRepository) ExplainQuery(ctx context.Context, query string) ([]string, error) {
+	return nil, errDemoExplain
+}
+
+// GetAggregatedMetrics aggregates the matching synthetic rows. Data is never
+// downsampled, but filter.Sample is applied and scaled back up like
+// buildAggregationQuery does.
+func (d *DemoRepository) GetAggregatedMetrics(ctx context.Context, filter models.QueryLogFilter, opts MetricsOptions) ([]models.QueryLogMetrics, MetricsPlan, error) {
+	plan := MetricsPlan{
+		Bucket:      clampedBucket(filter, d.opts.MaxBuckets),
+		SampleRatio: 1,
+		PeakMemory:  true,
+		FillGaps:    opts.FillGaps,
+		ClampMemory: opts.ClampMemory,
+	}
+
+	if sampled(filter.Sample) {
+		plan.SampleRatio = filter.Sample
+	}
+	if opts.AlignToStart && filter.StartTime != nil {
+		origin := filter.StartTime.Truncate(time.Second)
+		plan.Origin = &origin
+	}
+
+	matched := demoSample(d.filtered(filter), plan.SampleRatio)
+	entries := make([]recentEntry, len(matched))
+	for i, row := range matched {
+		entries[i] = row.recentEntry
+	}
+	metrics := bucketMetrics(entries, plan.Bucket, opts.ClampMemory, plan.Origin)
+	if sampled(plan.SampleRatio) {
+		scaleMetrics(metrics, plan.SampleRatio)
+	}
+
+	if opts.FillGaps {
+		metrics = fillMetricGaps(metrics, filter, plan.Bucket, plan.Origin)
+	}
+	return metrics, plan, nil
+}
+
+// fillMetricGaps adds a zeroed row for every empty bucket, over the same range
+// as fillClause: from the start time's bucket to the end time (or now), or
+// between the first and last bucket when there is no start time.
+func fillMetricGaps(metrics []models.QueryLogMetrics, filter models.QueryLogFilter, bucket BucketSize, origin *time.Time) []models.QueryLogMetrics {
+	var from, to time.Time
+	switch {
+	case filter.StartTime != nil:
+		from = filter.StartTime.Truncate(bucket.Duration)
+		if origin != nil {
+			from = *origin
+		}
+		to = time.Now()
+		if filter.EndTime != nil {
+			to = *filter.EndTime
+		}
+	case len(metrics) > 0:
+		from, to = metrics[0].TimeBucket, metrics[len(metrics)-1].TimeBucket
+	default:
+		return metrics
+	}
+
+	byBucket := make(map[time.Time]models.QueryLogMetrics, len(metrics))
+	for _, m := range metrics {
+		byBucket[m.TimeBucket] = m
+	}
+	filled := make([]models.QueryLogMetrics, 0)
+	for t := from; !t.After(to); t = t.Add(bucket.Duration) {
+		m, ok := byBucket[t]
+		if !ok {
+			m = models.QueryLogMetrics{TimeBucket: t}
+		}
+		filled = append(filled, m)
+	}
+	return filled
+}
+
+// GetInsertStats aggregates the matching synthetic inserts per table and bucket.
+func (d *DemoRepository) GetInsertStats(ctx context.Context, filter models.QueryLogFilter) ([]models.InsertStats, BucketSize, error) {
+	bucket := clampedBucket(filter, d.opts.MaxBuckets)
+
+	type key struct {
+		bucket time.Time
+		table  string
+	}
+	byKey := make(map[key]*models.InsertStats)
+	parts := make(map[key]float64)
+	for _, row := range d.filtered(filter) {
+		if row.queryKind != "Insert" {
+			continue
+		}
+		for _, table := range row.log.Tables {
+			k := key{row.log.EventTime.Truncate(bucket.Duration), table}
+			st, ok := byKey[k]
+			if !ok {
+				st = &models.InsertStats{TimeBucket: k.bucket, Table: table}
+				byKey[k] = st
+			}
+			st.Inserts++
+			st.WrittenRows += row.log.WrittenRows
+			st.WrittenBytes += row.log.WrittenBytes
+			parts[k] += row.partsCreated
+			if row.log.ExceptionCode != 0 || row.log.Type == "ExceptionBeforeStart" {
+				st.FailedInserts++
+			}
+		}
+	}
+
+	stats := make([]models.InsertStats, 0, len(byKey))
+	for k, st := range byKey {
+		st.RowsPerSecond = float64(st.WrittenRows) / bucket.Duration.Seconds()
+		st.AvgPartsCreated = parts[k] / float64(st.Inserts)
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if c := stats[i].TimeBucket.Compare(stats[j].TimeBucket); c != 0 {
+			return c < 0
+		}
+		return stats[i].Table < stats[j].Table
+	})
+	return stats, bucket, nil
+}
+
+// GetSessions groups the matching synthetic rows into sessions separated by
+// more than gap, most recent first.
+func (d *DemoRepository) GetSessions(ctx context.Context, filter models.QueryLogFilter, gap time.Duration) ([]models.QuerySession, error) {
+	matched := d.filtered(filter)
+	slices.Reverse(matched)
+
+	var sessions []models.QuerySession
+	for i, row := range matched {
+		if i == 0 || row.log.EventTime.Sub(matched[i-1].log.EventTime) > gap.Truncate(time.Second) {
+			sessions = append(sessions, models.QuerySession{StartTime: row.log.EventTime})
+		}
+		s := &sessions[len(sessions)-1]
+		s.EndTime = row.log.EventTime
+		s.QueryCount++
+		s.TotalDurationMs += row.log.QueryDurationMs
+		if row.log.ExceptionCode != 0 || row.log.Type == "ExceptionBeforeStart" {
+			s.FailedQueries++
+		}
+		if len(s.QueryIDs) < maxSessionQueryIDs {
+			s.QueryIDs = append(s.QueryIDs, row.log.QueryID)
+		}
+	}
+
+	slices.Reverse(sessions)
+	return page(sessions, filter.Limit, 0), nil
+}
+
+// GetRetryBursts groups the matching synthetic rows by pattern, user and
+// epoch-aligned window like QueryLogRepository.GetRetryBursts.
+func (d *DemoRepository) GetRetryBursts(ctx context.Context, filter models.QueryLogFilter, window time.Duration, minCount int64) ([]models.RetryBurst, error) {
+	type burstKey struct {
+		hash  uint64
+		user  string
+		start time.Time
+	}
+	seconds := int64(window / time.Second)
+	window = time.Duration(seconds) * time.Second
+
+	groups := make(map[burstKey]*models.RetryBurst)
+	for _, row := range d.filtered(filter) {
+		t := row.log.EventTime
+		start := time.Unix(t.Unix()-t.Unix()%seconds, 0).In(t.Location())
+		key := burstKey{row.normalizedHash, row.log.User, start}
+		burst, ok := groups[key]
+		if !ok {
+			burst = &models.RetryBurst{
+				NormalizedQueryHash: strconv.FormatUint(row.normalizedHash, 10),
+				NormalizedQuery:     row.normalizedQuery,
+				User:                row.log.User,
+				WindowStart:         key.start,
+				WindowEnd:           key.start.Add(window),
+				FirstSeen:           t,
+				LastSeen:            t,
+			}
+			groups[key] = burst
+		}
+		if t.Before(burst.FirstSeen) {
+			burst.FirstSeen = t
+		}
+		if t.After(burst.LastSeen) {
+			burst.LastSeen = t
+		}
+		burst.Executions++
+		if row.log.ExceptionCode != 0 || row.log.Type == "ExceptionBeforeStart" {
+			burst.FailedQueries++
+		}
+	}
+
+	bursts := make([]models.RetryBurst, 0)
+	for _, burst := range groups {
+		if burst.Executions >= minCount {
+			bursts = append(bursts, *burst)
+		}
+	}
+	slices.SortFunc(bursts, func(a, b models.RetryBurst) int {
+		if c := cmp.Compare(b.Executions, a.Executions); c != 0 {
+			return c
+		}
+		return b.WindowStart.Compare(a.WindowStart)
+	})
+	return page(bursts, filter.Limit, 0), nil
+}
+
+// GetPatternTrend aggregates the matching synthetic executions of one
+// normalized query per bucket.
+func (d *DemoRepository) GetPatternTrend(ctx context.Context, filter models.QueryLogFilter, hash uint64) ([]models.PatternTrendPoint, BucketSize, error) {
+	bucket := clampedBucket(filter, d.opts.MaxBuckets)
+
+	durations := make(map[time.Time][]float64)
+	readBytes := make(map[time.Time][]float64)
+	for _, row := range d.filtered(filter) {
+		if row.normalizedHash != hash {
+			continue
+		}
+		key := row.log.EventTime.Truncate(bucket.Duration)
+		durations[key] = append(durations[key], float64(row.log.QueryDurationMs))
+		readBytes[key] = append(readBytes[key], float64(row.log.ReadBytes))
+	}
+
+	points := make([]models.PatternTrendPoint, 0, len(durations))
+	for key := range durations {
+		points = append(points, models.PatternTrendPoint{
+			TimeBucket:    key,
+			Executions:    int64(len(durations[key])),
+			AvgDurationMs: demoMean(durations[key]),
+			P95DurationMs: demoQuantile(durations[key], 0.95),
+			AvgReadBytes:  demoMean(readBytes[key]),
+			P95ReadBytes:  demoQuantile(readBytes[key], 0.95),
+		})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].TimeBucket.Before(points[j].TimeBucket) })
+	return points, bucket, nil
+}
+
+func demoMean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// demoQuantile returns the q quantile of values with linear interpolation.
+func demoQuantile(values []float64, q float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	pos := q * float64(len(sorted)-1)
+	lower := int(pos)
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// GetPatternTreemap aggregates the matching synthetic rows per query kind and
+// normalized query, keeping the topN patterns by duration within each kind.
+func (d *DemoRepository) GetPatternTreemap(ctx context.Context, filter models.QueryLogFilter, topN int) ([]models.TreemapPattern, error) {
+	type key struct {
+		kind string
+		hash uint64
+	}
+	byKey := make(map[key]*models.TreemapPattern)
+	for _, row := range d.filtered(filter) {
+		k := key{row.queryKind, row.normalizedHash}
+		p, ok := byKey[k]
+		if !ok {
+			p = &models.TreemapPattern{QueryKind: row.queryKind, NormalizedQueryHash: row.normalizedHash, NormalizedQuery: row.normalizedQuery}
+			byKey[k] = p
+		}
+		p.Executions++
+		p.DurationMs += row.log.QueryDurationMs
+	}
+
+	all := make([]models.TreemapPattern, 0, len(byKey))
+	kindExecutions := make(map[string]uint64)
+	kindDuration := make(map[string]uint64)
+	for _, p := range byKey {
+		kindExecutions[p.QueryKind] += p.Executions
+		kindDuration[p.QueryKind] += p.DurationMs
+		all = append(all, *p)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].QueryKind != all[j].QueryKind {
+			return all[i].QueryKind < all[j].QueryKind
+		}
+		if all[i].DurationMs != all[j].DurationMs {
+			return all[i].DurationMs > all[j].DurationMs
+		}
+		return all[i].NormalizedQueryHash < all[j].NormalizedQueryHash
+	})
+
+	patterns := make([]models.TreemapPattern, 0)
+	perKind := make(map[string]int)
+	for _, p := range all {
+		if perKind[p.QueryKind] >= topN {
+			continue
+		}
+		perKind[p.QueryKind]++
+		p.KindExecutions = kindExecutions[p.QueryKind]
+		p.KindDurationMs = kindDuration[p.QueryKind]
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// dimension returns the row's value for a ValidGroupByDimensions column, as
+// toString would render it.
+func (r *demoRow) dimension(name string) string {
+	switch name {
+	case "user":
+		return r.log.User
+	case "initial_user":
+		return r.log.InitialUser
+	case "client_hostname":
+		return r.log.ClientHostname
+	case "http_user_agent":
+		return r.log.HTTPUserAgent
+	case "os_user":
+		return r.osUser
+	case "client_name":
+		return r.clientName
+	case "type":
+		return r.log.Type
+	case "query_kind":
+		return r.queryKind
+	case "exception_code":
+		return strconv.FormatInt(int64(r.log.ExceptionCode), 10)
+	default:
+		return ""
+	}
+}
+
+// GetGroupedStats aggregates the matching synthetic rows by params.Dimension.
+func (d *DemoRepository) GetGroupedStats(ctx context.Context, filter models.QueryLogFilter, params models.GroupByParams) ([]models.QueryLogGroupStats, error) {
+	if err := validateDimension(params.Dimension); err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*models.QueryLogGroupStats)
+	totalDuration := make(map[string]uint64)
+	for _, row := range d.filtered(filter) {
+		k := row.dimension(params.Dimension)
+		s, ok := byKey[k]
+		if !ok {
+			s = &models.QueryLogGroupStats{Key: k}
+			if params.Dimension == "exception_code" {
+				s.ErrorName = row.log.ErrorName
+			}
+			byKey[k] = s
+		}
+		s.TotalQueries++
+		totalDuration[k] += row.log.QueryDurationMs
+		s.MaxDurationMs = max(s.MaxDurationMs, row.log.QueryDurationMs)
+		s.TotalReadBytes += row.log.ReadBytes
+		s.TotalWrittenBytes += row.log.WrittenBytes
+		if row.log.ExceptionCode != 0 || row.log.Type == "ExceptionBeforeStart" {
+			s.FailedQueries++
+		}
+	}
+
+	stats := make([]models.QueryLogGroupStats, 0, len(byKey))
+	for k, s := range byKey {
+		s.AvgDurationMs = float64(totalDuration[k]) / float64(s.TotalQueries)
+		s.ErrorRate = float64(s.FailedQueries) / float64(s.TotalQueries)
+		stats = append(stats, *s)
+	}
+
+	sortBy := "total_queries"
+	if models.ValidGroupBySortColumns[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	desc := !strings.EqualFold(filter.SortOrder, "asc")
+	sort.Slice(stats, func(i, j int) bool {
+		c := compareGroupStats(&stats[i], &stats[j], sortBy)
+		if c == 0 {
+			return stats[i].Key < stats[j].Key
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return page(stats, filter.Limit, 0), nil
+}
+
+// compareGroupStats compares two groups by a ValidGroupBySortColumns aggregate.
+func compareGroupStats(a, b *models.QueryLogGroupStats, column string) int {
+	switch column {
+	case "avg_duration_ms":
+		return cmp.Compare(a.AvgDurationMs, b.AvgDurationMs)
+	case "max_duration_ms":
+		return cmp.Compare(a.MaxDurationMs, b.MaxDurationMs)
+	case "total_read_bytes":
+		return cmp.Compare(a.TotalReadBytes, b.TotalReadBytes)
+	case "total_written_bytes":
+		return cmp.Compare(a.TotalWrittenBytes, b.TotalWrittenBytes)
+	case "failed_queries":
+		return cmp.Compare(a.FailedQueries, b.FailedQueries)
+	case "error_rate":
+		return cmp.Compare(a.ErrorRate, b.ErrorRate)
+	default:
+		return cmp.Compare(a.TotalQueries, b.TotalQueries)
+	}
+}
+
+// GetUserShares computes each user's share of the matching synthetic rows.
+func (d *DemoRepository) GetUserShares(ctx context.Context, filter models.QueryLogFilter) ([]models.UserShare, error) {
+	byUser := make(map[string]*models.UserShare)
+	var total models.UserShare
+	for _, row := range d.filtered(filter) {
+		s, ok := byUser[row.log.User]
+		if !ok {
+			s = &models.UserShare{User: row.log.User}
+			byUser[row.log.User] = s
+		}
+		for _, acc := range []*models.UserShare{s, &total} {
+			acc.TotalQueries++
+			acc.TotalDurationMs += row.log.QueryDurationMs
+			acc.TotalMemoryUsage += row.log.MemoryUsage
+			acc.TotalReadBytes += row.log.ReadBytes
+		}
+	}
+
+	share := func(part, whole float64) float64 {
+		if whole <= 0 {
+			return 0
+		}
+		return part / whole * 100
+	}
+	shares := make([]models.UserShare, 0, len(byUser))
+	for _, s := range byUser {
+		s.DurationShare = share(float64(s.TotalDurationMs), float64(total.TotalDurationMs))
+		s.MemoryShare = share(float64(s.TotalMemoryUsage), float64(total.TotalMemoryUsage))
+		s.ReadBytesShare = share(float64(s.TotalReadBytes), float64(total.TotalReadBytes))
+		shares = append(shares, *s)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].DurationShare != shares[j].DurationShare {
+			return shares[i].DurationShare > shares[j].DurationShare
+		}
+		return shares[i].User < shares[j].User
+	})
+	return shares, nil
+}
+
+// GetQueryViews returns the synthetic materialized view executions.
+func (d *DemoRepository) GetQueryViews(ctx context.Context, filter models.QueryViewFilter) ([]models.QueryViewLog, error) {
+	var matched []models.QueryViewLog
+	for _, v := range d.views {
+		view := v.view
+		database, _, _ := strings.Cut(view.ViewName, ".")
+		switch {
+		case filter.StartTime != nil && view.EventTime.Before(*filter.StartTime),
+			filter.EndTime != nil && view.EventTime.After(*filter.EndTime),
+			filter.QueryID != "" && view.InitialQueryID != filter.QueryID,
+			filter.ViewName != "" && view.ViewName != filter.ViewName,
+			filter.OnlyFailed && view.ExceptionCode == 0 && view.Status == "QueryFinish",
+			view.ViewDurationMs < filter.MinDurationMs,
+			!d.AllowedDatabase(database):
+			continue
+		}
+		if filter.IncludeQuery {
+			view.TriggeringQuery = v.query
+		}
+		matched = append(matched, view)
+	}
+	return page(matched, filter.Limit, filter.Offset), nil
+}
+
+// GetAsyncInserts returns the synthetic asynchronous inserts.
+func (d *DemoRepository) GetAsyncInserts(ctx context.Context, filter models.AsyncInsertFilter) ([]models.AsyncInsertLog, error) {
+	var matched []models.AsyncInsertLog
+	for _, insert := range d.inserts {
+		switch {
+		case filter.StartTime != nil && insert.EventTime.Before(*filter.StartTime),
+			filter.EndTime != nil && insert.EventTime.After(*filter.EndTime),
+			filter.Database != "" && insert.Database != filter.Database,
+			filter.Table != "" && insert.Table != filter.Table,
+			filter.Status != "" && insert.Status != filter.Status,
+			filter.QueryID != "" && insert.QueryID != filter.QueryID,
+			!d.AllowedDatabase(insert.Database):
+			continue
+		}
+		matched = append(matched, insert)
+	}
+	return page(matched, filter.Limit, filter.Offset), nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// TestErrorNameSQL checks that errorCodeToName is only used in SQL when the
+// server has it, for every query that selects error names.
+func TestErrorNameSQL(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       int32
+		wantInSQL   bool
+		wantDynamic string
+	}{
+		{name: "not yet checked", state: errorNamesUnknown, wantInSQL: true, wantDynamic: models.ErrorNameExpr + " AS error_name"},
+		{name: "server has errorCodeToName", state: errorNamesSQL, wantInSQL: true, wantDynamic: models.ErrorNameExpr + " AS error_name"},
+		{name: "server lacks errorCodeToName", state: errorNamesGo, wantInSQL: false, wantDynamic: "toString(exception_code) AS error_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewQueryLogRepository(nil, Options{})
+			r.errorNames.Store(tt.state)
+
+			listQuery, _ := r.buildQueryLogsQuery(models.QueryLogFilter{})
+			groupQuery, _ := r.buildGroupByQuery(models.QueryLogFilter{}, models.GroupByParams{Dimension: "exception_code"})
+			dynamicQuery, _ := r.buildDynamicQuery(models.QueryLogFilter{}, []string{"query_id", "error_name"})
+
+			for name, query := range map[string]string{"list": listQuery, "group by": groupQuery, "dynamic": dynamicQuery} {
+				if got := strings.Contains(query, "errorCodeToName"); got != tt.wantInSQL {
+					t.Errorf("%s query uses errorCodeToName = %v, want %v: %s", name, got, tt.wantInSQL, query)
+				}
+			}
+			if !strings.Contains(listQuery, "AS error_name FROM") {
+				t.Errorf("list query does not select error_name last: %s", listQuery)
+			}
+			if !strings.Contains(dynamicQuery, tt.wantDynamic) {
+				t.Errorf("dynamic query = %s, want %q", dynamicQuery, tt.wantDynamic)
+			}
+		})
+	}
+}
+
+func TestErrorNameFallback(t *testing.T) {
+	r := NewQueryLogRepository(nil, Options{})
+	r.errorNames.Store(errorNamesGo)
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "241", want: "MEMORY_LIMIT_EXCEEDED"},
+		{code: "62", want: "SYNTAX_ERROR"},
+		{code: "0", want: ""},
+		{code: "123456", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code := tt.code
+			if got := r.extractValue("error_name", &code); got != tt.want {
+				t.Errorf("extractValue(error_name, %s) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
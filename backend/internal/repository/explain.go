@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+)
+
+// ErrNotExplainable is returned for logged queries EXPLAIN is not run on.
+var ErrNotExplainable = errors.New("skipped")
+
+// explainSettings bound EXPLAIN of a logged query. Planning can still read
+// data, e.g. for scalar subqueries, so it runs read-only with a short time and
+// row budget.
+var explainSettings = clickhouse.Settings{
+	"readonly":           1,
+	"max_execution_time": 5,
+	"max_rows_to_read":   1_000_000,
+}
+
+// tableFunctionPattern matches calls to table functions that reach outside
+// the server or read local files. Planning a query resolves their schema,
+// which means contacting the remote source.
+var tableFunctionPattern = regexp.MustCompile(`(?i)\b(url|urlCluster|s3|s3Cluster|gcs|azureBlobStorage|azureBlobStorageCluster|hdfs|hdfsCluster|remote|remoteSecure|cluster|clusterAllReplicas|file|fileCluster|mysql|postgresql|mongodb|redis|sqlite|jdbc|odbc|executable|iceberg|deltaLake|hudi)\s*\(`)
+
+var (
+	settingsClausePattern = regexp.MustCompile(`(?i)\bSETTINGS\b`)
+	intoOutfilePattern    = regexp.MustCompile(`(?i)\bINTO\s+OUTFILE\b`)
+)
+
+// CheckExplainable returns an ErrNotExplainable error saying why EXPLAIN is
+// not run on query, or nil if it can be. Only SELECT queries are explained,
+// and not ones using table functions, SETTINGS or INTO OUTFILE.
+func CheckExplainable(query string) error {
+	if !isSelectQuery(query) {
+		return fmt.Errorf("%w: only SELECT queries are explained", ErrNotExplainable)
+	}
+	if match := tableFunctionPattern.FindStringSubmatch(query); match != nil {
+		return fmt.Errorf("%w: query uses table function %s()", ErrNotExplainable, match[1])
+	}
+	if settingsClausePattern.MatchString(query) {
+		return fmt.Errorf("%w: query has a SETTINGS clause", ErrNotExplainable)
+	}
+	if intoOutfilePattern.MatchString(query) {
+		return fmt.Errorf("%w: query has an INTO OUTFILE clause", ErrNotExplainable)
+	}
+	return nil
+}
+
+// isSelectQuery reports whether query text is a SELECT, optionally preceded by
+// WITH, parentheses and comments.
+func isSelectQuery(query string) bool {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "--"):
+			_, rest, ok := strings.Cut(query, "\n")
+			if !ok {
+				return false
+			}
+			query = rest
+		case strings.HasPrefix(query, "/*"):
+			_, rest, ok := strings.Cut(query, "*/")
+			if !ok {
+				return false
+			}
+			query = rest
+		default:
+			keyword, _, _ := strings.Cut(query, " ")
+			keyword = strings.ToUpper(strings.TrimRight(keyword, "\t\r\n("))
+			return keyword == "SELECT" || keyword == "WITH"
+		}
+	}
+}
+
+// ExplainQuery runs EXPLAIN on query and returns its output lines. Queries
+// CheckExplainable rejects are not sent to the server. Unlike FormatQuery it
+// goes through the circuit breaker, since it is a regular read of the server.
+func (r *QueryLogRepository) ExplainQuery(ctx context.Context, query string) ([]string, error) {
+	if err := CheckExplainable(query); err != nil {
+		return nil, err
+	}
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	rows, err := r.db.QueryContext(database.WithQuerySettings(ctx, explainSettings), "EXPLAIN "+query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make([]string, 0)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to scan explain row: %w", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating explain rows: %w", err)
+	}
+
+	return lines, nil
+}
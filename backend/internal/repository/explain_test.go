@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckExplainable(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{query: "SELECT count() FROM system.one"},
+		{query: "  -- dashboard\n/* panel 3 */ (WITH 1 AS x SELECT x)"},
+		{query: "select url, domain(url) FROM hits"},
+		{query: "INSERT INTO t VALUES (1)", wantErr: "only SELECT"},
+		{query: "-- unterminated comment", wantErr: "only SELECT"},
+		{query: "SELECT * FROM url('http://10.0.0.1/data.csv', CSV)", wantErr: "table function url()"},
+		{query: "SELECT * FROM S3 ('https://bucket/key.parquet')", wantErr: "table function S3()"},
+		{query: "SELECT * FROM remoteSecure('db-2:9440', system.one)", wantErr: "table function remoteSecure()"},
+		{query: "SELECT 1 SETTINGS max_threads = 64", wantErr: "SETTINGS"},
+		{query: "SELECT 1 INTO  OUTFILE '/tmp/out.csv'", wantErr: "INTO OUTFILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			err := CheckExplainable(tt.query)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckExplainable: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNotExplainable) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckExplainable error = %v, want ErrNotExplainable mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+func TestCheckResultColumns(t *testing.T) {
+	requested := []string{"tables", "query_id", "event_time", "tables_count"}
+
+	tests := []struct {
+		name    string
+		got     []string
+		wantErr bool
+	}{
+		{name: "identical", got: []string{"tables", "query_id", "event_time", "tables_count"}},
+		{name: "reordered", got: []string{"query_id", "tables", "event_time", "tables_count"}, wantErr: true},
+		{name: "missing column", got: []string{"tables", "query_id", "event_time"}, wantErr: true},
+		{name: "extra column", got: []string{"tables", "query_id", "event_time", "tables_count", "user"}, wantErr: true},
+		{name: "derived column without alias", got: []string{"tables", "query_id", "event_time", "length(tables)"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkResultColumns(tt.got, requested)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkResultColumns(%v) error = %v, wantErr %v", tt.got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestDynamicQuerySelectOrder checks that the SELECT list follows the
+// requested columns exactly, so the export header written from the same slice
+// lines up with the values.
+func TestDynamicQuerySelectOrder(t *testing.T) {
+	r := NewQueryLogRepository(nil, Options{})
+
+	tests := []struct {
+		name    string
+		columns []string
+	}{
+		{name: "array first", columns: []string{"tables", "query_id", "event_time"}},
+		{name: "time between arrays", columns: []string{"databases", "event_time", "tables", "read_rows"}},
+		{name: "derived columns", columns: []string{"query_duration_s", "tables", "error_name", "event_date", "tables_count"}},
+		{name: "single column", columns: []string{"event_date"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := r.buildDynamicQuery(models.QueryLogFilter{}, tt.columns)
+			selectList, _, ok := strings.Cut(strings.TrimPrefix(query, "SELECT "), " FROM ")
+			if !ok {
+				t.Fatalf("no FROM in %q", query)
+			}
+
+			want := make([]string, len(tt.columns))
+			for i, col := range tt.columns {
+				want[i] = selectExpr(col)
+			}
+			if selectList != strings.Join(want, ", ") {
+				t.Errorf("SELECT list = %q, want %q", selectList, strings.Join(want, ", "))
+			}
+		})
+	}
+}
+
+// TestScanTargetValues checks that every selectable column has a scan target
+// whose extracted value has the column's type, so a row's values come out in
+// the same order and shape as the requested columns.
+func TestScanTargetValues(t *testing.T) {
+	r := NewQueryLogRepository(nil, Options{})
+
+	want := map[string]reflect.Type{
+		"event_time": reflect.TypeOf(time.Time{}),
+		"event_date": reflect.TypeOf(time.Time{}),
+		"databases":  reflect.TypeOf([]string(nil)),
+		"tables":     reflect.TypeOf([]string(nil)),
+		"interface":  reflect.TypeOf(models.EnumValue{}),
+	}
+
+	for col := range models.ValidColumns {
+		t.Run(col, func(t *testing.T) {
+			value := r.extractValue(col, r.createScanTarget(col))
+			typ := reflect.TypeOf(value)
+			if typ == nil || typ.Kind() == reflect.Pointer {
+				t.Fatalf("extractValue(%q) = %T, want a concrete value (column has no scan target)", col, value)
+			}
+			if expected, ok := want[col]; ok && typ != expected {
+				t.Errorf("extractValue(%q) = %v, want %v", col, typ, expected)
+			}
+		})
+	}
+}
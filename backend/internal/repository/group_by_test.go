@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// TestGroupedStatsDimension checks that the repositories reject dimensions
+// outside models.ValidGroupByDimensions themselves, for callers that skip the
+// handler's check.
+func TestGroupedStatsDimension(t *testing.T) {
+	stores := map[string]QueryLogStore{
+		// A nil connection fails the test if the query were ever sent
+		"clickhouse": NewQueryLogRepository(nil, Options{}),
+		"demo":       NewDemoRepository(time.Now(), Options{}),
+	}
+
+	for name, store := range stores {
+		for _, dimension := range []string{"", "query", "user) AS group_key FROM system.users --"} {
+			t.Run(name+"/"+dimension, func(t *testing.T) {
+				_, err := store.GetGroupedStats(context.Background(), models.QueryLogFilter{}, models.GroupByParams{Dimension: dimension})
+				if err == nil || !strings.Contains(err.Error(), "invalid group-by dimension") {
+					t.Errorf("GetGroupedStats(%q) error = %v, want invalid group-by dimension", dimension, err)
+				}
+			})
+		}
+	}
+}
+
+func TestGroupByErrorRate(t *testing.T) {
+	r := NewQueryLogRepository(nil, Options{})
+
+	query, _ := r.buildGroupByQuery(models.QueryLogFilter{SortBy: "error_rate"}, models.GroupByParams{Dimension: "user"})
+	if !strings.Contains(query, "failed_queries / total_queries as error_rate") {
+		t.Errorf("query does not select error_rate: %s", query)
+	}
+	if !strings.Contains(query, "ORDER BY error_rate DESC") {
+		t.Errorf("query does not sort by error_rate: %s", query)
+	}
+}
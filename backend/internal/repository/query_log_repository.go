@@ -2,28 +2,332 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/actio/clickhouse-monitoring/internal/database"
 	"github.com/actio/clickhouse-monitoring/internal/models"
 )
 
 const (
-	// Default and maximum limits for pagination
-	defaultLimit = 100
-	maxLimit     = 1000
+	// DefaultLimit is the page size of list queries that set no limit.
+	DefaultLimit = 100
+
+	// MaxLimit caps the page size of list queries; larger limits are clamped.
+	MaxLimit = 1000
 )
 
+// ErrQueryQueueFull is returned when a query could not obtain a concurrency slot
+// within the configured queue timeout.
+var ErrQueryQueueFull = errors.New("too many concurrent queries")
+
+// Options configures a QueryLogRepository.
+type Options struct {
+	// MaxConcurrentQueries caps simultaneous ClickHouse queries (0 = unlimited)
+	MaxConcurrentQueries int
+
+	// QueryQueueTimeout bounds how long a query waits for a free slot
+	QueryQueueTimeout time.Duration
+
+	// MetricsMaxScanRows is the estimated row count above which aggregated
+	// metrics are downsampled (0 = never)
+	MetricsMaxScanRows uint64
+
+	// MetricsSampleRatio is the fraction of rows kept when downsampling
+	// (0 or >= 1 = coarsen the bucket only, never sample)
+	MetricsSampleRatio float64
+
+	// MaxBuckets caps the number of time buckets in bucketed responses; the
+	// bucket interval is widened when a range would exceed it (0 = no cap)
+	MaxBuckets int
+
+	// ShardHosts lists the host:port addresses that may be queried individually
+	// through the shard filter
+	ShardHosts []string
+
+	// AllowedDatabases, when non-empty, restricts every query_log read to
+	// queries that touched at least one of these databases
+	AllowedDatabases []string
+
+	// RecentWindow enables an in-memory buffer of the most recent window of
+	// query_log, refreshed every RecentInterval and capped at RecentMaxEntries
+	// rows. Unfiltered list and metrics requests within the window are served
+	// from it (0 = disabled).
+	RecentWindow     time.Duration
+	RecentInterval   time.Duration
+	RecentMaxEntries int
+
+	// TraceIDPattern is a regular expression with a named trace_id group used
+	// to extract trace IDs from log_comment (empty = disabled)
+	TraceIDPattern string
+
+	// ColumnTypes overrides the scan kind of dynamic columns (see
+	// ParseColumnTypeOverrides); an overridden column skips the built-in
+	// conversion (e.g. enum labels, trace ID extraction)
+	ColumnTypes map[string]string
+}
+
 // QueryLogRepository handles database operations for query_log data.
 type QueryLogRepository struct {
-	db *database.ClickHouseDB
+	db   *database.ClickHouseDB
+	opts Options
+
+	// sem limits concurrent queries; nil when unlimited
+	sem chan struct{}
+
+	// shards is the set of allowed ShardHosts
+	shards map[string]bool
+
+	// allowedDatabases is the set of AllowedDatabases; nil when unrestricted
+	allowedDatabases map[string]bool
+
+	// recent buffers the latest query_log window; nil when disabled
+	recent *recentBuffer
+
+	// tracePattern is the compiled TraceIDPattern; nil when disabled
+	tracePattern *regexp.Regexp
+
+	// flight coalesces identical concurrent read queries (see coalesce)
+	flight singleflight.Group
+
+	// columns caches the column names of system.query_log once loaded
+	columnsMu sync.Mutex
+	columns   map[string]bool
+
+	// errorNames records where error names come from once resolveErrorNames
+	// has checked the server; until then errorCodeToName is assumed
+	errorNames atomic.Int32
 }
 
+// Sources of error names (see resolveErrorNames).
+const (
+	errorNamesUnknown int32 = iota
+	errorNamesSQL           // the server's errorCodeToName
+	errorNamesGo            // models.ErrorCodeName
+)
+
 // NewQueryLogRepository creates a new QueryLogRepository instance.
-func NewQueryLogRepository(db *database.ClickHouseDB) *QueryLogRepository {
-	return &QueryLogRepository{db: db}
+func NewQueryLogRepository(db *database.ClickHouseDB, opts Options) *QueryLogRepository {
+	r := &QueryLogRepository{db: db, opts: opts, shards: make(map[string]bool, len(opts.ShardHosts))}
+	for _, host := range opts.ShardHosts {
+		r.shards[host] = true
+	}
+	if len(opts.AllowedDatabases) > 0 {
+		r.allowedDatabases = make(map[string]bool, len(opts.AllowedDatabases))
+		for _, name := range opts.AllowedDatabases {
+			r.allowedDatabases[name] = true
+		}
+	}
+	if opts.MaxConcurrentQueries > 0 {
+		r.sem = make(chan struct{}, opts.MaxConcurrentQueries)
+	}
+	r.tracePattern = compileTracePattern(opts.TraceIDPattern)
+	r.recent = newRecentBuffer(r)
+	return r
+}
+
+// compileTracePattern compiles the trace ID pattern. An invalid pattern or one
+// without a trace_id group is logged and disables extraction.
+func compileTracePattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("Ignoring invalid LOG_COMMENT_TRACE_PATTERN: %v", err)
+		return nil
+	}
+	if re.SubexpIndex("trace_id") < 0 {
+		log.Printf("Ignoring LOG_COMMENT_TRACE_PATTERN without a (?P<trace_id>...) group")
+		return nil
+	}
+	return re
+}
+
+// HasColumn reports whether the server's system.query_log has the named column.
+// The column list is loaded from system.columns on first use and cached; a
+// failed load is retried on the next call.
+func (r *QueryLogRepository) HasColumn(ctx context.Context, name string) (bool, error) {
+	r.columnsMu.Lock()
+	defer r.columnsMu.Unlock()
+
+	if r.columns == nil {
+		columns, err := r.loadColumns(ctx)
+		if err != nil {
+			return false, err
+		}
+		r.columns = columns
+	}
+	return r.columns[name], nil
+}
+
+// loadColumns reads the column names of system.query_log.
+func (r *QueryLogRepository) loadColumns(ctx context.Context) (map[string]bool, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT name FROM system.columns WHERE database = 'system' AND table = 'query_log'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query query_log columns: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan column name: %w", err)
+		}
+		columns[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating query_log columns: %w", err)
+	}
+
+	return columns, nil
+}
+
+// resolveErrorNames checks once whether the server has errorCodeToName, which
+// older ClickHouse versions lack. Without it the function is left out of the
+// SQL and error names are looked up with models.ErrorCodeName instead. A failed
+// check is retried on the next call.
+func (r *QueryLogRepository) resolveErrorNames(ctx context.Context) error {
+	if r.errorNames.Load() != errorNamesUnknown {
+		return nil
+	}
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT count() FROM system.functions WHERE name = 'errorCodeToName'")
+	if err != nil {
+		return fmt.Errorf("failed to check for errorCodeToName: %w", err)
+	}
+	defer rows.Close()
+
+	var count uint64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return fmt.Errorf("failed to scan function count: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check for errorCodeToName: %w", err)
+	}
+
+	if count > 0 {
+		r.errorNames.Store(errorNamesSQL)
+	} else {
+		r.errorNames.Store(errorNamesGo)
+	}
+	return nil
+}
+
+// errorNamesInGo reports whether error names are looked up in Go because the
+// server has no errorCodeToName.
+func (r *QueryLogRepository) errorNamesInGo() bool {
+	return r.errorNames.Load() == errorNamesGo
+}
+
+// AllowedDatabase reports whether name may be exposed by this deployment.
+// Every database is allowed when AllowedDatabases is empty.
+func (r *QueryLogRepository) AllowedDatabase(name string) bool {
+	return r.allowedDatabases == nil || r.allowedDatabases[name]
+}
+
+// ValidShard reports whether shard may be used as the shard filter.
+// The empty string (no shard) is always valid.
+func (r *QueryLogRepository) ValidShard(shard string) bool {
+	return shard == "" || r.shards[shard]
+}
+
+// queryLogTable returns the table expression to read query_log from: the
+// local system.query_log, or remote() to a single shard host. The host is
+// interpolated into the SQL, so only ShardHosts entries are used; anything
+// else falls back to the local table (handlers reject it via ValidShard).
+func (r *QueryLogRepository) queryLogTable(shard string) string {
+	if shard == "" || !r.shards[shard] {
+		return "system.query_log"
+	}
+	return fmt.Sprintf("remote('%s', system.query_log)", shard)
+}
+
+// acquire waits for a concurrency slot and returns a function that releases it.
+// Waiting stops when ctx is done or QueryQueueTimeout elapses; the latter
+// returns ErrQueryQueueFull.
+func (r *QueryLogRepository) acquire(ctx context.Context) (func(), error) {
+	if r.sem == nil {
+		return func() {}, nil
+	}
+
+	waitCtx := ctx
+	if r.opts.QueryQueueTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, r.opts.QueryQueueTimeout)
+		defer cancel()
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+		return func() { <-r.sem }, nil
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrQueryQueueFull
+	}
+}
+
+// coalesce runs fn once for concurrent calls with the same query and args and
+// gives every caller the shared result, so callers must not modify it. fn runs
+// without the caller's cancellation so one client going away doesn't fail the
+// others; each caller still stops waiting when its own ctx is done.
+func (r *QueryLogRepository) coalesce(ctx context.Context, query string, args []interface{}, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ch := r.flight.DoChan(flightKey(query, args), func() (interface{}, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flightKey hashes a query and its arguments into a coalescing key.
+func flightKey(query string, args []interface{}) string {
+	h := sha256.New()
+	io.WriteString(h, query)
+	for _, arg := range args {
+		// Format times explicitly so the monotonic clock reading isn't part of the key
+		if t, ok := arg.(time.Time); ok {
+			arg = t.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // GetQueryLogs retrieves query logs based on the provided filters.
@@ -35,52 +339,37 @@ func NewQueryLogRepository(db *database.ClickHouseDB) *QueryLogRepository {
 // 3. All user-provided values are passed as parameters, never interpolated into the query
 // 4. Results are ordered by event_time DESC for most recent first
 func (r *QueryLogRepository) GetQueryLogs(ctx context.Context, filter models.QueryLogFilter) ([]models.QueryLog, error) {
+	if err := r.resolveErrorNames(ctx); err != nil {
+		return nil, err
+	}
+	// Short, unfiltered ranges can be answered from the recent logs buffer
+	if logs, ok := r.recent.queryLogs(filter); ok {
+		return logs, nil
+	}
+
 	// Build the query dynamically based on filters
 	query, args := r.buildQueryLogsQuery(filter)
 
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Execute the query using database/sql interface
-	rows, err := r.db.DB().QueryContext(ctx, query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query query_log: %w", err)
 	}
 	defer rows.Close()
 
 	// Scan results into structs
-	var logs []models.QueryLog
+	logs := make([]models.QueryLog, 0)
 	for rows.Next() {
 		var log models.QueryLog
-		// Use clickhouse.ArraySet for array columns
-		var databases, tables []string
-		err := rows.Scan(
-			&log.QueryID,
-			&log.Query,
-			&log.EventTime,
-			&log.EventDate,
-			&log.Type,
-			&log.QueryDurationMs,
-			&log.MemoryUsage,
-			&log.ReadRows,
-			&log.ReadBytes,
-			&log.WrittenRows,
-			&log.WrittenBytes,
-			&log.ResultRows,
-			&log.ResultBytes,
-			&databases,
-			&tables,
-			&log.ExceptionCode,
-			&log.Exception,
-			&log.User,
-			&log.ClientHostname,
-			&log.HTTPUserAgent,
-			&log.InitialUser,
-			&log.InitialQueryID,
-			&log.IsInitialQuery,
-		)
-		if err != nil {
+		if err := r.scanQueryLog(rows, &log); err != nil {
 			return nil, fmt.Errorf("failed to scan query_log row: %w", err)
 		}
-		log.Databases = databases
-		log.Tables = tables
 		logs = append(logs, log)
 	}
 
@@ -91,6 +380,104 @@ func (r *QueryLogRepository) GetQueryLogs(ctx context.Context, filter models.Que
 	return logs, nil
 }
 
+// queryLogColumns is the SELECT list for full QueryLog records up to
+// error_name (see queryLogSelectColumns).
+const queryLogColumns = `
+			query_id,
+			query,
+			event_time,
+			event_date,
+			type,
+			query_duration_ms,
+			memory_usage,
+			read_rows,
+			read_bytes,
+			written_rows,
+			written_bytes,
+			result_rows,
+			result_bytes,
+			databases,
+			tables,
+			exception_code,
+			exception,
+			user,
+			client_hostname,
+			http_user_agent,
+			initial_user,
+			initial_query_id,
+			is_initial_query,
+			log_comment,
+			`
+
+// queryLogSelectColumns returns the SELECT list for full QueryLog records, in
+// the order scanQueryLog expects. Without errorCodeToName error_name is
+// selected empty and filled in by scanQueryLog.
+func (r *QueryLogRepository) queryLogSelectColumns() string {
+	if r.errorNamesInGo() {
+		return queryLogColumns + "'' AS error_name"
+	}
+	return queryLogColumns + models.ErrorNameExpr + " AS error_name"
+}
+
+// scanQueryLog scans a row selected with queryLogSelectColumns into log.
+// Any extra destinations are scanned from columns following that list.
+// TraceID is extracted from log_comment using the configured pattern, and
+// ErrorName from exception_code when the server has no errorCodeToName.
+func (r *QueryLogRepository) scanQueryLog(rows *sql.Rows, log *models.QueryLog, extra ...interface{}) error {
+	var databases, tables []string
+	var logComment string
+	dest := []interface{}{
+		&log.QueryID,
+		&log.Query,
+		&log.EventTime,
+		&log.EventDate,
+		&log.Type,
+		&log.QueryDurationMs,
+		&log.MemoryUsage,
+		&log.ReadRows,
+		&log.ReadBytes,
+		&log.WrittenRows,
+		&log.WrittenBytes,
+		&log.ResultRows,
+		&log.ResultBytes,
+		&databases,
+		&tables,
+		&log.ExceptionCode,
+		&log.Exception,
+		&log.User,
+		&log.ClientHostname,
+		&log.HTTPUserAgent,
+		&log.InitialUser,
+		&log.InitialQueryID,
+		&log.IsInitialQuery,
+		&logComment,
+		&log.ErrorName,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	log.Databases = databases
+	log.Tables = tables
+	log.TraceID = r.traceID(logComment)
+	if r.errorNamesInGo() {
+		log.ErrorName = models.ErrorCodeName(log.ExceptionCode)
+	}
+	return nil
+}
+
+// traceID extracts the trace_id group of the TraceIDPattern from a log_comment.
+// Returns "" when no pattern is configured or the comment doesn't match.
+func (r *QueryLogRepository) traceID(logComment string) string {
+	if r.tracePattern == nil || logComment == "" {
+		return ""
+	}
+	match := r.tracePattern.FindStringSubmatch(logComment)
+	if match == nil {
+		return ""
+	}
+	return match[r.tracePattern.SubexpIndex("trace_id")]
+}
+
 // buildQueryLogsQuery constructs the SQL query and arguments based on the provided filters.
 //
 // Dynamic SQL Generation Logic:
@@ -117,35 +504,68 @@ func (r *QueryLogRepository) GetQueryLogs(ctx context.Context, filter models.Que
 // This prevents SQL injection attacks regardless of the filter content.
 func (r *QueryLogRepository) buildQueryLogsQuery(filter models.QueryLogFilter) (string, []interface{}) {
 	// Base query selecting all relevant performance analysis fields
-	baseQuery := `
-		SELECT
-			query_id,
-			query,
-			event_time,
-			event_date,
-			type,
-			query_duration_ms,
-			memory_usage,
-			read_rows,
-			read_bytes,
-			written_rows,
-			written_bytes,
-			result_rows,
-			result_bytes,
-			databases,
-			tables,
-			exception_code,
-			exception,
-			user,
-			client_hostname,
-			http_user_agent,
-			initial_user,
-			initial_query_id,
-			is_initial_query
-		FROM system.query_log
-	`
+	baseQuery := "SELECT " + r.queryLogSelectColumns() + " FROM " + r.queryLogTable(filter.Shard)
 
 	// Collect WHERE conditions and their corresponding arguments
+	conditions, args := r.scopedConditions(filter)
+	if sampled(filter.Sample) {
+		condition, arg := sampleCondition(filter.Sample)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	// Build the complete query
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(baseQuery)
+
+	// Add WHERE clause if we have any conditions
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	// Add ORDER BY for consistent, predictable results (most recent first by default)
+	queryBuilder.WriteString(queryLogOrderBy(filter))
+
+	// Apply pagination with LIMIT and OFFSET
+	// Enforce limits to prevent excessive data retrieval
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	queryBuilder.WriteString(" LIMIT ?")
+	args = append(args, limit)
+
+	// Add OFFSET for pagination
+	if filter.Offset > 0 {
+		queryBuilder.WriteString(" OFFSET ?")
+		args = append(args, filter.Offset)
+	}
+
+	return queryBuilder.String(), args
+}
+
+// scopedConditions returns buildConditions(filter) plus the AllowedDatabases
+// constraint. Repository methods use it so the restriction can't be bypassed by
+// the filters a caller supplies.
+func (r *QueryLogRepository) scopedConditions(filter models.QueryLogFilter) ([]string, []interface{}) {
+	conditions, args := buildConditions(filter)
+	if len(r.opts.AllowedDatabases) > 0 {
+		conditions = append(conditions, "hasAny(databases, ?)")
+		args = append(args, r.opts.AllowedDatabases)
+	}
+	return conditions, args
+}
+
+// buildConditions builds the WHERE conditions shared by every query_log query.
+// Conditions are returned alongside their arguments in placeholder order, so callers
+// can join them with " AND " and append further clauses.
+//
+// All filter values are passed as query parameters, never concatenated into the query string.
+func buildConditions(filter models.QueryLogFilter) ([]string, []interface{}) {
 	var conditions []string
 	var args []interface{}
 
@@ -162,6 +582,12 @@ func (r *QueryLogRepository) buildQueryLogsQuery(filter models.QueryLogFilter) (
 		args = append(args, filter.QueryID)
 	}
 
+	// Filter by initial query ID to collect all rows of one distributed query
+	if filter.InitialQueryID != "" {
+		conditions = append(conditions, "initial_query_id = ?")
+		args = append(args, filter.InitialQueryID)
+	}
+
 	// Always exclude QueryStart entries - we only want completed queries
 	// QueryStart entries have no useful metrics (duration=0, memory=0, etc.)
 	conditions = append(conditions, "type != 'QueryStart'")
@@ -183,81 +609,246 @@ func (r *QueryLogRepository) buildQueryLogsQuery(filter models.QueryLogFilter) (
 		conditions = append(conditions, "(type = 'QueryFinish' AND exception_code = 0)")
 	}
 
-	// Filter by minimum duration (queries slower than this threshold)
+	// Filter for anything that looks like a failure
+	// Broader than OnlyFailed: also catches rows that carry an exception message
+	// with a zero code (seen on older versions) and ExceptionWhileProcessing rows
+	if filter.HasException {
+		conditions = append(conditions, "(exception_code != 0 OR exception != '' OR type LIKE 'Exception%')")
+	}
+
+	// Filter by a list of exception codes (IN list with one placeholder per code)
+	if len(filter.ExceptionCodes) > 0 {
+		placeholders := make([]string, len(filter.ExceptionCodes))
+		for i, code := range filter.ExceptionCodes {
+			placeholders[i] = "?"
+			args = append(args, code)
+		}
+		conditions = append(conditions, fmt.Sprintf("exception_code IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	// Filter by minimum duration (queries at least this slow, inclusive)
 	// Useful for finding slow queries that need optimization
 	if filter.MinDurationMs > 0 {
-		conditions = append(conditions, "query_duration_ms > ?")
+		conditions = append(conditions, "query_duration_ms >= ?")
 		args = append(args, filter.MinDurationMs)
 	}
 
+	// Filter by minimum peak memory usage (only on servers with the column)
+	if filter.MinPeakMemoryUsage > 0 {
+		conditions = append(conditions, "peak_memory_usage >= ?")
+		args = append(args, filter.MinPeakMemoryUsage)
+	}
+
+	// Filter by memory per row read; greatest() guards queries that read nothing
+	if filter.MinMemoryPerRow > 0 {
+		conditions = append(conditions, "memory_usage / greatest(read_rows, 1) >= ?")
+		args = append(args, filter.MinMemoryPerRow)
+	}
+
+	// Filter by minimum rows read (large scans)
+	if filter.MinReadRows > 0 {
+		conditions = append(conditions, "read_rows >= ?")
+		args = append(args, filter.MinReadRows)
+	}
+
+	// Filter by number of tables/databases touched
+	if filter.MinTables > 0 {
+		conditions = append(conditions, "length(tables) >= ?")
+		args = append(args, filter.MinTables)
+	}
+	if filter.MinDatabases > 0 {
+		conditions = append(conditions, "length(databases) >= ?")
+		args = append(args, filter.MinDatabases)
+	}
+
 	// Filter by user (exact match)
 	if filter.User != "" {
 		conditions = append(conditions, "user = ?")
 		args = append(args, filter.User)
 	}
 
-	// Filter by query content (case-insensitive substring match)
-	// Uses positionCaseInsensitive for efficient string search
+	// Filter by OS user of the client (exact match)
+	if filter.OSUser != "" {
+		conditions = append(conditions, "os_user = ?")
+		args = append(args, filter.OSUser)
+	}
+
+	// Filter by client name, e.g. clickhouse-client vs a BI tool (exact match)
+	if filter.ClientName != "" {
+		conditions = append(conditions, "client_name = ?")
+		args = append(args, filter.ClientName)
+	}
+
+	// Filter by INSERT target table. tables lists read and written tables alike,
+	// so an INSERT ... SELECT also matches on the tables it reads from
+	if filter.InsertTarget != "" {
+		conditions = append(conditions, "(query_kind = 'Insert' AND has(tables, ?))")
+		args = append(args, filter.InsertTarget)
+	}
+
+	// Filter by SQL features the query used. Columns come from UsedFeatures,
+	// a fixed list, so they are safe to interpolate
+	for _, feature := range filter.UsedFeatures() {
+		conditions = append(conditions, "has("+feature.Column+", ?)")
+		args = append(args, feature.Name)
+	}
+
+	// Filter by exact event type (validated against ValidQueryTypes by the handler)
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+
+	// Filter by query cache usage (validated against ValidCacheUsage by the handler)
+	if filter.CacheUsage != "" {
+		conditions = append(conditions, "query_cache_usage = ?")
+		args = append(args, filter.CacheUsage)
+	}
+
+	// Filter by query content (substring match)
+	// Uses positionCaseInsensitive, or position when case_sensitive is set
 	if filter.QueryContains != "" {
-		conditions = append(conditions, "positionCaseInsensitive(query, ?) > 0")
+		if filter.CaseSensitive {
+			conditions = append(conditions, "position(query, ?) > 0")
+		} else {
+			conditions = append(conditions, "positionCaseInsensitive(query, ?) > 0")
+		}
 		args = append(args, filter.QueryContains)
 	}
 
+	// Filter by query prefix, e.g. "INSERT INTO staging"
+	// startsWith is case-sensitive, so the case-insensitive form compares lowercased values
+	if filter.QueryStartsWith != "" {
+		if filter.CaseSensitive {
+			conditions = append(conditions, "startsWith(query, ?)")
+			args = append(args, filter.QueryStartsWith)
+		} else {
+			conditions = append(conditions, "startsWith(lowerUTF8(query), lowerUTF8(?))")
+			args = append(args, filter.QueryStartsWith)
+		}
+	}
+
 	// Filter by time range - start time
+	// query_log is partitioned by event_date, so the matching event_date bound lets
+	// ClickHouse prune partitions. The date is taken in the server time zone,
+	// which is the zone event_date is computed in.
 	if filter.StartTime != nil {
-		conditions = append(conditions, "event_time >= ?")
-		args = append(args, *filter.StartTime)
+		conditions = append(conditions, "event_date >= toDate(?, timezone())", "event_time >= ?")
+		args = append(args, *filter.StartTime, *filter.StartTime)
 	}
 
 	// Filter by time range - end time
 	if filter.EndTime != nil {
-		conditions = append(conditions, "event_time <= ?")
-		args = append(args, *filter.EndTime)
+		conditions = append(conditions, "event_date <= toDate(?, timezone())", "event_time <= ?")
+		args = append(args, *filter.EndTime, *filter.EndTime)
 	}
 
-	// Build the complete query
-	var queryBuilder strings.Builder
-	queryBuilder.WriteString(baseQuery)
+	// Polling cursor - only rows strictly newer than the last one the client saw
+	if filter.After != nil {
+		conditions = append(conditions, "event_date >= toDate(?, timezone())", "event_time > ?")
+		args = append(args, *filter.After, *filter.After)
+	}
 
-	// Add WHERE clause if we have any conditions
-	if len(conditions) > 0 {
-		queryBuilder.WriteString(" WHERE ")
-		queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	return conditions, args
+}
+
+// conditionWeights are the per-value costs of conditions using expensive
+// functions, checked in order; any other condition costs 1 per value.
+var conditionWeights = []struct {
+	function string
+	weight   int
+}{
+	{"positionCaseInsensitive(", 10},
+	{"lowerUTF8(", 10},
+	{"position(", 5},
+	{"startsWith(", 5},
+}
+
+// FilterCost estimates how expensive the filter's WHERE clause is to plan and
+// evaluate. It is computed from buildConditions, so every filter is counted the
+// same way: each condition costs its weight (see conditionWeights) times the
+// number of values bound to it, so an IN list costs one per element.
+// Conditions without bound values (e.g. the QueryStart exclusion) cost 1.
+func FilterCost(filter models.QueryLogFilter) int {
+	conditions, _ := buildConditions(filter)
+	cost := 0
+	for _, cond := range conditions {
+		weight := 1
+		for _, w := range conditionWeights {
+			if strings.Contains(cond, w.function) {
+				weight = w.weight
+				break
+			}
+		}
+		cost += weight * max(strings.Count(cond, "?"), 1)
 	}
+	return cost
+}
 
-	// Add ORDER BY for consistent, predictable results (most recent first)
-	queryBuilder.WriteString(" ORDER BY event_time DESC")
+// ValidateSort checks sort_by against the allowed columns and sort_order against asc/desc.
+// Empty values are valid and select the defaults.
+func ValidateSort(sortBy, sortOrder string, allowed map[string]bool) error {
+	if sortBy != "" && !allowed[sortBy] {
+		return fmt.Errorf("invalid sort_by: %q", sortBy)
+	}
+	if sortOrder != "" && !strings.EqualFold(sortOrder, "asc") && !strings.EqualFold(sortOrder, "desc") {
+		return fmt.Errorf("invalid sort_order: %q (expected asc or desc)", sortOrder)
+	}
+	return nil
+}
 
-	// Apply pagination with LIMIT and OFFSET
-	// Enforce limits to prevent excessive data retrieval
-	limit := filter.Limit
-	if limit <= 0 {
-		limit = defaultLimit
-	} else if limit > maxLimit {
-		limit = maxLimit
+// orderByClause builds the ORDER BY clause for the filter's sort settings.
+// The sort column is interpolated into the SQL, so it is re-checked against
+// allowed here and falls back to defaultColumn, even though handlers already
+// reject invalid values via ValidateSort.
+func orderByClause(filter models.QueryLogFilter, defaultColumn string, allowed map[string]bool) string {
+	// Polling with a cursor always returns rows oldest first so the client can append them
+	if filter.After != nil && allowed["event_time"] {
+		return " ORDER BY event_time ASC"
 	}
 
-	queryBuilder.WriteString(" LIMIT ?")
-	args = append(args, limit)
+	sortBy := defaultColumn
+	if allowed[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
 
-	// Add OFFSET for pagination
-	if filter.Offset > 0 {
-		queryBuilder.WriteString(" OFFSET ?")
-		args = append(args, filter.Offset)
+	sortOrder := "DESC"
+	if strings.EqualFold(filter.SortOrder, "asc") {
+		sortOrder = "ASC"
 	}
 
-	return queryBuilder.String(), args
+	return fmt.Sprintf(" ORDER BY %s %s", sortBy, sortOrder)
+}
+
+// queryLogOrderBy builds the ORDER BY clause for query_log row listings. The
+// requested sort is followed by event_time_microseconds and query_id in the same
+// direction, so rows within the same second have a stable order across pages.
+func queryLogOrderBy(filter models.QueryLogFilter) string {
+	clause := orderByClause(filter, "event_time", models.ValidSortColumns)
+
+	direction := "DESC"
+	if strings.HasSuffix(clause, " ASC") {
+		direction = "ASC"
+	}
+	return fmt.Sprintf("%s, event_time_microseconds %s, query_id %s", clause, direction, direction)
 }
 
 // ParseColumns validates and parses the columns parameter.
 // Returns the list of valid column names, or all columns if the input is empty.
+// Duplicates are dropped, keeping the first occurrence. Requests listing more
+// columns than exist in ValidColumns are rejected.
 func ParseColumns(columnsParam string) ([]string, error) {
 	if columnsParam == "" {
 		return models.AllColumns(), nil
 	}
 
 	requested := strings.Split(columnsParam, ",")
+	if len(requested) > len(models.ValidColumns) {
+		return nil, fmt.Errorf("too many columns: %d requested, at most %d allowed", len(requested), len(models.ValidColumns))
+	}
+
 	var validated []string
+	seen := make(map[string]bool, len(requested))
 	for _, col := range requested {
 		col = strings.TrimSpace(col)
 		if col == "" {
@@ -266,6 +857,10 @@ func ParseColumns(columnsParam string) ([]string, error) {
 		if !models.ValidColumns[col] {
 			return nil, fmt.Errorf("invalid column: %s", col)
 		}
+		if seen[col] {
+			continue
+		}
+		seen[col] = true
 		validated = append(validated, col)
 	}
 
@@ -279,15 +874,51 @@ func ParseColumns(columnsParam string) ([]string, error) {
 // GetQueryLogsDynamic retrieves query logs with dynamic column selection.
 // Only the specified columns are returned in the response.
 func (r *QueryLogRepository) GetQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string) ([]map[string]interface{}, error) {
+	results := make([]map[string]interface{}, 0)
+	err := r.StreamQueryLogsDynamic(ctx, filter, columns, func(row map[string]interface{}) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamQueryLogsDynamic runs the same query as GetQueryLogsDynamic but passes
+// each row to fn as soon as it is scanned instead of collecting the result.
+// Iteration stops at the first error returned by fn.
+func (r *QueryLogRepository) StreamQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string, fn func(row map[string]interface{}) error) error {
+	if slices.Contains(columns, "error_name") {
+		if err := r.resolveErrorNames(ctx); err != nil {
+			return err
+		}
+	}
 	query, args := r.buildDynamicQuery(filter, columns)
 
-	rows, err := r.db.DB().QueryContext(ctx, query, args...)
+	release, err := r.acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query query_log: %w", err)
+		return err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query query_log: %w", err)
 	}
 	defer rows.Close()
 
-	results := make([]map[string]interface{}, 0)
+	// The export header, the SELECT list and each row's values are all derived
+	// from columns, in that order. Check that the server returned exactly those
+	// columns so a scan target can never be paired with the wrong column.
+	got, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read result columns: %w", err)
+	}
+	if err := checkResultColumns(got, columns); err != nil {
+		return err
+	}
+
 	for rows.Next() {
 		// Create scan targets for each column
 		values := make([]interface{}, len(columns))
@@ -296,7 +927,7 @@ func (r *QueryLogRepository) GetQueryLogsDynamic(ctx context.Context, filter mod
 		}
 
 		if err := rows.Scan(values...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		// Build the result map
@@ -304,34 +935,82 @@ func (r *QueryLogRepository) GetQueryLogsDynamic(ctx context.Context, filter mod
 		for i, col := range columns {
 			row[col] = r.extractValue(col, values[i])
 		}
-		results = append(results, row)
+		if err := fn(row); err != nil {
+			return err
+		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating query_log rows: %w", err)
+		return fmt.Errorf("error iterating query_log rows: %w", err)
 	}
 
-	return results, nil
+	return nil
+}
+
+// scanKinds maps the kinds accepted in COLUMN_TYPE_OVERRIDES to a constructor
+// for their scan target.
+var scanKinds = map[string]func() interface{}{
+	"string":        func() interface{} { return new(string) },
+	"int32":         func() interface{} { return new(int32) },
+	"int64":         func() interface{} { return new(int64) },
+	"uint8":         func() interface{} { return new(uint8) },
+	"uint64":        func() interface{} { return new(uint64) },
+	"float64":       func() interface{} { return new(float64) },
+	"datetime":      func() interface{} { return new(time.Time) },
+	"array(string)": func() interface{} { return new([]string) },
+}
+
+// ParseColumnTypeOverrides parses "column:kind" pairs into a map for
+// Options.ColumnTypes. Columns must be in ValidColumns and kinds in scanKinds.
+func ParseColumnTypeOverrides(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	overrides := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		col, kind, ok := strings.Cut(pair, ":")
+		col, kind = strings.TrimSpace(col), strings.TrimSpace(kind)
+		if !ok || col == "" || kind == "" {
+			return nil, fmt.Errorf("invalid column type override %q (expected column:kind)", pair)
+		}
+		if !models.ValidColumns[col] {
+			return nil, fmt.Errorf("invalid column type override %q: unknown column %q", pair, col)
+		}
+		if scanKinds[kind] == nil {
+			return nil, fmt.Errorf("invalid column type override %q: unsupported kind %q", pair, kind)
+		}
+		overrides[col] = kind
+	}
+	return overrides, nil
 }
 
 // createScanTarget creates an appropriate pointer for scanning a column value.
+// Columns in Options.ColumnTypes use the overridden kind.
 func (r *QueryLogRepository) createScanTarget(col string) interface{} {
+	if kind, ok := r.opts.ColumnTypes[col]; ok {
+		return scanKinds[kind]()
+	}
 	switch col {
 	case "query_id", "query", "type", "exception", "user", "client_hostname",
-		"http_user_agent", "initial_user", "initial_query_id":
+		"http_user_agent", "initial_user", "initial_query_id", "os_user", "client_name",
+		"query_cache_usage", "error_name", "trace_id":
 		return new(string)
 	case "event_time", "event_date":
 		return new(time.Time)
 	case "query_duration_ms", "read_rows", "read_bytes", "written_rows",
-		"written_bytes", "result_rows", "result_bytes":
+		"written_bytes", "result_rows", "result_bytes", "tables_count", "databases_count":
 		return new(uint64)
-	case "memory_usage":
+	case "memory_usage", "peak_memory_usage":
 		return new(int64)
+	case "query_duration_s":
+		return new(float64)
 	case "exception_code":
 		return new(int32)
-	case "is_initial_query":
+	case "is_initial_query", "interface":
 		return new(uint8)
-	case "databases", "tables":
+	case "databases", "tables", "used_aggregate_functions", "used_aggregate_function_combinators",
+		"used_database_engines", "used_data_type_families", "used_dictionaries", "used_formats",
+		"used_functions", "used_storages", "used_table_functions":
 		return new([]string)
 	default:
 		return new(interface{})
@@ -340,126 +1019,301 @@ func (r *QueryLogRepository) createScanTarget(col string) interface{} {
 
 // extractValue extracts the actual value from a scan target pointer.
 func (r *QueryLogRepository) extractValue(col string, ptr interface{}) interface{} {
+	if _, ok := r.opts.ColumnTypes[col]; ok {
+		return reflect.ValueOf(ptr).Elem().Interface()
+	}
 	switch col {
 	case "query_id", "query", "type", "exception", "user", "client_hostname",
-		"http_user_agent", "initial_user", "initial_query_id":
+		"http_user_agent", "initial_user", "initial_query_id", "os_user", "client_name",
+		"query_cache_usage":
 		return *ptr.(*string)
+	case "error_name":
+		if r.errorNamesInGo() {
+			// Selected as the code itself (see buildDynamicQuery)
+			code, _ := strconv.ParseInt(*ptr.(*string), 10, 32)
+			return models.ErrorCodeName(int32(code))
+		}
+		return *ptr.(*string)
+	case "trace_id":
+		return r.traceID(*ptr.(*string))
 	case "event_time", "event_date":
 		return *ptr.(*time.Time)
 	case "query_duration_ms", "read_rows", "read_bytes", "written_rows",
-		"written_bytes", "result_rows", "result_bytes":
+		"written_bytes", "result_rows", "result_bytes", "tables_count", "databases_count":
 		return *ptr.(*uint64)
-	case "memory_usage":
+	case "memory_usage", "peak_memory_usage":
 		return *ptr.(*int64)
+	case "query_duration_s":
+		return *ptr.(*float64)
 	case "exception_code":
 		return *ptr.(*int32)
 	case "is_initial_query":
 		return *ptr.(*uint8)
-	case "databases", "tables":
+	case "interface":
+		return models.NewEnumValue(col, int64(*ptr.(*uint8)))
+	case "databases", "tables", "used_aggregate_functions", "used_aggregate_function_combinators",
+		"used_database_engines", "used_data_type_families", "used_dictionaries", "used_formats",
+		"used_functions", "used_storages", "used_table_functions":
 		return *ptr.(*[]string)
 	default:
 		return ptr
 	}
 }
 
+// selectExpr returns the SELECT expression for a validated column name.
+// Derived columns are computed from their SQL expression; others are selected as-is.
+func selectExpr(col string) string {
+	if expr, ok := models.DerivedColumns[col]; ok {
+		return fmt.Sprintf("%s AS %s", expr, col)
+	}
+	return col
+}
+
+// checkResultColumns verifies that the result set's column names (got) are
+// exactly the requested columns in the requested order. Derived columns are
+// selected with an alias of their name, so every returned name should match.
+func checkResultColumns(got, columns []string) error {
+	if !slices.Equal(got, columns) {
+		return fmt.Errorf("result columns %v do not match requested columns %v", got, columns)
+	}
+	return nil
+}
+
 // buildDynamicQuery constructs a SQL query with dynamic column selection.
 func (r *QueryLogRepository) buildDynamicQuery(filter models.QueryLogFilter, columns []string) (string, []interface{}) {
+	selectExprs := make([]string, len(columns))
+	for i, col := range columns {
+		selectExprs[i] = selectExpr(col)
+		if col == "error_name" && r.errorNamesInGo() {
+			// Resolved from the code in extractValue
+			selectExprs[i] = "toString(exception_code) AS error_name"
+		}
+	}
+
 	var queryBuilder strings.Builder
 	queryBuilder.WriteString("SELECT ")
-	queryBuilder.WriteString(strings.Join(columns, ", "))
-	queryBuilder.WriteString(" FROM system.query_log")
+	queryBuilder.WriteString(strings.Join(selectExprs, ", "))
+	queryBuilder.WriteString(" FROM " + r.queryLogTable(filter.Shard))
 
 	// Collect WHERE conditions and their corresponding arguments
-	var conditions []string
-	var args []interface{}
-
-	if filter.DBName != "" {
-		conditions = append(conditions, "has(databases, ?)")
-		args = append(args, filter.DBName)
+	conditions, args := r.scopedConditions(filter)
+	if sampled(filter.Sample) {
+		condition, arg := sampleCondition(filter.Sample)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
 	}
 
-	if filter.QueryID != "" {
-		conditions = append(conditions, "query_id = ?")
-		args = append(args, filter.QueryID)
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
 	}
 
-	// Always exclude QueryStart entries - we only want completed queries
-	conditions = append(conditions, "type != 'QueryStart'")
+	queryBuilder.WriteString(queryLogOrderBy(filter))
 
-	if filter.OnlyFailed {
-		conditions = append(conditions, "(exception_code != 0 OR type = 'ExceptionBeforeStart')")
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
 	}
 
-	if filter.OnlySuccess {
-		conditions = append(conditions, "(type = 'QueryFinish' AND exception_code = 0)")
+	queryBuilder.WriteString(" LIMIT ?")
+	args = append(args, limit)
+
+	if filter.Offset > 0 {
+		queryBuilder.WriteString(" OFFSET ?")
+		args = append(args, filter.Offset)
 	}
 
-	if filter.MinDurationMs > 0 {
-		conditions = append(conditions, "query_duration_ms > ?")
-		args = append(args, filter.MinDurationMs)
+	return queryBuilder.String(), args
+}
+
+// CountQueryLogs returns the number of query_log rows matching the filter.
+// It applies the same WHERE conditions as GetQueryLogs, ignoring pagination.
+func (r *QueryLogRepository) CountQueryLogs(ctx context.Context, filter models.QueryLogFilter) (uint64, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString("SELECT count() FROM " + r.queryLogTable(filter.Shard))
+
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
 	}
 
-	if filter.User != "" {
-		conditions = append(conditions, "user = ?")
-		args = append(args, filter.User)
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return 0, err
 	}
+	defer release()
 
-	if filter.QueryContains != "" {
-		conditions = append(conditions, "positionCaseInsensitive(query, ?) > 0")
-		args = append(args, filter.QueryContains)
+	rows, err := r.db.QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count query_log rows: %w", err)
 	}
+	defer rows.Close()
 
-	if filter.StartTime != nil {
-		conditions = append(conditions, "event_time >= ?")
-		args = append(args, *filter.StartTime)
+	var count uint64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to scan query_log count: %w", err)
+		}
 	}
 
-	if filter.EndTime != nil {
-		conditions = append(conditions, "event_time <= ?")
-		args = append(args, *filter.EndTime)
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating query_log count: %w", err)
 	}
 
+	return count, nil
+}
+
+// GetScanEfficiency totals the rows read and returned by the queries matching
+// the filter. The ratio is computed in SQL, guarded against reading no rows.
+func (r *QueryLogRepository) GetScanEfficiency(ctx context.Context, filter models.QueryLogFilter) (*models.ScanEfficiency, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(`
+		SELECT
+			SUM(read_rows) as total_read_rows,
+			SUM(result_rows) as total_result_rows,
+			if(total_read_rows > 0, total_result_rows / total_read_rows, 0) as ratio
+		FROM ` + r.queryLogTable(filter.Shard))
+
 	if len(conditions) > 0 {
 		queryBuilder.WriteString(" WHERE ")
 		queryBuilder.WriteString(strings.Join(conditions, " AND "))
 	}
 
-	queryBuilder.WriteString(" ORDER BY event_time DESC")
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	limit := filter.Limit
-	if limit <= 0 {
-		limit = defaultLimit
-	} else if limit > maxLimit {
-		limit = maxLimit
+	rows, err := r.db.QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan efficiency: %w", err)
 	}
+	defer rows.Close()
 
-	queryBuilder.WriteString(" LIMIT ?")
-	args = append(args, limit)
+	var efficiency models.ScanEfficiency
+	if rows.Next() {
+		if err := rows.Scan(&efficiency.TotalReadRows, &efficiency.TotalResultRows, &efficiency.Ratio); err != nil {
+			return nil, fmt.Errorf("failed to scan scan efficiency: %w", err)
+		}
+	}
 
-	if filter.Offset > 0 {
-		queryBuilder.WriteString(" OFFSET ?")
-		args = append(args, filter.Offset)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scan efficiency: %w", err)
 	}
 
-	return queryBuilder.String(), args
+	return &efficiency, nil
+}
+
+// GetCoverage returns the time range, row count and on-disk size of system.query_log.
+// With AllowedDatabases the range and count cover only the allowed rows, and
+// the size, which covers the whole table, is left out.
+func (r *QueryLogRepository) GetCoverage(ctx context.Context) (*models.QueryLogCoverage, error) {
+	query, args := r.buildCoverageQuery()
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query query_log coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		coverage       models.QueryLogCoverage
+		oldest, newest time.Time
+		bytesOnDisk    uint64
+	)
+	if rows.Next() {
+		if err := rows.Scan(&oldest, &newest, &coverage.TotalRows, &bytesOnDisk); err != nil {
+			return nil, fmt.Errorf("failed to scan query_log coverage: %w", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating query_log coverage: %w", err)
+	}
+
+	// min/max return the zero DateTime on an empty table
+	if coverage.TotalRows > 0 {
+		coverage.OldestEventTime = &oldest
+		coverage.NewestEventTime = &newest
+	}
+	if len(r.opts.AllowedDatabases) == 0 {
+		coverage.BytesOnDisk = &bytesOnDisk
+	}
+
+	return &coverage, nil
+}
+
+// buildCoverageQuery constructs the coverage query, scoped to AllowedDatabases.
+func (r *QueryLogRepository) buildCoverageQuery() (string, []interface{}) {
+	if len(r.opts.AllowedDatabases) > 0 {
+		return `
+		SELECT min(event_time), max(event_time), count(), toUInt64(0)
+		FROM system.query_log
+		WHERE hasAny(databases, ?)`, []interface{}{r.opts.AllowedDatabases}
+	}
+	return `
+		SELECT
+			min(event_time),
+			max(event_time),
+			count(),
+			(
+				SELECT sum(bytes_on_disk)
+				FROM system.parts
+				WHERE database = 'system' AND table = 'query_log' AND active
+			)
+		FROM system.query_log`, nil
 }
 
-// GetDatabases retrieves all database names from ClickHouse.
+// GetDatabases retrieves all database names from ClickHouse, limited to
+// AllowedDatabases when set.
 func (r *QueryLogRepository) GetDatabases(ctx context.Context) ([]string, error) {
 	query := `SELECT name FROM system.databases ORDER BY name`
 
-	rows, err := r.db.DB().QueryContext(ctx, query)
+	result, err := r.coalesce(ctx, query, nil, func(ctx context.Context) (interface{}, error) {
+		return r.queryDatabases(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(result.([]string)), nil
+}
+
+// queryDatabases runs the database list query, skipping names outside AllowedDatabases.
+func (r *QueryLogRepository) queryDatabases(ctx context.Context, query string) ([]string, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query databases: %w", err)
 	}
 	defer rows.Close()
 
-	var databases []string
+	databases := make([]string, 0)
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
 			return nil, fmt.Errorf("failed to scan database name: %w", err)
 		}
+		if !r.AllowedDatabase(name) {
+			continue
+		}
 		databases = append(databases, name)
 	}
 
@@ -473,134 +1327,348 @@ func (r *QueryLogRepository) GetDatabases(ctx context.Context) ([]string, error)
 // GetQueryLogByID retrieves a single query log entry by its query_id.
 // Note: query_id may not be unique across time, so this returns the most recent match.
 func (r *QueryLogRepository) GetQueryLogByID(ctx context.Context, queryID string) (*models.QueryLog, error) {
+	if err := r.resolveErrorNames(ctx); err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT
-			query_id,
-			query,
-			event_time,
-			event_date,
-			type,
-			query_duration_ms,
-			memory_usage,
-			read_rows,
-			read_bytes,
-			written_rows,
-			written_bytes,
-			result_rows,
-			result_bytes,
-			databases,
-			tables,
-			exception_code,
-			exception,
-			user,
-			client_hostname,
-			http_user_agent,
-			initial_user,
-			initial_query_id,
-			is_initial_query
+		SELECT` + r.queryLogSelectColumns() + `
 		FROM system.query_log
-		WHERE query_id = ?
+		WHERE query_id = ?%s
 		ORDER BY event_time DESC
 		LIMIT 1
 	`
+	args := []interface{}{queryID}
 
-	row := r.db.DB().QueryRowContext(ctx, query, queryID)
+	// Queries outside AllowedDatabases are reported as not found
+	scope := ""
+	if len(r.opts.AllowedDatabases) > 0 {
+		scope = " AND hasAny(databases, ?)"
+		args = append(args, r.opts.AllowedDatabases)
+	}
+	query = fmt.Sprintf(query, scope)
 
-	var log models.QueryLog
-	var databases, tables []string
-	err := row.Scan(
-		&log.QueryID,
-		&log.Query,
-		&log.EventTime,
-		&log.EventDate,
-		&log.Type,
-		&log.QueryDurationMs,
-		&log.MemoryUsage,
-		&log.ReadRows,
-		&log.ReadBytes,
-		&log.WrittenRows,
-		&log.WrittenBytes,
-		&log.ResultRows,
-		&log.ResultBytes,
-		&databases,
-		&tables,
-		&log.ExceptionCode,
-		&log.Exception,
-		&log.User,
-		&log.ClientHostname,
-		&log.HTTPUserAgent,
-		&log.InitialUser,
-		&log.InitialQueryID,
-		&log.IsInitialQuery,
-	)
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get query log by ID: %w", err)
 	}
-	log.Databases = databases
-	log.Tables = tables
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get query log by ID: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get query log by ID: %w", sql.ErrNoRows)
+	}
+
+	var log models.QueryLog
+	if err := r.scanQueryLog(rows, &log); err != nil {
+		return nil, fmt.Errorf("failed to get query log by ID: %w", err)
+	}
 
 	return &log, nil
 }
 
-// BucketSize represents a time bucket configuration for aggregation.
-type BucketSize struct {
-	Interval string // ClickHouse interval string (e.g., "1 SECOND", "1 MINUTE")
-	Label    string // Human-readable label (e.g., "1s", "1m")
-}
+// GetProfileEvents retrieves the ProfileEvents map of the most recent
+// query_log row for queryID, scoped to AllowedDatabases like GetQueryLogByID.
+func (r *QueryLogRepository) GetProfileEvents(ctx context.Context, queryID string) (map[string]uint64, error) {
+	query := `
+		SELECT ProfileEvents
+		FROM system.query_log
+		WHERE query_id = ?%s
+		ORDER BY event_time DESC
+		LIMIT 1
+	`
+	args := []interface{}{queryID}
+
+	scope := ""
+	if len(r.opts.AllowedDatabases) > 0 {
+		scope = " AND hasAny(databases, ?)"
+		args = append(args, r.opts.AllowedDatabases)
+	}
+	query = fmt.Sprintf(query, scope)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile events: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get profile events: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get profile events: %w", sql.ErrNoRows)
+	}
+
+	events := map[string]uint64{}
+	if err := rows.Scan(&events); err != nil {
+		return nil, fmt.Errorf("failed to get profile events: %w", err)
+	}
+
+	return events, nil
+}
+
+// FormatQuery pretty-prints SQL text using ClickHouse's formatQuery() function.
+// Formatting is best-effort: it fails on servers without formatQuery() and on
+// queries that don't parse (e.g. ExceptionBeforeStart entries), so it bypasses
+// the circuit breaker to avoid counting those expected errors as outages.
+func (r *QueryLogRepository) FormatQuery(ctx context.Context, query string) (string, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var formatted string
+	if err := r.db.DB().QueryRowContext(ctx, "SELECT formatQuery(?)", query).Scan(&formatted); err != nil {
+		return "", fmt.Errorf("failed to format query: %w", err)
+	}
+
+	return formatted, nil
+}
+
+// BucketSize represents a time bucket configuration for aggregation.
+type BucketSize struct {
+	Interval string        // ClickHouse interval string (e.g., "1 SECOND", "1 MINUTE")
+	Label    string        // Human-readable label (e.g., "1s", "1m")
+	Duration time.Duration // Length of one bucket
+
+	// Clamped is set when the bucket was widened to stay within MaxBuckets
+	Clamped bool
+}
+
+// bucketSizes lists the bucket sizes from finest to coarsest together with the
+// longest time range each one is used for. This keeps charts at a reasonable
+// number of data points (roughly 60-120).
+var bucketSizes = []struct {
+	maxRange time.Duration
+	size     BucketSize
+}{
+	{5 * time.Minute, BucketSize{Interval: "5 SECOND", Label: "5s", Duration: 5 * time.Second}},     // ~60 points max
+	{30 * time.Minute, BucketSize{Interval: "30 SECOND", Label: "30s", Duration: 30 * time.Second}}, // ~60 points max
+	{2 * time.Hour, BucketSize{Interval: "1 MINUTE", Label: "1m", Duration: time.Minute}},           // ~120 points max
+	{6 * time.Hour, BucketSize{Interval: "3 MINUTE", Label: "3m", Duration: 3 * time.Minute}},       // ~120 points max
+	{24 * time.Hour, BucketSize{Interval: "15 MINUTE", Label: "15m", Duration: 15 * time.Minute}},   // ~96 points max
+	{7 * 24 * time.Hour, BucketSize{Interval: "1 HOUR", Label: "1h", Duration: time.Hour}},          // ~168 points max
+	{30 * 24 * time.Hour, BucketSize{Interval: "6 HOUR", Label: "6h", Duration: 6 * time.Hour}},     // ~120 points max
+	{0, BucketSize{Interval: "1 DAY", Label: "1d", Duration: 24 * time.Hour}},                       // anything longer
+}
 
 // determineBucketSize selects the optimal bucket size based on the time range.
-// This ensures charts have a reasonable number of data points (roughly 60-120).
 func determineBucketSize(startTime, endTime *time.Time) BucketSize {
 	if startTime == nil || endTime == nil {
 		// Default to 1 minute if no time range specified
-		return BucketSize{Interval: "1 MINUTE", Label: "1m"}
+		return bucketSizes[2].size
 	}
 
 	duration := endTime.Sub(*startTime)
+	for _, b := range bucketSizes {
+		if b.maxRange == 0 || duration <= b.maxRange {
+			return b.size
+		}
+	}
+	return bucketSizes[len(bucketSizes)-1].size
+}
 
-	switch {
-	case duration <= 5*time.Minute:
-		// Up to 5 min: bucket by 5 seconds (~60 points max)
-		return BucketSize{Interval: "5 SECOND", Label: "5s"}
-	case duration <= 30*time.Minute:
-		// Up to 30 min: bucket by 30 seconds (~60 points max)
-		return BucketSize{Interval: "30 SECOND", Label: "30s"}
-	case duration <= 2*time.Hour:
-		// Up to 2 hours: bucket by 1 minute (~120 points max)
-		return BucketSize{Interval: "1 MINUTE", Label: "1m"}
-	case duration <= 6*time.Hour:
-		// Up to 6 hours: bucket by 3 minutes (~120 points max)
-		return BucketSize{Interval: "3 MINUTE", Label: "3m"}
-	case duration <= 24*time.Hour:
-		// Up to 1 day: bucket by 15 minutes (~96 points max)
-		return BucketSize{Interval: "15 MINUTE", Label: "15m"}
-	case duration <= 7*24*time.Hour:
-		// Up to 1 week: bucket by 1 hour (~168 points max)
-		return BucketSize{Interval: "1 HOUR", Label: "1h"}
-	case duration <= 30*24*time.Hour:
-		// Up to 30 days: bucket by 6 hours (~120 points max)
-		return BucketSize{Interval: "6 HOUR", Label: "6h"}
-	default:
-		// More than 30 days: bucket by 1 day
-		return BucketSize{Interval: "1 DAY", Label: "1d"}
+// chooseBucket picks the bucket size for filter's time range and widens it
+// until the range spans at most MaxBuckets buckets.
+func (r *QueryLogRepository) chooseBucket(filter models.QueryLogFilter) BucketSize {
+	return clampedBucket(filter, r.opts.MaxBuckets)
+}
+
+// clampedBucket picks the bucket size for filter's time range and widens it
+// until the range spans at most maxBuckets buckets (0 = no cap). A missing end
+// time counts as now; without a start time the range is unknown and no clamp
+// is applied.
+func clampedBucket(filter models.QueryLogFilter, maxBuckets int) BucketSize {
+	bucket := determineBucketSize(filter.StartTime, filter.EndTime)
+	if maxBuckets <= 0 || filter.StartTime == nil {
+		return bucket
+	}
+
+	end := time.Now()
+	if filter.EndTime != nil {
+		end = *filter.EndTime
+	}
+	span := end.Sub(*filter.StartTime)
+
+	for span/bucket.Duration > time.Duration(maxBuckets) {
+		coarser := coarserBucket(bucket)
+		if coarser.Interval == bucket.Interval {
+			break
+		}
+		bucket = coarser
+		bucket.Clamped = true
+	}
+	return bucket
+}
+
+// coarserBucket returns the next larger bucket size, or b itself if it is already the largest.
+func coarserBucket(b BucketSize) BucketSize {
+	for i, candidate := range bucketSizes[:len(bucketSizes)-1] {
+		if candidate.size.Interval == b.Interval {
+			coarser := bucketSizes[i+1].size
+			coarser.Clamped = b.Clamped
+			return coarser
+		}
 	}
+	return b
+}
+
+// MetricsPlan describes how an aggregated metrics query was executed.
+type MetricsPlan struct {
+	Bucket BucketSize
+
+	// EstimatedRows is the EXPLAIN ESTIMATE row count (0 when not estimated)
+	EstimatedRows uint64
+
+	// Downsampled is set when EstimatedRows exceeded MetricsMaxScanRows
+	Downsampled bool
+
+	// SampleRatio is the fraction of rows aggregated (1 when not sampled)
+	SampleRatio float64
+
+	// PeakMemory is set when query_log has peak_memory_usage; otherwise
+	// max_peak_memory_usage is reported as 0
+	PeakMemory bool
+
+	// FillGaps emits a zeroed row for every empty bucket in the range
+	FillGaps bool
+
+	// Origin is the start time buckets are aligned to, or nil when they are
+	// aligned to the epoch like toStartOfInterval
+	Origin *time.Time
+
+	// ClampMemory aggregates greatest(memory_usage, 0) instead of memory_usage
+	ClampMemory bool
+}
+
+// MetricsOptions are the caller-chosen options of GetAggregatedMetrics.
+type MetricsOptions struct {
+	// FillGaps returns buckets without queries as zeroed rows
+	FillGaps bool
+
+	// ClampMemory treats negative memory_usage values as 0 in avg_memory_usage
+	// and max_memory_usage. memory_usage is the change in the query's memory
+	// tracker between start and finish rather than a peak, so it goes negative
+	// when a query frees more than it allocated (e.g. memory allocated before
+	// it started or by another thread), which drags averages below zero.
+	// max_peak_memory_usage is not affected.
+	ClampMemory bool
+
+	// AlignToStart aligns buckets to the filter's start time instead of the
+	// epoch, so the first bucket covers a full interval from start_time.
+	// Ignored without a start time.
+	AlignToStart bool
 }
 
 // GetAggregatedMetrics retrieves time-bucketed aggregated metrics for charts.
-// It automatically determines the bucket size based on the time range.
-func (r *QueryLogRepository) GetAggregatedMetrics(ctx context.Context, filter models.QueryLogFilter) ([]models.QueryLogMetrics, BucketSize, error) {
-	bucket := determineBucketSize(filter.StartTime, filter.EndTime)
+// It automatically determines the bucket size based on the time range, and
+// aggregates only a sample of queries when filter.Sample is set. When
+// MetricsMaxScanRows is set and the query is estimated to scan more rows than
+// that, the bucket is coarsened one step and, if MetricsSampleRatio allows it,
+// only a deterministic sample of queries is aggregated (the smaller ratio
+// wins when filter.Sample is also set).
+// See MetricsOptions for the gap filling and memory clamping options.
+func (r *QueryLogRepository) GetAggregatedMetrics(ctx context.Context, filter models.QueryLogFilter, opts MetricsOptions) ([]models.QueryLogMetrics, MetricsPlan, error) {
+	plan := MetricsPlan{
+		Bucket:      r.chooseBucket(filter),
+		SampleRatio: 1,
+		FillGaps:    opts.FillGaps,
+		ClampMemory: opts.ClampMemory,
+	}
+	if sampled(filter.Sample) {
+		plan.SampleRatio = filter.Sample
+	}
+	if opts.AlignToStart && filter.StartTime != nil {
+		origin := filter.StartTime.Truncate(time.Second)
+		plan.Origin = &origin
+	}
+
+	// Short, unfiltered ranges can be answered from the recent logs buffer,
+	// whose buckets are epoch-aligned
+	if !opts.FillGaps && plan.Origin == nil {
+		if metrics, ok := r.recent.metrics(filter, plan.Bucket, opts.ClampMemory); ok {
+			return metrics, plan, nil
+		}
+	}
+
+	// Checked before acquiring a slot, since loading the column list may need one
+	hasPeakMemory, err := r.HasColumn(ctx, "peak_memory_usage")
+	if err != nil {
+		return nil, plan, err
+	}
+	plan.PeakMemory = hasPeakMemory
+
+	// Identical concurrent requests (e.g. dashboard panels) share one execution
+	query, args := r.buildAggregationQuery(filter, plan)
+	result, err := r.coalesce(ctx, query, args, func(ctx context.Context) (interface{}, error) {
+		metrics, plan, err := r.queryAggregatedMetrics(ctx, filter, plan)
+		return metricsResult{metrics: metrics, plan: plan}, err
+	})
+	if err != nil {
+		return nil, plan, err
+	}
+	shared := result.(metricsResult)
+	return slices.Clone(shared.metrics), shared.plan, nil
+}
+
+// metricsResult is the shared result of a coalesced aggregated metrics query.
+type metricsResult struct {
+	metrics []models.QueryLogMetrics
+	plan    MetricsPlan
+}
+
+// queryAggregatedMetrics runs the aggregated metrics query for plan, first
+// downsampling it when the row estimate exceeds MetricsMaxScanRows.
+func (r *QueryLogRepository) queryAggregatedMetrics(ctx context.Context, filter models.QueryLogFilter, plan MetricsPlan) ([]models.QueryLogMetrics, MetricsPlan, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, plan, err
+	}
+	defer release()
+
+	if r.opts.MetricsMaxScanRows > 0 {
+		query, args := r.buildAggregationQuery(filter, plan)
+		estimate, err := r.estimateRows(ctx, query, args)
+		if err != nil {
+			// The estimate is only an optimization; run the query as requested
+			log.Printf("metrics row estimate failed, skipping downsampling: %v", err)
+		} else {
+			plan.EstimatedRows = estimate
+			if estimate > r.opts.MetricsMaxScanRows {
+				plan.Downsampled = true
+				plan.Bucket = coarserBucket(plan.Bucket)
+				if sampled(r.opts.MetricsSampleRatio) && r.opts.MetricsSampleRatio < plan.SampleRatio {
+					plan.SampleRatio = r.opts.MetricsSampleRatio
+				}
+			}
+		}
+	}
 
 	// Build aggregation query
-	query, args := r.buildAggregationQuery(filter, bucket.Interval)
+	query, args := r.buildAggregationQuery(filter, plan)
 
-	rows, err := r.db.DB().QueryContext(ctx, query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, bucket, fmt.Errorf("failed to query aggregated metrics: %w", err)
+		return nil, plan, fmt.Errorf("failed to query aggregated metrics: %w", err)
 	}
 	defer rows.Close()
 
-	var metrics []models.QueryLogMetrics
+	metrics := make([]models.QueryLogMetrics, 0)
 	for rows.Next() {
 		var m models.QueryLogMetrics
 		err := rows.Scan(
@@ -610,86 +1678,642 @@ func (r *QueryLogRepository) GetAggregatedMetrics(ctx context.Context, filter mo
 			&m.MaxDurationMs,
 			&m.AvgMemoryUsage,
 			&m.MaxMemoryUsage,
+			&m.MaxPeakMemoryUsage,
 			&m.TotalReadBytes,
 			&m.TotalWrittenBytes,
 			&m.FailedQueries,
+			&m.ErrorRate,
 		)
 		if err != nil {
-			return nil, bucket, fmt.Errorf("failed to scan aggregated metrics row: %w", err)
+			return nil, plan, fmt.Errorf("failed to scan aggregated metrics row: %w", err)
 		}
 		metrics = append(metrics, m)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, bucket, fmt.Errorf("error iterating aggregated metrics rows: %w", err)
+		return nil, plan, fmt.Errorf("error iterating aggregated metrics rows: %w", err)
+	}
+
+	return metrics, plan, nil
+}
+
+// estimateRows returns ClickHouse's estimate of the rows query would read,
+// summed over all tables in the EXPLAIN ESTIMATE output.
+func (r *QueryLogRepository) estimateRows(ctx context.Context, query string, args []interface{}) (uint64, error) {
+	rows, err := r.db.QueryContext(ctx, "EXPLAIN ESTIMATE "+query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate query rows: %w", err)
+	}
+	defer rows.Close()
+
+	var total uint64
+	for rows.Next() {
+		var (
+			database, table     string
+			parts, count, marks uint64
+		)
+		if err := rows.Scan(&database, &table, &parts, &count, &marks); err != nil {
+			return 0, fmt.Errorf("failed to scan row estimate: %w", err)
+		}
+		total += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating row estimate: %w", err)
 	}
 
-	return metrics, bucket, nil
+	return total, nil
 }
 
-// buildAggregationQuery constructs the SQL query for time-bucketed aggregation.
-func (r *QueryLogRepository) buildAggregationQuery(filter models.QueryLogFilter, bucketInterval string) (string, []interface{}) {
+// sampled reports whether ratio keeps only part of the rows.
+func sampled(ratio float64) bool {
+	return ratio > 0 && ratio < 1
+}
+
+// sampleCondition returns a WHERE condition keeping roughly ratio of the rows.
+// system.query_log has no sampling key, so SAMPLE can't be used; rows are
+// chosen by a hash of query_id instead, which keeps the same queries on every
+// request.
+func sampleCondition(ratio float64) (string, interface{}) {
+	return "sipHash64(query_id) % 10000 < ?", uint64(ratio * 10000)
+}
+
+// buildAggregationQuery constructs the SQL query for time-bucketed aggregation
+// using plan's bucket. A plan.SampleRatio below 1 aggregates only that fraction
+// of queries (see sampleCondition) and scales counts and sums back up so
+// totals stay comparable.
+func (r *QueryLogRepository) buildAggregationQuery(filter models.QueryLogFilter, plan MetricsPlan) (string, []interface{}) {
+	bucketInterval := plan.Bucket.Interval
+	sampleRatio := plan.SampleRatio
+
+	// peak_memory_usage only exists on newer servers
+	maxPeakMemory := "toInt64(0)"
+	if plan.PeakMemory {
+		maxPeakMemory = "MAX(peak_memory_usage)"
+	}
+
+	// Negative memory_usage deltas are optionally counted as 0 (see MetricsOptions)
+	memoryUsage := "memory_usage"
+	if plan.ClampMemory {
+		memoryUsage = "greatest(memory_usage, 0)"
+	}
+
+	totalQueries := "COUNT(*)"
+	failedQueries := "SUM(CASE WHEN exception_code != 0 OR type = 'ExceptionBeforeStart' THEN 1 ELSE 0 END)"
+	totalReadBytes := "SUM(read_bytes)"
+	totalWrittenBytes := "SUM(written_bytes)"
+
+	if sampled(sampleRatio) {
+		// scale is derived from configuration, not user input
+		scale := strconv.FormatFloat(1/sampleRatio, 'f', -1, 64)
+		totalQueries = fmt.Sprintf("toInt64(round(%s * %s))", totalQueries, scale)
+		failedQueries = fmt.Sprintf("toInt64(round(%s * %s))", failedQueries, scale)
+		totalReadBytes = fmt.Sprintf("toUInt64(round(%s * %s))", totalReadBytes, scale)
+		totalWrittenBytes = fmt.Sprintf("toUInt64(round(%s * %s))", totalWrittenBytes, scale)
+	}
+
+	// Buckets start at the epoch-aligned interval boundaries, or every
+	// bucket length from plan.Origin when aligned to the start time
+	timeBucket := fmt.Sprintf("toStartOfInterval(event_time, INTERVAL %s)", bucketInterval)
+	var bucketArgs []interface{}
+	if plan.Origin != nil {
+		origin, seconds := plan.Origin.Unix(), int64(plan.Bucket.Duration/time.Second)
+		timeBucket = "toDateTime(intDiv(toUnixTimestamp(event_time) - ?, ?) * ? + ?)"
+		bucketArgs = []interface{}{origin, seconds, seconds, origin}
+	}
+
 	// Build the aggregation query with the specified bucket interval
-	// Note: bucketInterval is a controlled value from determineBucketSize, not user input
+	// Note: bucketInterval is a controlled value from bucketSizes, not user input
 	baseQuery := fmt.Sprintf(`
 		SELECT
-			toStartOfInterval(event_time, INTERVAL %s) as time_bucket,
-			COUNT(*) as total_queries,
+			%s as time_bucket,
+			%s as total_queries,
 			AVG(query_duration_ms) as avg_duration_ms,
 			MAX(query_duration_ms) as max_duration_ms,
-			AVG(memory_usage) as avg_memory_usage,
-			MAX(memory_usage) as max_memory_usage,
-			SUM(read_bytes) as total_read_bytes,
+			AVG(%s) as avg_memory_usage,
+			MAX(%s) as max_memory_usage,
+			%s as max_peak_memory_usage,
+			%s as total_read_bytes,
+			%s as total_written_bytes,
+			%s as failed_queries,
+			if(total_queries > 0, failed_queries / total_queries, 0) as error_rate
+		FROM %s
+	`, timeBucket, totalQueries, memoryUsage, memoryUsage, maxPeakMemory, totalReadBytes, totalWrittenBytes, failedQueries, r.queryLogTable(filter.Shard))
+
+	// Apply the same filters as regular queries; the bucket placeholders
+	// precede the WHERE placeholders in the query text
+	conditions, args := r.scopedConditions(filter)
+	args = append(bucketArgs, args...)
+
+	if sampled(sampleRatio) {
+		condition, arg := sampleCondition(sampleRatio)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(baseQuery)
+
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	queryBuilder.WriteString(" GROUP BY time_bucket ORDER BY time_bucket ASC")
+
+	if plan.FillGaps {
+		fill, fillArgs := fillClause(filter, bucketInterval, plan.Origin)
+		queryBuilder.WriteString(fill)
+		args = append(args, fillArgs...)
+	}
+
+	return queryBuilder.String(), args
+}
+
+// fillClause returns a WITH FILL modifier for an ORDER BY time_bucket clause so
+// that empty buckets appear as zeroed rows. The fill starts at the bucket
+// containing the filter's start time (at origin when buckets are aligned to
+// it) and runs up to its end time (or now); without a start time only gaps
+// between buckets with data are filled.
+func fillClause(filter models.QueryLogFilter, bucketInterval string, origin *time.Time) (string, []interface{}) {
+	var clause strings.Builder
+	var args []interface{}
+
+	// Note: bucketInterval is a controlled value from bucketSizes, not user input
+	clause.WriteString(" WITH FILL")
+	if filter.StartTime != nil {
+		end := time.Now()
+		if filter.EndTime != nil {
+			end = *filter.EndTime
+		}
+		if origin != nil {
+			clause.WriteString(" FROM toDateTime(?) TO ?")
+			args = append(args, *origin, end)
+		} else {
+			fmt.Fprintf(&clause, " FROM toStartOfInterval(?, INTERVAL %s) TO ?", bucketInterval)
+			args = append(args, *filter.StartTime, end)
+		}
+	}
+	fmt.Fprintf(&clause, " STEP INTERVAL %s", bucketInterval)
+
+	return clause.String(), args
+}
+
+// GetInsertStats retrieves time-bucketed INSERT statistics per target table.
+// Inserts touching several tables are counted once for each via arrayJoin(tables).
+// Parts created per insert come from the MergeTreeDataWriterBlocks profile event.
+func (r *QueryLogRepository) GetInsertStats(ctx context.Context, filter models.QueryLogFilter) ([]models.InsertStats, BucketSize, error) {
+	bucket := r.chooseBucket(filter)
+
+	conditions, args := r.scopedConditions(filter)
+	conditions = append(conditions, "query_kind = 'Insert'")
+
+	// Note: bucket.Interval is a controlled value from bucketSizes, not user input
+	query := fmt.Sprintf(`
+		SELECT
+			toStartOfInterval(event_time, INTERVAL %[1]s) as time_bucket,
+			arrayJoin(tables) as table_name,
+			COUNT(*) as inserts,
+			SUM(written_rows) as total_written_rows,
 			SUM(written_bytes) as total_written_bytes,
+			total_written_rows / dateDiff('second', time_bucket, time_bucket + INTERVAL %[1]s) as rows_per_second,
+			AVG(ProfileEvents['MergeTreeDataWriterBlocks']) as avg_parts_created,
+			SUM(CASE WHEN exception_code != 0 OR type = 'ExceptionBeforeStart' THEN 1 ELSE 0 END) as failed_inserts
+		FROM %[2]s
+		WHERE %[3]s
+		GROUP BY time_bucket, table_name
+		ORDER BY time_bucket ASC, table_name ASC
+	`, bucket.Interval, r.queryLogTable(filter.Shard), strings.Join(conditions, " AND "))
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, bucket, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, bucket, fmt.Errorf("failed to query insert stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]models.InsertStats, 0)
+	for rows.Next() {
+		var st models.InsertStats
+		err := rows.Scan(
+			&st.TimeBucket,
+			&st.Table,
+			&st.Inserts,
+			&st.WrittenRows,
+			&st.WrittenBytes,
+			&st.RowsPerSecond,
+			&st.AvgPartsCreated,
+			&st.FailedInserts,
+		)
+		if err != nil {
+			return nil, bucket, fmt.Errorf("failed to scan insert stats row: %w", err)
+		}
+		stats = append(stats, st)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, bucket, fmt.Errorf("error iterating insert stats rows: %w", err)
+	}
+
+	return stats, bucket, nil
+}
+
+// maxSessionQueryIDs bounds the query IDs returned per session.
+const maxSessionQueryIDs = 100
+
+// GetSessions groups the filtered queries into sessions: a new session starts
+// whenever more than gap has passed since the previous query. Sessionization is
+// done in SQL with window functions over event_time. The most recent sessions
+// are returned first, up to filter.Limit.
+func (r *QueryLogRepository) GetSessions(ctx context.Context, filter models.QueryLogFilter, gap time.Duration) ([]models.QuerySession, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			min(event_time) as start_time,
+			max(event_time) as end_time,
+			COUNT(*) as query_count,
+			SUM(query_duration_ms) as total_duration_ms,
+			SUM(CASE WHEN exception_code != 0 OR type = 'ExceptionBeforeStart' THEN 1 ELSE 0 END) as failed_queries,
+			groupArray(%d)(query_id) as query_ids
+		FROM (
+			SELECT
+				*,
+				SUM(is_new_session) OVER (ORDER BY event_time, query_id ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) as session_id
+			FROM (
+				SELECT
+					event_time,
+					query_id,
+					query_duration_ms,
+					exception_code,
+					type,
+					if(dateDiff('second',
+						lagInFrame(event_time, 1, toDateTime(0)) OVER (ORDER BY event_time, query_id ROWS BETWEEN 1 PRECEDING AND CURRENT ROW),
+						event_time) > ?, 1, 0) as is_new_session
+				FROM %s
+				%s
+			)
+			ORDER BY event_time, query_id
+		)
+		GROUP BY session_id
+		ORDER BY start_time DESC
+		LIMIT ?
+	`, maxSessionQueryIDs, r.queryLogTable(filter.Shard), where)
+
+	// The gap placeholder precedes the WHERE placeholders in the query text
+	args = append([]interface{}{int64(gap / time.Second)}, args...)
+	args = append(args, limit)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]models.QuerySession, 0)
+	for rows.Next() {
+		var session models.QuerySession
+		err := rows.Scan(
+			&session.StartTime,
+			&session.EndTime,
+			&session.QueryCount,
+			&session.TotalDurationMs,
+			&session.FailedQueries,
+			&session.QueryIDs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetRetryBursts finds normalized queries that one user ran at least minCount
+// times within a window. Executions are grouped by pattern, user and fixed
+// window aligned to the epoch, so a burst straddling a window boundary may be
+// split in two. Results are ordered by execution count, largest first.
+func (r *QueryLogRepository) GetRetryBursts(ctx context.Context, filter models.QueryLogFilter, window time.Duration, minCount int64) ([]models.RetryBurst, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			normalized_query_hash,
+			normalizeQuery(any(query)) as normalized_query,
+			user,
+			toStartOfInterval(event_time, INTERVAL ? SECOND) as window_start,
+			min(event_time) as first_seen,
+			max(event_time) as last_seen,
+			COUNT(*) as executions,
 			SUM(CASE WHEN exception_code != 0 OR type = 'ExceptionBeforeStart' THEN 1 ELSE 0 END) as failed_queries
-		FROM system.query_log
-	`, bucketInterval)
+		FROM %s
+		%s
+		GROUP BY normalized_query_hash, user, window_start
+		HAVING executions >= ?
+		ORDER BY executions DESC, window_start DESC
+		LIMIT ?
+	`, r.queryLogTable(filter.Shard), where)
+
+	// The window placeholder precedes the WHERE placeholders in the query text
+	seconds := int64(window / time.Second)
+	args = append([]interface{}{seconds}, args...)
+	args = append(args, minCount, limit)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	var conditions []string
-	var args []interface{}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retry bursts: %w", err)
+	}
+	defer rows.Close()
 
-	// Always exclude QueryStart entries - we only want completed queries
-	conditions = append(conditions, "type != 'QueryStart'")
+	bursts := make([]models.RetryBurst, 0)
+	for rows.Next() {
+		var (
+			burst models.RetryBurst
+			hash  uint64
+		)
+		err := rows.Scan(
+			&hash,
+			&burst.NormalizedQuery,
+			&burst.User,
+			&burst.WindowStart,
+			&burst.FirstSeen,
+			&burst.LastSeen,
+			&burst.Executions,
+			&burst.FailedQueries,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan retry burst row: %w", err)
+		}
+		burst.NormalizedQueryHash = strconv.FormatUint(hash, 10)
+		burst.WindowEnd = burst.WindowStart.Add(time.Duration(seconds) * time.Second)
+		bursts = append(bursts, burst)
+	}
 
-	// Apply the same filters as regular queries
-	if filter.DBName != "" {
-		conditions = append(conditions, "has(databases, ?)")
-		args = append(args, filter.DBName)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retry burst rows: %w", err)
 	}
 
-	if filter.OnlyFailed {
-		conditions = append(conditions, "(exception_code != 0 OR type = 'ExceptionBeforeStart')")
+	return bursts, nil
+}
+
+// GetPatternTrend retrieves time-bucketed duration and read statistics for the
+// executions of a single normalized query, identified by normalized_query_hash.
+func (r *QueryLogRepository) GetPatternTrend(ctx context.Context, filter models.QueryLogFilter, hash uint64) ([]models.PatternTrendPoint, BucketSize, error) {
+	bucket := r.chooseBucket(filter)
+
+	conditions, args := r.scopedConditions(filter)
+	conditions = append(conditions, "normalized_query_hash = ?")
+	args = append(args, hash)
+
+	// Note: bucket.Interval is a controlled value from bucketSizes, not user input
+	query := fmt.Sprintf(`
+		SELECT
+			toStartOfInterval(event_time, INTERVAL %s) as time_bucket,
+			COUNT(*) as executions,
+			AVG(query_duration_ms) as avg_duration_ms,
+			quantile(0.95)(query_duration_ms) as p95_duration_ms,
+			AVG(read_bytes) as avg_read_bytes,
+			quantile(0.95)(read_bytes) as p95_read_bytes
+		FROM %s
+		WHERE %s
+		GROUP BY time_bucket
+		ORDER BY time_bucket ASC
+	`, bucket.Interval, r.queryLogTable(filter.Shard), strings.Join(conditions, " AND "))
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, bucket, err
 	}
+	defer release()
 
-	if filter.OnlySuccess {
-		conditions = append(conditions, "(type = 'QueryFinish' AND exception_code = 0)")
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, bucket, fmt.Errorf("failed to query pattern trend: %w", err)
 	}
+	defer rows.Close()
 
-	if filter.MinDurationMs > 0 {
-		conditions = append(conditions, "query_duration_ms > ?")
-		args = append(args, filter.MinDurationMs)
+	points := make([]models.PatternTrendPoint, 0)
+	for rows.Next() {
+		var p models.PatternTrendPoint
+		err := rows.Scan(
+			&p.TimeBucket,
+			&p.Executions,
+			&p.AvgDurationMs,
+			&p.P95DurationMs,
+			&p.AvgReadBytes,
+			&p.P95ReadBytes,
+		)
+		if err != nil {
+			return nil, bucket, fmt.Errorf("failed to scan pattern trend row: %w", err)
+		}
+		points = append(points, p)
 	}
 
-	if filter.User != "" {
-		conditions = append(conditions, "user = ?")
-		args = append(args, filter.User)
+	if err := rows.Err(); err != nil {
+		return nil, bucket, fmt.Errorf("error iterating pattern trend rows: %w", err)
 	}
 
-	if filter.QueryContains != "" {
-		conditions = append(conditions, "positionCaseInsensitive(query, ?) > 0")
-		args = append(args, filter.QueryContains)
+	return points, bucket, nil
+}
+
+// GetPatternTreemap retrieves the topN normalized query patterns by total
+// duration within each query_kind, together with each kind's totals across
+// all of its patterns. Rows are ordered by kind, then duration descending.
+func (r *QueryLogRepository) GetPatternTreemap(ctx context.Context, filter models.QueryLogFilter, topN int) ([]models.TreemapPattern, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	// Kind totals are window aggregates, so they include the patterns cut by LIMIT BY
+	query := fmt.Sprintf(`
+		SELECT
+			query_kind,
+			normalized_query_hash,
+			normalizeQuery(any(query)) as normalized_query,
+			count() as executions,
+			sum(query_duration_ms) as duration_ms,
+			sum(count()) OVER (PARTITION BY query_kind) as kind_executions,
+			sum(sum(query_duration_ms)) OVER (PARTITION BY query_kind) as kind_duration_ms
+		FROM %s
+		WHERE %s
+		GROUP BY query_kind, normalized_query_hash
+		ORDER BY query_kind ASC, duration_ms DESC
+		LIMIT ? BY query_kind
+	`, r.queryLogTable(filter.Shard), strings.Join(conditions, " AND "))
+	args = append(args, topN)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	if filter.StartTime != nil {
-		conditions = append(conditions, "event_time >= ?")
-		args = append(args, *filter.StartTime)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pattern treemap: %w", err)
 	}
+	defer rows.Close()
 
-	if filter.EndTime != nil {
-		conditions = append(conditions, "event_time <= ?")
-		args = append(args, *filter.EndTime)
+	patterns := make([]models.TreemapPattern, 0)
+	for rows.Next() {
+		var p models.TreemapPattern
+		err := rows.Scan(
+			&p.QueryKind,
+			&p.NormalizedQueryHash,
+			&p.NormalizedQuery,
+			&p.Executions,
+			&p.DurationMs,
+			&p.KindExecutions,
+			&p.KindDurationMs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pattern treemap row: %w", err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pattern treemap rows: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// GetGroupedStats retrieves aggregated metrics grouped by the given dimension.
+// Returns an error for a dimension not in models.ValidGroupByDimensions; an
+// invalid sort column falls back to total_queries (see orderByClause).
+func (r *QueryLogRepository) GetGroupedStats(ctx context.Context, filter models.QueryLogFilter, params models.GroupByParams) ([]models.QueryLogGroupStats, error) {
+	if err := validateDimension(params.Dimension); err != nil {
+		return nil, err
+	}
+	if params.Dimension == "exception_code" {
+		if err := r.resolveErrorNames(ctx); err != nil {
+			return nil, err
+		}
+	}
+	query, args := r.buildGroupByQuery(filter, params)
+
+	result, err := r.coalesce(ctx, query, args, func(ctx context.Context) (interface{}, error) {
+		return r.queryGroupedStats(ctx, query, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := slices.Clone(result.([]models.QueryLogGroupStats))
+	if params.Dimension == "exception_code" && r.errorNamesInGo() {
+		for i := range stats {
+			code, _ := strconv.ParseInt(stats[i].Key, 10, 32)
+			stats[i].ErrorName = models.ErrorCodeName(int32(code))
+		}
+	}
+	return stats, nil
+}
+
+// queryGroupedStats runs a group-by query built by buildGroupByQuery.
+func (r *QueryLogRepository) queryGroupedStats(ctx context.Context, query string, args []interface{}) ([]models.QueryLogGroupStats, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grouped stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]models.QueryLogGroupStats, 0)
+	for rows.Next() {
+		var s models.QueryLogGroupStats
+		err := rows.Scan(
+			&s.Key,
+			&s.TotalQueries,
+			&s.AvgDurationMs,
+			&s.MaxDurationMs,
+			&s.TotalReadBytes,
+			&s.TotalWrittenBytes,
+			&s.FailedQueries,
+			&s.ErrorRate,
+			&s.ErrorName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan grouped stats row: %w", err)
+		}
+		stats = append(stats, s)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating grouped stats rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// buildGroupByQuery constructs the SQL query for aggregating by a single
+// dimension. The dimension is interpolated into the SQL, so callers must check
+// it with validateDimension first.
+func (r *QueryLogRepository) buildGroupByQuery(filter models.QueryLogFilter, params models.GroupByParams) (string, []interface{}) {
+	baseQuery := fmt.Sprintf(`
+		SELECT
+			toString(%s) as group_key,
+			COUNT(*) as total_queries,
+			AVG(query_duration_ms) as avg_duration_ms,
+			MAX(query_duration_ms) as max_duration_ms,
+			SUM(read_bytes) as total_read_bytes,
+			SUM(written_bytes) as total_written_bytes,
+			SUM(CASE WHEN exception_code != 0 OR type = 'ExceptionBeforeStart' THEN 1 ELSE 0 END) as failed_queries,
+			failed_queries / total_queries as error_rate,
+			%s as error_name
+		FROM %s
+	`, params.Dimension, r.groupErrorName(params.Dimension), r.queryLogTable(filter.Shard))
+
+	conditions, args := r.scopedConditions(filter)
+
 	var queryBuilder strings.Builder
 	queryBuilder.WriteString(baseQuery)
 
@@ -698,7 +2322,105 @@ func (r *QueryLogRepository) buildAggregationQuery(filter models.QueryLogFilter,
 		queryBuilder.WriteString(strings.Join(conditions, " AND "))
 	}
 
-	queryBuilder.WriteString(" GROUP BY time_bucket ORDER BY time_bucket ASC")
+	queryBuilder.WriteString(" GROUP BY group_key")
+
+	queryBuilder.WriteString(orderByClause(filter, "total_queries", models.ValidGroupBySortColumns))
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	queryBuilder.WriteString(" LIMIT ?")
+	args = append(args, limit)
 
 	return queryBuilder.String(), args
 }
+
+// validateDimension checks a group-by dimension against
+// models.ValidGroupByDimensions. Handlers reject other values with a 400, but
+// the dashboard and report call GetGroupedStats directly, so the repository
+// checks again before interpolating it into SQL.
+func validateDimension(dimension string) error {
+	if !models.ValidGroupByDimensions[dimension] {
+		return fmt.Errorf("invalid group-by dimension: %q", dimension)
+	}
+	return nil
+}
+
+// groupErrorName returns the error_name expression for a group-by query: the
+// error name of the group when grouping by exception_code, otherwise an empty
+// string. Without errorCodeToName GetGroupedStats fills the name in instead.
+func (r *QueryLogRepository) groupErrorName(dimension string) string {
+	if dimension == "exception_code" && !r.errorNamesInGo() {
+		return "any(" + models.ErrorNameExpr + ")"
+	}
+	return "''"
+}
+
+// GetUserShares retrieves each user's share of total duration, memory and read bytes.
+// Totals across all users are computed with window aggregates in the same query,
+// so shares are consistent with the per-user sums. Results are ordered by duration share.
+func (r *QueryLogRepository) GetUserShares(ctx context.Context, filter models.QueryLogFilter) ([]models.UserShare, error) {
+	conditions, args := r.scopedConditions(filter)
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(`
+		SELECT
+			user,
+			COUNT(*) as total_queries,
+			SUM(query_duration_ms) as total_duration_ms,
+			SUM(memory_usage) as total_memory_usage,
+			SUM(read_bytes) as total_read_bytes,
+			if(SUM(total_duration_ms) OVER () > 0, total_duration_ms / SUM(total_duration_ms) OVER () * 100, 0) as duration_share,
+			if(SUM(total_memory_usage) OVER () > 0, total_memory_usage / SUM(total_memory_usage) OVER () * 100, 0) as memory_share,
+			if(SUM(total_read_bytes) OVER () > 0, total_read_bytes / SUM(total_read_bytes) OVER () * 100, 0) as read_bytes_share
+		FROM `)
+	queryBuilder.WriteString(r.queryLogTable(filter.Shard))
+
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" WHERE ")
+		queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	queryBuilder.WriteString(" GROUP BY user ORDER BY duration_share DESC")
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, queryBuilder.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := make([]models.UserShare, 0)
+	for rows.Next() {
+		var s models.UserShare
+		err := rows.Scan(
+			&s.User,
+			&s.TotalQueries,
+			&s.TotalDurationMs,
+			&s.TotalMemoryUsage,
+			&s.TotalReadBytes,
+			&s.DurationShare,
+			&s.MemoryShare,
+			&s.ReadBytesShare,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user share row: %w", err)
+		}
+		shares = append(shares, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user share rows: %w", err)
+	}
+
+	return shares, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// QueryLogStore reads query_log data for the handlers and the scheduled report.
+// QueryLogRepository implements it against ClickHouse; DemoRepository serves
+// synthetic data for DEMO_MODE. Handlers depend only on this interface, so
+// they can be exercised with any in-memory implementation.
+type QueryLogStore interface {
+	// HasColumn reports whether system.query_log has the named column.
+	HasColumn(ctx context.Context, name string) (bool, error)
+
+	// AllowedDatabase reports whether name may be exposed by this deployment.
+	AllowedDatabase(name string) bool
+
+	// ValidShard reports whether shard may be used as the shard filter.
+	ValidShard(shard string) bool
+
+	GetQueryLogs(ctx context.Context, filter models.QueryLogFilter) ([]models.QueryLog, error)
+	GetQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string) ([]map[string]interface{}, error)
+
+	// StreamQueryLogsDynamic calls fn with each matching row, keyed by column,
+	// without holding the whole result in memory.
+	StreamQueryLogsDynamic(ctx context.Context, filter models.QueryLogFilter, columns []string, fn func(row map[string]interface{}) error) error
+
+	CountQueryLogs(ctx context.Context, filter models.QueryLogFilter) (uint64, error)
+	GetScanEfficiency(ctx context.Context, filter models.QueryLogFilter) (*models.ScanEfficiency, error)
+	GetCoverage(ctx context.Context) (*models.QueryLogCoverage, error)
+	GetDatabases(ctx context.Context) ([]string, error)
+
+	// GetQueryLogByID returns the most recent row for queryID, or an error
+	// wrapping sql.ErrNoRows when there is none.
+	GetQueryLogByID(ctx context.Context, queryID string) (*models.QueryLog, error)
+
+	// GetProfileEvents returns the ProfileEvents counters of the most recent
+	// row for queryID, or an error wrapping sql.ErrNoRows when there is none.
+	GetProfileEvents(ctx context.Context, queryID string) (map[string]uint64, error)
+
+	// FormatQuery pretty-prints SQL text; callers fall back to the raw text on error.
+	FormatQuery(ctx context.Context, query string) (string, error)
+
+	// GetQueryThreads returns the query_thread_log rows of queryID, logged on
+	// or after since, or an error wrapping ErrLogNotEnabled.
+	GetQueryThreads(ctx context.Context, queryID string, since time.Time) ([]models.QueryThread, error)
+
+	// ExplainQuery returns the EXPLAIN output of a query that passes
+	// CheckExplainable.
+	ExplainQuery(ctx context.Context, query string) ([]string, error)
+
+	GetAggregatedMetrics(ctx context.Context, filter models.QueryLogFilter, opts MetricsOptions) ([]models.QueryLogMetrics, MetricsPlan, error)
+	GetInsertStats(ctx context.Context, filter models.QueryLogFilter) ([]models.InsertStats, BucketSize, error)
+	GetSessions(ctx context.Context, filter models.QueryLogFilter, gap time.Duration) ([]models.QuerySession, error)
+	GetRetryBursts(ctx context.Context, filter models.QueryLogFilter, window time.Duration, minCount int64) ([]models.RetryBurst, error)
+	GetPatternTrend(ctx context.Context, filter models.QueryLogFilter, hash uint64) ([]models.PatternTrendPoint, BucketSize, error)
+	GetPatternTreemap(ctx context.Context, filter models.QueryLogFilter, topN int) ([]models.TreemapPattern, error)
+	GetGroupedStats(ctx context.Context, filter models.QueryLogFilter, params models.GroupByParams) ([]models.QueryLogGroupStats, error)
+	GetUserShares(ctx context.Context, filter models.QueryLogFilter) ([]models.UserShare, error)
+	GetQueryViews(ctx context.Context, filter models.QueryViewFilter) ([]models.QueryViewLog, error)
+	GetAsyncInserts(ctx context.Context, filter models.AsyncInsertFilter) ([]models.AsyncInsertLog, error)
+}
+
+// Both implementations must keep satisfying the interface the handlers use.
+var (
+	_ QueryLogStore = (*QueryLogRepository)(nil)
+	_ QueryLogStore = (*DemoRepository)(nil)
+)
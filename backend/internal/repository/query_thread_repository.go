@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// maxQueryThreads caps the threads returned for one query
+const maxQueryThreads = 1000
+
+// GetQueryThreads retrieves the per-thread rows of queryID from
+// system.query_thread_log, longest running first. since is the query's
+// event_time, used to skip older partitions. Returns ErrLogNotEnabled when the
+// server doesn't have the table.
+//
+// query_thread_log has no databases column, so callers must check the query
+// is within AllowedDatabases (e.g. with GetQueryLogByID) first.
+func (r *QueryLogRepository) GetQueryThreads(ctx context.Context, queryID string, since time.Time) ([]models.QueryThread, error) {
+	query := `
+		SELECT
+			thread_name,
+			thread_id,
+			master_thread_id,
+			query_duration_ms,
+			read_rows,
+			read_bytes,
+			written_rows,
+			written_bytes,
+			memory_usage,
+			peak_memory_usage
+		FROM system.query_thread_log
+		WHERE event_date >= toDate(?, timezone()) AND query_id = ?
+		ORDER BY query_duration_ms DESC, thread_id
+		LIMIT ?
+	`
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, since, queryID, maxQueryThreads)
+	if err != nil {
+		if database.IsUnknownTable(err) {
+			return nil, fmt.Errorf("query_thread_log: %w", ErrLogNotEnabled)
+		}
+		return nil, fmt.Errorf("failed to query query threads: %w", err)
+	}
+	defer rows.Close()
+
+	threads := make([]models.QueryThread, 0)
+	for rows.Next() {
+		var t models.QueryThread
+		err := rows.Scan(
+			&t.ThreadName,
+			&t.ThreadID,
+			&t.MasterThreadID,
+			&t.QueryDurationMs,
+			&t.ReadRows,
+			&t.ReadBytes,
+			&t.WrittenRows,
+			&t.WrittenBytes,
+			&t.MemoryUsage,
+			&t.PeakMemoryUsage,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan query thread row: %w", err)
+		}
+		threads = append(threads, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating query thread rows: %w", err)
+	}
+
+	return threads, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// GetQueryViews retrieves view executions from system.query_views_log, newest
+// first. These methods live on QueryLogRepository so view queries share its
+// concurrency limit. With IncludeQuery, the triggering INSERT's text is joined
+// from system.query_log over the same time range.
+func (r *QueryLogRepository) GetQueryViews(ctx context.Context, filter models.QueryViewFilter) ([]models.QueryViewLog, error) {
+	query, args := r.buildQueryViewsQuery(filter)
+
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query view executions: %w", err)
+	}
+	defer rows.Close()
+
+	views := make([]models.QueryViewLog, 0)
+	for rows.Next() {
+		var v models.QueryViewLog
+		err := rows.Scan(
+			&v.EventTime,
+			&v.InitialQueryID,
+			&v.ViewName,
+			&v.ViewType,
+			&v.ViewTarget,
+			&v.ViewDurationMs,
+			&v.ReadRows,
+			&v.ReadBytes,
+			&v.WrittenRows,
+			&v.WrittenBytes,
+			&v.PeakMemoryUsage,
+			&v.Status,
+			&v.ExceptionCode,
+			&v.Exception,
+			&v.TriggeringQuery,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan view execution row: %w", err)
+		}
+		views = append(views, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating view execution rows: %w", err)
+	}
+
+	return views, nil
+}
+
+// buildQueryViewsQuery constructs the SQL query for view executions.
+func (r *QueryLogRepository) buildQueryViewsQuery(filter models.QueryViewFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	// Time range conditions, shared by the view log and the joined query_log
+	var timeConditions []string
+	var timeArgs []interface{}
+	if filter.StartTime != nil {
+		timeConditions = append(timeConditions, "event_date >= toDate(?, timezone())", "event_time >= ?")
+		timeArgs = append(timeArgs, *filter.StartTime, *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		timeConditions = append(timeConditions, "event_date <= toDate(?, timezone())", "event_time <= ?")
+		timeArgs = append(timeArgs, *filter.EndTime, *filter.EndTime)
+	}
+
+	triggeringQuery := "''"
+	join := ""
+	if filter.IncludeQuery {
+		triggeringQuery = "ifNull(q.query, '')"
+
+		joinConditions := append([]string{"type != 'QueryStart'"}, timeConditions...)
+		joinArgs := timeArgs
+		if len(r.opts.AllowedDatabases) > 0 {
+			// Only show the text of triggering queries within the allowed databases
+			joinConditions = append(joinConditions, "hasAny(databases, ?)")
+			joinArgs = append(slices.Clone(timeArgs), r.opts.AllowedDatabases)
+		}
+		join = fmt.Sprintf(`
+		LEFT JOIN (
+			SELECT query_id, any(query) AS query
+			FROM system.query_log
+			WHERE %s
+			GROUP BY query_id
+		) AS q ON q.query_id = v.initial_query_id`, strings.Join(joinConditions, " AND "))
+		args = append(args, joinArgs...)
+	}
+
+	for _, cond := range timeConditions {
+		conditions = append(conditions, "v."+cond)
+	}
+	args = append(args, timeArgs...)
+
+	if filter.QueryID != "" {
+		conditions = append(conditions, "v.initial_query_id = ?")
+		args = append(args, filter.QueryID)
+	}
+
+	if filter.ViewName != "" {
+		conditions = append(conditions, "v.view_name = ?")
+		args = append(args, filter.ViewName)
+	}
+
+	if filter.OnlyFailed {
+		conditions = append(conditions, "(v.exception_code != 0 OR v.status != 'QueryFinish')")
+	}
+
+	if filter.MinDurationMs > 0 {
+		conditions = append(conditions, "v.view_duration_ms >= ?")
+		args = append(args, filter.MinDurationMs)
+	}
+
+	// View names are database-qualified, so ALLOWED_DATABASES applies to the prefix
+	if len(r.opts.AllowedDatabases) > 0 {
+		conditions = append(conditions, "has(?, splitByChar('.', v.view_name)[1])")
+		args = append(args, r.opts.AllowedDatabases)
+	}
+
+	// Always exclude QueryStart entries, like the query_log listings
+	conditions = append(conditions, "v.status != 'QueryStart'")
+
+	var queryBuilder strings.Builder
+	fmt.Fprintf(&queryBuilder, `
+		SELECT
+			v.event_time,
+			v.initial_query_id,
+			v.view_name,
+			toString(v.view_type),
+			v.view_target,
+			v.view_duration_ms,
+			v.read_rows,
+			v.read_bytes,
+			v.written_rows,
+			v.written_bytes,
+			v.peak_memory_usage,
+			toString(v.status),
+			v.exception_code,
+			v.exception,
+			%s
+		FROM system.query_views_log AS v%s
+		WHERE `, triggeringQuery, join)
+	queryBuilder.WriteString(strings.Join(conditions, " AND "))
+	queryBuilder.WriteString(" ORDER BY v.event_time DESC, v.event_time_microseconds DESC, v.view_name")
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	queryBuilder.WriteString(" LIMIT ? OFFSET ?")
+	args = append(args, limit, filter.Offset)
+
+	return queryBuilder.String(), args
+}
@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// recentPollTimeout bounds a single refresh of the recent logs buffer.
+const recentPollTimeout = 30 * time.Second
+
+// recentEntry is a buffered query_log row.
+type recentEntry struct {
+	log        models.QueryLog
+	peakMemory int64
+}
+
+// recentBuffer keeps the most recent window of query_log in memory, refreshed
+// by a background poller, so that busy dashboards polling short ranges don't
+// each scan system.query_log.
+//
+// Every refresh re-reads the whole window rather than only rows newer than the
+// last poll: query_log is flushed in batches, so rows often arrive with event
+// times older than rows already seen.
+//
+// Only requests whose filter is a plain time range (plus pagination and tz)
+// that lies within the buffered window are served from it; anything else goes
+// to ClickHouse. A nil *recentBuffer is disabled and serves nothing.
+type recentBuffer struct {
+	repo       *QueryLogRepository
+	window     time.Duration
+	interval   time.Duration
+	maxEntries int
+
+	mu sync.RWMutex
+	// entries are ordered newest first, like the default list order
+	entries []recentEntry
+	// from is the oldest event time the buffer is complete for
+	from time.Time
+	// refreshedAt is when entries were last loaded
+	refreshedAt time.Time
+}
+
+// newRecentBuffer starts a poller for r and returns its buffer, or nil when
+// the buffer is disabled (RecentWindow <= 0). The poller runs for the lifetime
+// of the process.
+func newRecentBuffer(r *QueryLogRepository) *recentBuffer {
+	if r.opts.RecentWindow <= 0 || r.opts.RecentInterval <= 0 || r.opts.RecentMaxEntries <= 0 {
+		return nil
+	}
+
+	b := &recentBuffer{
+		repo:       r,
+		window:     r.opts.RecentWindow,
+		interval:   r.opts.RecentInterval,
+		maxEntries: r.opts.RecentMaxEntries,
+	}
+	go b.run()
+	return b
+}
+
+// run refreshes the buffer every interval. Failed refreshes keep the previous
+// contents, which stop being served once they are too stale.
+func (b *recentBuffer) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.refresh(); err != nil {
+			log.Printf("recent logs buffer refresh failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// refresh reloads the buffered window from ClickHouse.
+func (b *recentBuffer) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), recentPollTimeout)
+	defer cancel()
+
+	// Checked before acquiring a slot, since loading the column list and
+	// checking for errorCodeToName may need one
+	hasPeakMemory, err := b.repo.HasColumn(ctx, "peak_memory_usage")
+	if err != nil {
+		return err
+	}
+	if err := b.repo.resolveErrorNames(ctx); err != nil {
+		return err
+	}
+	peakMemory := "toInt64(0)"
+	if hasPeakMemory {
+		peakMemory = "peak_memory_usage"
+	}
+
+	now := time.Now()
+	start := now.Add(-b.window)
+	conditions, args := b.repo.scopedConditions(models.QueryLogFilter{StartTime: &start})
+
+	query := fmt.Sprintf("SELECT %s, %s FROM system.query_log WHERE %s"+
+		" ORDER BY event_time DESC, event_time_microseconds DESC, query_id DESC LIMIT ?",
+		b.repo.queryLogSelectColumns(), peakMemory, strings.Join(conditions, " AND "))
+	args = append(args, b.maxEntries)
+
+	release, err := b.repo.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rows, err := b.repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query recent query_log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]recentEntry, 0, len(b.entries))
+	for rows.Next() {
+		var e recentEntry
+		if err := b.repo.scanQueryLog(rows, &e.log, &e.peakMemory); err != nil {
+			return fmt.Errorf("failed to scan recent query_log row: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating recent query_log rows: %w", err)
+	}
+
+	// When the row cap was hit, only the seconds after the oldest row are complete
+	from := start
+	if len(entries) >= b.maxEntries {
+		from = entries[len(entries)-1].log.EventTime.Add(time.Second)
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.from = from
+	b.refreshedAt = now
+	b.mu.Unlock()
+	return nil
+}
+
+// covers reports whether filter can be answered from the buffer: it must have
+// no conditions other than a time range within the buffered window, and the
+// buffer must have been refreshed recently. Callers must hold b.mu.
+func (b *recentBuffer) covers(filter models.QueryLogFilter) bool {
+	if b.refreshedAt.IsZero() || time.Since(b.refreshedAt) > 2*b.interval {
+		return false
+	}
+	if filter.StartTime == nil || filter.StartTime.Before(b.from) {
+		return false
+	}
+
+	// Default ordering only (newest first)
+	if (filter.SortBy != "" && filter.SortBy != "event_time") || (filter.SortOrder != "" && filter.SortOrder != "desc") {
+		return false
+	}
+
+	// Everything except the time range, pagination and output options must be unset
+	rest := filter
+	rest.StartTime, rest.EndTime = nil, nil
+	rest.Limit, rest.Offset = 0, 0
+	rest.TZ = ""
+	rest.SortBy, rest.SortOrder = "", ""
+	return reflect.DeepEqual(rest, models.QueryLogFilter{})
+}
+
+// inRange returns the buffered entries within filter's time range, newest first.
+// Callers must hold b.mu.
+func (b *recentBuffer) inRange(filter models.QueryLogFilter) []recentEntry {
+	start := filter.StartTime.Truncate(time.Second)
+
+	var matched []recentEntry
+	for _, e := range b.entries {
+		if e.log.EventTime.Before(start) {
+			break
+		}
+		if filter.EndTime != nil && e.log.EventTime.After(*filter.EndTime) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return matched
+}
+
+// queryLogs serves a GetQueryLogs request from the buffer. ok is false when
+// the request must go to ClickHouse.
+func (b *recentBuffer) queryLogs(filter models.QueryLogFilter) (logs []models.QueryLog, ok bool) {
+	if b == nil {
+		return nil, false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.covers(filter) {
+		return nil, false
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	matched := b.inRange(filter)
+	logs = make([]models.QueryLog, 0)
+	for i := filter.Offset; i < len(matched) && len(logs) < limit; i++ {
+		logs = append(logs, matched[i].log)
+	}
+	return logs, true
+}
+
+// metrics serves a GetAggregatedMetrics request from the buffer using bucket.
+// Buckets are aligned by truncating Unix time, which matches ClickHouse's
+// toStartOfInterval for sub-hour buckets, so longer buckets are not served.
+func (b *recentBuffer) metrics(filter models.QueryLogFilter, bucket BucketSize, clampMemory bool) (metrics []models.QueryLogMetrics, ok bool) {
+	if b == nil || bucket.Duration >= time.Hour {
+		return nil, false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.covers(filter) {
+		return nil, false
+	}
+	return bucketMetrics(b.inRange(filter), bucket, clampMemory, nil), true
+}
+
+// bucketMetrics aggregates entries into bucket-sized metrics rows, oldest
+// first, the way the aggregated metrics query does in SQL. With clampMemory,
+// negative memory usage counts as 0. Buckets are aligned to origin when it is
+// set (see MetricsPlan.Origin).
+func bucketMetrics(entries []recentEntry, bucket BucketSize, clampMemory bool, origin *time.Time) []models.QueryLogMetrics {
+	byBucket := make(map[time.Time]*models.QueryLogMetrics)
+	totalDuration := make(map[time.Time]uint64)
+	totalMemory := make(map[time.Time]int64)
+	for _, e := range entries {
+		key := e.log.EventTime.Truncate(bucket.Duration)
+		if origin != nil {
+			key = origin.Add(e.log.EventTime.Sub(*origin).Truncate(bucket.Duration))
+		}
+		m, exists := byBucket[key]
+		if !exists {
+			m = &models.QueryLogMetrics{TimeBucket: key}
+			byBucket[key] = m
+		}
+
+		memory := e.log.MemoryUsage
+		if clampMemory {
+			memory = max(memory, 0)
+		}
+
+		m.TotalQueries++
+		totalDuration[key] += e.log.QueryDurationMs
+		totalMemory[key] += memory
+		m.MaxDurationMs = max(m.MaxDurationMs, e.log.QueryDurationMs)
+		m.MaxMemoryUsage = max(m.MaxMemoryUsage, memory)
+		m.MaxPeakMemoryUsage = max(m.MaxPeakMemoryUsage, e.peakMemory)
+		m.TotalReadBytes += e.log.ReadBytes
+		m.TotalWrittenBytes += e.log.WrittenBytes
+		if e.log.ExceptionCode != 0 || e.log.Type == "ExceptionBeforeStart" {
+			m.FailedQueries++
+		}
+	}
+
+	metrics := make([]models.QueryLogMetrics, 0, len(byBucket))
+	for key, m := range byBucket {
+		m.AvgDurationMs = float64(totalDuration[key]) / float64(m.TotalQueries)
+		m.AvgMemoryUsage = float64(totalMemory[key]) / float64(m.TotalQueries)
+		m.ErrorRate = float64(m.FailedQueries) / float64(m.TotalQueries)
+		metrics = append(metrics, *m)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].TimeBucket.Before(metrics[j].TimeBucket) })
+	return metrics
+}
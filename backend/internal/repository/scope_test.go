@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// TestAllowedDatabasesScope checks that every query_log read built from a
+// filter is restricted to AllowedDatabases, including the coverage totals and
+// the query text joined into view executions.
+func TestAllowedDatabasesScope(t *testing.T) {
+	allowed := []string{"analytics", "billing"}
+	scoped := NewQueryLogRepository(nil, Options{AllowedDatabases: allowed})
+	unscoped := NewQueryLogRepository(nil, Options{})
+
+	builders := map[string]func(r *QueryLogRepository) (string, []interface{}){
+		"list": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildQueryLogsQuery(models.QueryLogFilter{})
+		},
+		"dynamic": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildDynamicQuery(models.QueryLogFilter{}, []string{"query_id"})
+		},
+		"group by": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildGroupByQuery(models.QueryLogFilter{}, models.GroupByParams{Dimension: "user"})
+		},
+		"metrics": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildAggregationQuery(models.QueryLogFilter{}, MetricsPlan{Bucket: determineBucketSize(nil, nil), SampleRatio: 1})
+		},
+		"coverage": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildCoverageQuery()
+		},
+		"views with query text": func(r *QueryLogRepository) (string, []interface{}) {
+			return r.buildQueryViewsQuery(models.QueryViewFilter{IncludeQuery: true})
+		},
+	}
+
+	for name, build := range builders {
+		t.Run(name, func(t *testing.T) {
+			query, args := build(scoped)
+			if !strings.Contains(query, "hasAny(databases, ?)") {
+				t.Errorf("scoped query lacks the AllowedDatabases condition: %s", query)
+			}
+			if strings.Count(query, "?") != len(args) {
+				t.Errorf("query has %d placeholders but %d args: %s", strings.Count(query, "?"), len(args), query)
+			}
+			found := false
+			for _, arg := range args {
+				if reflect.DeepEqual(arg, allowed) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("args %v do not include the allowed databases", args)
+			}
+
+			if query, _ := build(unscoped); strings.Contains(query, "hasAny(databases, ?)") {
+				t.Errorf("unscoped query has the AllowedDatabases condition: %s", query)
+			}
+		})
+	}
+}
+
+func TestCoverageSizeHiddenWhenScoped(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		wantSize bool
+	}{
+		{name: "unrestricted", wantSize: true},
+		{name: "restricted", allowed: []string{"analytics"}, wantSize: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewQueryLogRepository(nil, Options{AllowedDatabases: tt.allowed})
+			query, _ := r.buildCoverageQuery()
+			if got := strings.Contains(query, "system.parts"); got != tt.wantSize {
+				t.Errorf("coverage query reads the table size = %v, want %v: %s", got, tt.wantSize, query)
+			}
+		})
+	}
+}
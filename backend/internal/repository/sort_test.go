@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actio/clickhouse-monitoring/internal/models"
+)
+
+// injectionAttempts are sort_by values that must never reach ORDER BY.
+var injectionAttempts = []string{
+	"1;DROP TABLE system.query_log",
+	"event_time; DROP TABLE x",
+	"event_time DESC, (SELECT 1)",
+	"sleep(3)",
+	"query_duration_ms--",
+	"EVENT_TIME",
+	"query",
+}
+
+func TestValidateSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortBy    string
+		sortOrder string
+		wantErr   bool
+	}{
+		{name: "defaults", sortBy: "", sortOrder: ""},
+		{name: "allowed column", sortBy: "query_duration_ms", sortOrder: "asc"},
+		{name: "order is case-insensitive", sortBy: "event_time", sortOrder: "DESC"},
+		{name: "invalid order", sortBy: "event_time", sortOrder: "desc; DROP TABLE x", wantErr: true},
+	}
+	for _, value := range injectionAttempts {
+		tests = append(tests, struct {
+			name      string
+			sortBy    string
+			sortOrder string
+			wantErr   bool
+		}{name: "rejects " + value, sortBy: value, wantErr: true})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSort(tt.sortBy, tt.sortOrder, models.ValidSortColumns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSort(%q, %q) error = %v, wantErr %v", tt.sortBy, tt.sortOrder, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestDynamicQueryOrderBy checks the repository's own allowlist check, which
+// keeps the export query safe even if a handler forgot ValidateSort.
+func TestDynamicQueryOrderBy(t *testing.T) {
+	r := NewQueryLogRepository(nil, Options{})
+	columns := []string{"query_id", "query"}
+
+	tests := []struct {
+		name      string
+		sortBy    string
+		sortOrder string
+		want      string
+	}{
+		{name: "default", want: " ORDER BY event_time DESC"},
+		{name: "allowed column", sortBy: "read_rows", sortOrder: "asc", want: " ORDER BY read_rows ASC"},
+	}
+	for _, value := range injectionAttempts {
+		tests = append(tests, struct {
+			name      string
+			sortBy    string
+			sortOrder string
+			want      string
+		}{name: "falls back for " + value, sortBy: value, sortOrder: "asc", want: " ORDER BY event_time ASC"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := r.buildDynamicQuery(models.QueryLogFilter{SortBy: tt.sortBy, SortOrder: tt.sortOrder}, columns)
+			if !strings.Contains(query, tt.want+",") {
+				t.Errorf("query = %q, want it to contain %q", query, tt.want)
+			}
+		})
+	}
+}
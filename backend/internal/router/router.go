@@ -4,50 +4,142 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
-	"github.com/actio/clickhouse-monitoring/internal/database"
+	"github.com/actio/clickhouse-monitoring/internal/config"
 	"github.com/actio/clickhouse-monitoring/internal/handlers"
+	"github.com/actio/clickhouse-monitoring/internal/middleware"
+	"github.com/actio/clickhouse-monitoring/internal/objectstore"
 	"github.com/actio/clickhouse-monitoring/internal/repository"
 )
 
 // Setup initializes the Gin router with all routes and middleware.
-func Setup(db *database.ClickHouseDB) *gin.Engine {
+// db is checked by the readiness endpoint. exportStore may be nil, which
+// disables the s3 export destination.
+func Setup(cfg *config.Config, db handlers.HealthChecker, queryLogRepo repository.QueryLogStore, annotationStore repository.AnnotationStore, exportStore *objectstore.S3) *gin.Engine {
 	// Create Gin router with default middleware (Logger, Recovery)
 	router := gin.Default()
 
+	// Return 405 with an Allow header (instead of 404) when the path exists
+	// but the method doesn't
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(handlers.MethodNotAllowed)
+
+	// Start a trace span per request (no-op unless OTEL_EXPORTER_OTLP_ENDPOINT is set)
+	router.Use(middleware.Tracing())
+
+	// Keep recent 5xx responses and panics for GET /admin/errors
+	errorLog := middleware.NewErrorLog(cfg.Admin.ErrorLogSize)
+	router.Use(middleware.RecordErrors(errorLog))
+
+	// Warn about requests slower than SLOW_REQUEST_MS end to end
+	router.Use(middleware.SlowRequests(cfg.API.SlowRequestThreshold))
+
+	// Record applied ClickHouse settings for ?include_meta=true
+	router.Use(middleware.IncludeMeta())
+
+	// Indent JSON responses when requested via ?pretty=true or DEBUG_PRETTY
+	router.Use(middleware.PrettyJSON(cfg.API.PrettyJSON))
+
 	// Configure CORS
+	// Allowed origins are read from the live config so they can be hot-reloaded
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://127.0.0.1:3000"},
+		AllowOriginFunc: func(origin string) bool {
+			for _, allowed := range cfg.Runtime.Load().CORSAllowedOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "If-None-Match", middleware.APIKeyHeader},
+		ExposeHeaders:    []string{"ETag", "Retry-After", "X-Quota-Limit", "X-Quota-Remaining"},
 		AllowCredentials: true,
 	}))
 
-	// Initialize repositories
-	queryLogRepo := repository.NewQueryLogRepository(db)
+	// API key quotas are read from the live config so they can be hot-reloaded
+	quotas := middleware.NewQuotas(cfg.Runtime)
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(db)
-	queryLogHandler := handlers.NewQueryLogHandler(queryLogRepo)
+	queryLogHandler := handlers.NewQueryLogHandler(queryLogRepo, annotationStore, cfg.API, exportStore)
+	annotationHandler := handlers.NewAnnotationHandler(annotationStore)
+	adminHandler := handlers.NewAdminHandler(cfg.Runtime, queryLogHandler, errorLog, quotas)
+	exportSignHandler := handlers.NewExportSignHandler(cfg.Export)
+	metricsHandler := handlers.NewMetricsHandler(db, quotas)
 
 	// Health check endpoints (outside API versioning)
-	router.GET("/health", healthHandler.Health)
-	router.GET("/ready", healthHandler.Ready)
+	getAndHead(router, "/health", healthHandler.Health)
+	getAndHead(router, "/ready", healthHandler.Ready)
+
+	// Prometheus metrics for the circuit breaker and API_KEY_QUOTAS; keys are masked
+	getAndHead(router, "/metrics", metricsHandler.Metrics)
+
+	// Admin endpoints (API key protected)
+	admin := router.Group("/admin", middleware.RequireAPIKey(cfg.Admin.APIKey))
+	{
+		admin.POST("/reload", adminHandler.Reload)
+		admin.POST("/cache/invalidate", adminHandler.InvalidateCache)
+		getAndHead(admin, "/errors", adminHandler.GetErrors)
+		getAndHead(admin, "/quotas", adminHandler.GetQuotas)
+	}
 
-	// API v1 routes
-	v1 := router.Group("/api/v1")
+	// API v1 routes, counted against API_KEY_QUOTAS. The admin key and signed
+	// export URLs pass unmetered.
+	v1 := router.Group("/api/v1", middleware.EnforceQuotas(quotas, cfg.Admin.APIKey, cfg.Export.SigningSecret))
 	{
 		// Query log endpoints
 		logs := v1.Group("/logs")
 		{
-			logs.GET("", queryLogHandler.GetQueryLogs)
-			logs.GET("/metrics", queryLogHandler.GetAggregatedMetrics)
-			logs.GET("/export", queryLogHandler.ExportCSV)
-			logs.GET("/:id", queryLogHandler.GetQueryLogByID)
+			getAndHead(logs, "", queryLogHandler.GetQueryLogs)
+			getAndHead(logs, "/count", queryLogHandler.CountQueryLogs)
+			getAndHead(logs, "/metrics", queryLogHandler.GetAggregatedMetrics)
+			// Exports are GET only: a HEAD request would still run the export
+			// and, with destination=s3, upload it
+			logs.GET("/metrics/export", queryLogHandler.ExportMetrics)
+			getAndHead(logs, "/group-by", queryLogHandler.GetGroupedStats)
+			getAndHead(logs, "/user-share", queryLogHandler.GetUserShares)
+			getAndHead(logs, "/coverage", queryLogHandler.GetCoverage)
+			getAndHead(logs, "/inserts", queryLogHandler.GetInsertStats)
+			getAndHead(logs, "/sessions", queryLogHandler.GetSessions)
+			getAndHead(logs, "/patterns/treemap", queryLogHandler.GetPatternTreemap)
+			getAndHead(logs, "/patterns/bursts", queryLogHandler.GetRetryBursts)
+			getAndHead(logs, "/patterns/:hash/trend", queryLogHandler.GetPatternTrend)
+			// Exports accept a signed URL instead of X-API-Key when EXPORT_SIGNING_SECRET is set
+			logs.GET("/export", middleware.RequireSignedURL(cfg.Export.SigningSecret, cfg.Admin.APIKey), queryLogHandler.ExportCSV)
+			logs.POST("/export/sign", middleware.RequireAPIKey(cfg.Admin.APIKey), exportSignHandler.SignExport)
+			getAndHead(logs, "/:id", queryLogHandler.GetQueryLogByID)
+			getAndHead(logs, "/:id/bundle", queryLogHandler.GetQueryBundle)
 		}
 
+		// Materialized view executions (system.query_views_log)
+		getAndHead(v1, "/views", queryLogHandler.GetQueryViews)
+
+		// Asynchronous inserts (system.asynchronous_insert_log)
+		getAndHead(v1, "/async-inserts", queryLogHandler.GetAsyncInserts)
+
+		// Batched dashboard panels
+		v1.POST("/dashboard", queryLogHandler.GetDashboard)
+
+		// Self-describing list of the query log filter parameters
+		getAndHead(v1, "/filters", handlers.GetFilters)
+
 		// Database endpoints
-		v1.GET("/databases", queryLogHandler.GetDatabases)
+		getAndHead(v1, "/databases", queryLogHandler.GetDatabases)
+
+		// Annotation endpoints
+		annotations := v1.Group("/annotations")
+		{
+			getAndHead(annotations, "", annotationHandler.ListAnnotations)
+			annotations.POST("", annotationHandler.CreateAnnotation)
+		}
 	}
 
 	return router
 }
+
+// getAndHead registers handlers for both GET and HEAD requests to path. Every
+// read endpoint answers HEAD, except the exports.
+func getAndHead(routes gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	routes.GET(path, handlers...)
+	routes.HEAD(path, handlers...)
+}
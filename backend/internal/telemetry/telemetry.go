@@ -0,0 +1,89 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/actio/clickhouse-monitoring/internal/config"
+)
+
+// TracerName is the instrumentation name used for spans created by this service.
+const TracerName = "github.com/actio/clickhouse-monitoring"
+
+// Setup installs the global OpenTelemetry tracer provider and W3C trace context
+// propagator. Spans are exported over OTLP/HTTP when cfg.OTLPEndpoint is set;
+// otherwise tracing stays a no-op. The returned function flushes and stops the
+// exporter and must be called on shutdown.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	// Always propagate trace context so incoming traceparent headers are honored
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// The exporter reads OTEL_EXPORTER_OTLP_ENDPOINT (and the other standard
+	// OTEL_EXPORTER_OTLP_* variables) itself, appending /v1/traces to the base URL
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for this service's spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// endpointKey is the context key holding the matched HTTP route.
+type endpointKey struct{}
+
+// WithEndpoint returns a copy of ctx that records the HTTP route being served,
+// so spans started further down (e.g. around queries) can be tagged with it.
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// Endpoint returns the HTTP route recorded by WithEndpoint, or "" if none.
+func Endpoint(ctx context.Context) string {
+	endpoint, _ := ctx.Value(endpointKey{}).(string)
+	return endpoint
+}
+
+// Traceparent returns the W3C traceparent for the span in ctx, or "" when
+// ctx carries no valid span context.
+func Traceparent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
@@ -136,7 +136,7 @@ export default function Dashboard() {
 
       setData(logsResponse.data || []);
       setMetricsData(metricsResponse.data || []);
-      setBucketSize(metricsResponse.bucket_size || '');
+      setBucketSize(metricsResponse.meta?.bucket_size || '');
       setLastUpdated(new Date());
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to fetch data');
@@ -28,10 +28,13 @@ export interface QueryLog {
 
 export interface QueryLogResponse {
   data: QueryLog[];
-  pagination: {
-    limit: number;
-    offset: number;
-    count: number;
+  meta: {
+    pagination: {
+      limit: number;
+      offset: number;
+      count: number;
+    };
+    columns?: string[];
   };
 }
 
@@ -118,8 +121,8 @@ export async function fetchDatabases(): Promise<string[]> {
     throw new Error(`API error: ${response.status} ${response.statusText}`);
   }
 
-  const data = await response.json();
-  return data.databases || [];
+  const body = await response.json();
+  return body.data || [];
 }
 
 export async function fetchHealthStatus(): Promise<{ status: string }> {
@@ -157,8 +160,10 @@ export interface QueryLogMetrics {
 
 export interface QueryLogMetricsResponse {
   data: QueryLogMetrics[];
-  bucket_size: string;
-  bucket_label: string;
+  meta: {
+    bucket_size: string;
+    bucket_label: string;
+  };
 }
 
 export interface MetricsFilters {